@@ -0,0 +1,383 @@
+// Package agent runs the conversation between the user, a language model
+// and the shell, independently of any user interface.
+//
+// A Session sends the history to the model, turns the commands it proposes
+// into proposals, has them decided on by an Approver, runs approved ones
+// with an Executor and feeds their results, or the reasons they were
+// refused, back to the model until it stops proposing commands. Everything
+// that happens is reported as an Event.
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	executil "github.com/jrcrittenden/ai-shell/internal/exec"
+	"github.com/jrcrittenden/ai-shell/internal/injection"
+	"github.com/jrcrittenden/ai-shell/internal/output"
+	"github.com/jrcrittenden/ai-shell/llm"
+)
+
+// ErrBusy is returned when a turn or command is already in progress.
+var ErrBusy = errors.New("the session is busy")
+
+// Proposal is a command the model suggested.
+type Proposal struct {
+	Command string
+	Reason  string
+}
+
+// Decision answers a proposal.
+type Decision struct {
+	// Run approves the proposal. Command is what runs instead of the
+	// proposed command if set, e.g. after the user edited it; the model
+	// is told about the change.
+	Run     bool
+	Command string
+	Options executil.Options
+	// Reason explains a refusal to the model.
+	Reason string
+	// Feedback, if set, replaces the message telling the model the command
+	// was refused.
+	Feedback string
+	// Stop ends the turn once the rest of the reply's proposals are decided
+	// on, instead of sending the outcomes back to the model.
+	Stop bool
+}
+
+// Approver decides on proposals. Approve may block, e.g. while it asks the
+// user; it should return when ctx is done.
+type Approver interface {
+	Approve(ctx context.Context, p Proposal) Decision
+}
+
+// ApproverFunc adapts a function to the Approver interface.
+type ApproverFunc func(ctx context.Context, p Proposal) Decision
+
+func (f ApproverFunc) Approve(ctx context.Context, p Proposal) Decision {
+	return f(ctx, p)
+}
+
+// Options configure a Session.
+type Options struct {
+	// Approver decides on proposals. If nil, the session sends a
+	// DecisionNeededEvent for each one and waits for Decide.
+	Approver Approver
+	// Executor runs approved commands; the zero Local by default.
+	Executor Executor
+	// Outputs keeps the full output of commands so that the model can ask
+	// for lines that were clipped.
+	Outputs *output.Store
+	// Budget bounds the output sent back to the model.
+	Budget output.Budget
+	// Summarizer, if set, summarizes outputs too large for the budget.
+	Summarizer llm.Client
+}
+
+// Session is a conversation with a model that may run commands. Its
+// methods are safe for concurrent use. Events must be read for the session
+// to make progress.
+type Session struct {
+	opts      Options
+	events    chan Event
+	decisions chan Decision
+
+	mu        sync.Mutex
+	client    llm.Client
+	history   []llm.Message
+	busy      bool
+	running   bool
+	interrupt context.CancelFunc
+}
+
+// New returns a session with client and an empty history.
+func New(client llm.Client, opts Options) *Session {
+	if opts.Executor == nil {
+		opts.Executor = Local{}
+	}
+	if opts.Outputs == nil {
+		opts.Outputs = &output.Store{}
+	}
+	if opts.Budget == (output.Budget{}) {
+		opts.Budget = output.DefaultBudget()
+	}
+	return &Session{
+		opts:      opts,
+		client:    client,
+		events:    make(chan Event, 64),
+		decisions: make(chan Decision, 1),
+	}
+}
+
+// Events returns the channel on which the session reports what happens.
+func (s *Session) Events() <-chan Event {
+	return s.events
+}
+
+// SetClient switches the model used from the next request on.
+func (s *Session) SetClient(c llm.Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.client = c
+}
+
+// History returns a copy of the conversation so far.
+func (s *Session) History() []llm.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]llm.Message(nil), s.history...)
+}
+
+// Append adds messages to the history without sending them.
+func (s *Session) Append(msgs ...llm.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.history = append(s.history, msgs...)
+}
+
+// Busy reports whether a turn or command is in progress.
+func (s *Session) Busy() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.busy
+}
+
+// Running reports whether a command is running.
+func (s *Session) Running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+// Interrupt interrupts the running command and reports whether there was
+// one.
+func (s *Session) Interrupt() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.running {
+		return false
+	}
+	s.interrupt()
+	return true
+}
+
+// Decide answers the DecisionNeededEvent the session is waiting on.
+func (s *Session) Decide(d Decision) {
+	s.decisions <- d
+}
+
+// begin marks the session busy, or reports that it already is.
+func (s *Session) begin() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.busy {
+		return false
+	}
+	s.busy = true
+	return true
+}
+
+func (s *Session) end() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.busy = false
+}
+
+func (s *Session) emit(e Event) {
+	s.events <- e
+}
+
+// Send adds a user message to the history and starts a turn: the model
+// answers, and the commands it proposes are decided on and run, until it
+// answers without proposing one. The turn ends with a DoneEvent.
+func (s *Session) Send(ctx context.Context, content string) error {
+	if !s.begin() {
+		return ErrBusy
+	}
+	s.Append(llm.Message{Role: "user", Content: content})
+	go s.turn(ctx)
+	return nil
+}
+
+// Execute runs a command the user chose, outside of a turn, and adds its
+// result to the history without asking the model to answer. It ends with
+// a ResultEvent.
+func (s *Session) Execute(ctx context.Context, command string, opts executil.Options) error {
+	if !s.begin() {
+		return ErrBusy
+	}
+	go func() {
+		result := s.execute(ctx, command, opts)
+		s.end()
+		s.emit(result)
+	}()
+	return nil
+}
+
+func (s *Session) turn(ctx context.Context) {
+	for {
+		calls, err := s.ask(ctx)
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err != nil || len(calls) == 0 {
+			s.end()
+			s.emit(DoneEvent{Err: err})
+			return
+		}
+		var stop bool
+		for _, call := range calls {
+			if id, from, to, ok := output.ParseRange(call.Command); ok {
+				s.serveRange(call.Command, id, from, to)
+				continue
+			}
+			d, err := s.propose(ctx, Proposal{Command: call.Command, Reason: call.Reason})
+			if err != nil {
+				s.end()
+				s.emit(DoneEvent{Err: err})
+				return
+			}
+			stop = stop || d.Stop
+		}
+		if stop {
+			s.end()
+			s.emit(DoneEvent{})
+			return
+		}
+	}
+}
+
+// ask sends the history to the model, adds its answer to the history and
+// returns the commands it proposed.
+func (s *Session) ask(ctx context.Context) ([]llm.ToolCall, error) {
+	s.mu.Lock()
+	client, history := s.client, append([]llm.Message(nil), s.history...)
+	s.mu.Unlock()
+	if client == nil {
+		return nil, errors.New("no model configured")
+	}
+	s.emit(RequestEvent{Messages: history})
+
+	var reply strings.Builder
+	var calls []llm.ToolCall
+	var err error
+	for chunk := range client.Stream(ctx, history) {
+		if chunk.Err != nil {
+			err = chunk.Err
+			continue
+		}
+		if chunk.Text != "" {
+			reply.WriteString(chunk.Text)
+			s.emit(TextEvent{Text: chunk.Text})
+		}
+		if chunk.ToolCall != nil {
+			calls = append(calls, *chunk.ToolCall)
+		}
+	}
+	if reply.Len() > 0 {
+		s.Append(llm.Message{Role: "assistant", Content: reply.String()})
+	}
+	s.emit(ReplyEvent{Text: reply.String(), Proposals: len(calls)})
+	return calls, err
+}
+
+// propose has p decided on and runs it if approved. Either way the model
+// hears about the outcome on its next request. It returns the decision.
+func (s *Session) propose(ctx context.Context, p Proposal) (Decision, error) {
+	s.emit(ProposalEvent{Proposal: p})
+	var d Decision
+	if s.opts.Approver != nil {
+		d = s.opts.Approver.Approve(ctx, p)
+	} else {
+		s.emit(DecisionNeededEvent{Proposal: p})
+		select {
+		case d = <-s.decisions:
+		case <-ctx.Done():
+			return d, ctx.Err()
+		}
+	}
+
+	if !d.Run {
+		feedback := d.Feedback
+		if feedback == "" {
+			feedback = fmt.Sprintf("Denied command `%s`: %s", p.Command, d.Reason)
+		}
+		s.Append(llm.Message{Role: "user", Content: feedback})
+		return d, nil
+	}
+	command := p.Command
+	if d.Command != "" && d.Command != p.Command {
+		command = d.Command
+		s.Append(llm.Message{Role: "user", Content: fmt.Sprintf(
+			"I edited your proposed command before running it.\nProposed: `%s`\nRan instead: `%s`\nTake the correction into account for future commands.",
+			p.Command, command)})
+	}
+	s.emit(s.execute(ctx, command, d.Options))
+	return d, nil
+}
+
+// execute runs command and adds its result, clipped to the output budget
+// and marked as untrusted, to the history. It returns the event reporting
+// the result for the caller to send.
+func (s *Session) execute(ctx context.Context, command string, opts executil.Options) ResultEvent {
+	s.emit(StartEvent{Command: command, Options: opts})
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s.mu.Lock()
+	s.running, s.interrupt = true, cancel
+	s.mu.Unlock()
+	r, err := s.opts.Executor.Run(runCtx, command, opts, func(o executil.Output) {
+		s.emit(OutputEvent{Output: o})
+	})
+	s.mu.Lock()
+	s.running, s.interrupt = false, nil
+	s.mu.Unlock()
+	if err != nil {
+		s.Append(llm.Message{Role: "user", Content: fmt.Sprintf("Command `%s` failed to start: %v", command, err)})
+		return ResultEvent{Result: executil.Result{Command: command}, Err: err}
+	}
+
+	shrunk := r
+	var clipped bool
+	shrunk.Stdout, clipped = s.opts.Outputs.Shrink(ctx, s.opts.Summarizer, r.Command, r.Stdout, s.opts.Budget)
+	shrunk.StdoutTruncated = r.StdoutTruncated || clipped
+	shrunk.Stderr, clipped = s.opts.Outputs.Shrink(ctx, s.opts.Summarizer, r.Command, r.Stderr, s.opts.Budget)
+	shrunk.StderrTruncated = r.StderrTruncated || clipped
+	s.scan("stdout", shrunk.Stdout)
+	s.scan("stderr", shrunk.Stderr)
+
+	content := "Command result:\n" + injection.Wrap("the result of the command, including its output", shrunk.JSON())
+	if r.Interrupted {
+		content = "Command was interrupted by the user; output is partial.\n" + content
+	}
+	if r.LimitExceeded != "" {
+		content = fmt.Sprintf("Command was killed for exceeding its %s limit; output is partial.\n", r.LimitExceeded) + content
+	}
+	s.Append(llm.Message{Role: "user", Content: content})
+	return ResultEvent{Result: r}
+}
+
+// serveRange answers the model's request for lines of an earlier output
+// without running anything.
+func (s *Session) serveRange(request string, id, from, to int) {
+	text, err := s.opts.Outputs.Range(id, from, to)
+	if err != nil {
+		text = err.Error()
+	} else {
+		text, _ = s.opts.Outputs.Clip(text, s.opts.Budget)
+	}
+	s.emit(RangeEvent{Request: request})
+	s.scan(fmt.Sprintf("output %d", id), text)
+	s.Append(llm.Message{Role: "user", Content: fmt.Sprintf("Output %d lines %d-%d:\n%s", id, from, to,
+		injection.Wrap(fmt.Sprintf("lines %d-%d of the output of an earlier command", from, to), text))})
+}
+
+// scan reports prompt injection in output about to be sent to the model.
+func (s *Session) scan(source, text string) {
+	if findings := injection.Scan(text); len(findings) > 0 {
+		s.emit(SuspiciousEvent{Source: source, Findings: findings})
+	}
+}
@@ -0,0 +1,318 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	executil "github.com/jrcrittenden/ai-shell/internal/exec"
+	"github.com/jrcrittenden/ai-shell/internal/output"
+	"github.com/jrcrittenden/ai-shell/llm"
+)
+
+// scriptClient answers each request with the next reply of its script and
+// records the histories it was sent.
+type scriptClient struct {
+	replies [][]llm.Chunk
+	sent    *[][]llm.Message
+}
+
+func (c scriptClient) Stream(ctx context.Context, hist []llm.Message) <-chan llm.Chunk {
+	n := len(*c.sent)
+	*c.sent = append(*c.sent, hist)
+	out := make(chan llm.Chunk, 8)
+	if n < len(c.replies) {
+		for _, chunk := range c.replies[n] {
+			out <- chunk
+		}
+	}
+	out <- llm.Chunk{Done: true}
+	close(out)
+	return out
+}
+
+func say(text string) llm.Chunk {
+	return llm.Chunk{Text: text}
+}
+
+func call(command string) llm.Chunk {
+	return llm.Chunk{ToolCall: &llm.ToolCall{Command: command, Reason: "because"}}
+}
+
+// fakeExecutor "runs" commands by echoing them.
+type fakeExecutor struct {
+	ran *[]string
+}
+
+func (e fakeExecutor) Run(ctx context.Context, command string, opts executil.Options, output func(executil.Output)) (executil.Result, error) {
+	*e.ran = append(*e.ran, command)
+	if command == "missing" {
+		return executil.Result{}, errors.New("not found")
+	}
+	output(executil.Output{Line: "ran " + command})
+	return executil.Result{Command: command, Stdout: "ran " + command + "\n"}, nil
+}
+
+// collect reads events until the turn ends, or until the first result if
+// untilResult is set, answering DecisionNeededEvent with decide.
+func collect(t *testing.T, s *Session, untilResult bool, decide func(Proposal) Decision) []Event {
+	t.Helper()
+	var events []Event
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-s.Events():
+			events = append(events, e)
+			switch e := e.(type) {
+			case DecisionNeededEvent:
+				s.Decide(decide(e.Proposal))
+			case DoneEvent:
+				return events
+			case ResultEvent:
+				if untilResult {
+					return events
+				}
+			}
+		case <-timeout:
+			t.Fatalf("run did not end after %d events", len(events))
+		}
+	}
+}
+
+func kinds(events []Event) []string {
+	var names []string
+	for _, e := range events {
+		names = append(names, reflect.TypeOf(e).Name())
+	}
+	return names
+}
+
+func TestTurn(t *testing.T) {
+	var sent [][]llm.Message
+	var ran []string
+	client := scriptClient{sent: &sent, replies: [][]llm.Chunk{
+		{say("Let me look."), call("ls")},
+		{call("rm -rf /"), call("cat go.mod")},
+		{say("All done.")},
+	}}
+	s := New(client, Options{Executor: fakeExecutor{&ran}})
+	if err := s.Send(context.Background(), "what is here?"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Send(context.Background(), "again"); !errors.Is(err, ErrBusy) {
+		t.Errorf("second Send = %v, want ErrBusy", err)
+	}
+	events := collect(t, s, false, func(p Proposal) Decision {
+		switch p.Command {
+		case "rm -rf /":
+			return Decision{Reason: "too dangerous"}
+		case "cat go.mod":
+			return Decision{Run: true, Command: "head go.mod"}
+		}
+		return Decision{Run: true}
+	})
+
+	want := []string{
+		"RequestEvent", "TextEvent", "ReplyEvent",
+		"ProposalEvent", "DecisionNeededEvent", "StartEvent", "OutputEvent", "ResultEvent",
+		"RequestEvent", "ReplyEvent",
+		"ProposalEvent", "DecisionNeededEvent",
+		"ProposalEvent", "DecisionNeededEvent", "StartEvent", "OutputEvent", "ResultEvent",
+		"RequestEvent", "TextEvent", "ReplyEvent", "DoneEvent",
+	}
+	if got := kinds(events); !reflect.DeepEqual(got, want) {
+		t.Fatalf("events =\n%q\nwant\n%q", got, want)
+	}
+	if !reflect.DeepEqual(ran, []string{"ls", "head go.mod"}) {
+		t.Errorf("ran %q", ran)
+	}
+	if s.Busy() {
+		t.Error("session busy after the turn")
+	}
+
+	// The last request carries every outcome, in order.
+	var contents []string
+	for _, m := range sent[2] {
+		contents = append(contents, m.Role+": "+m.Content)
+	}
+	history := strings.Join(contents, "\n")
+	for _, want := range []string{
+		"user: what is here?",
+		"assistant: Let me look.",
+		`"stdout": "ran ls\n"`,
+		"Denied command `rm -rf /`: too dangerous",
+		"Proposed: `cat go.mod`\nRan instead: `head go.mod`",
+		"untrusted-data",
+	} {
+		if !strings.Contains(history, want) {
+			t.Errorf("history lacks %q:\n%s", want, history)
+		}
+	}
+	if got := s.History(); got[len(got)-1].Content != "All done." {
+		t.Errorf("last message = %+v", got[len(got)-1])
+	}
+}
+
+func TestApproverAndFeedback(t *testing.T) {
+	var sent [][]llm.Message
+	var ran []string
+	client := scriptClient{sent: &sent, replies: [][]llm.Chunk{
+		{call("make"), call("@output 1 1-1")},
+		{call("missing")},
+	}}
+	approver := ApproverFunc(func(ctx context.Context, p Proposal) Decision {
+		if p.Command == "make" {
+			return Decision{Feedback: "Command `make` was denied by policy: no builds"}
+		}
+		return Decision{Run: true}
+	})
+	outputs := &output.Store{}
+	outputs.Add("first line\nsecond line")
+	s := New(client, Options{Approver: approver, Executor: fakeExecutor{&ran}, Outputs: outputs})
+	if err := s.Send(context.Background(), "build"); err != nil {
+		t.Fatal(err)
+	}
+	events := collect(t, s, false, nil)
+
+	var result ResultEvent
+	for _, e := range events {
+		switch e := e.(type) {
+		case DecisionNeededEvent:
+			t.Error("decision asked for despite the approver")
+		case ResultEvent:
+			result = e
+		}
+	}
+	if result.Err == nil || result.Result.Command != "missing" {
+		t.Errorf("result = %+v", result)
+	}
+	history := sent[1]
+	if got := history[len(history)-2].Content; got != "Command `make` was denied by policy: no builds" {
+		t.Errorf("feedback = %q", got)
+	}
+	if got := history[len(history)-1].Content; !strings.HasPrefix(got, "Output 1 lines 1-1:") || !strings.Contains(got, "first line") {
+		t.Errorf("range answer = %q", got)
+	}
+	if got := s.History(); got[len(got)-1].Content != "Command `missing` failed to start: not found" {
+		t.Errorf("last message = %q", got[len(got)-1].Content)
+	}
+}
+
+func TestEditedCommand(t *testing.T) {
+	var sent [][]llm.Message
+	var ran []string
+	client := scriptClient{sent: &sent, replies: [][]llm.Chunk{
+		{call("rm -rf build"), call("ls")},
+	}}
+	s := New(client, Options{Executor: fakeExecutor{&ran}})
+	if err := s.Send(context.Background(), "clean up"); err != nil {
+		t.Fatal(err)
+	}
+	collect(t, s, false, func(p Proposal) Decision {
+		if p.Command == "rm -rf build" {
+			return Decision{Run: true, Command: "rm -rf build/obj"}
+		}
+		// Approving the command unchanged is not an edit.
+		return Decision{Run: true, Command: "ls"}
+	})
+
+	if !reflect.DeepEqual(ran, []string{"rm -rf build/obj", "ls"}) {
+		t.Fatalf("ran %q", ran)
+	}
+	var contents []string
+	for _, m := range sent[1] {
+		if m.Role == "user" {
+			contents = append(contents, m.Content)
+		}
+	}
+	want := "I edited your proposed command before running it.\nProposed: `rm -rf build`\nRan instead: `rm -rf build/obj`\nTake the correction into account for future commands."
+	if len(contents) != 4 || contents[1] != want {
+		t.Fatalf("user messages =\n%q", contents)
+	}
+	// The correction comes before the result of the edited command.
+	if !strings.HasPrefix(contents[2], "Command result:") || !strings.Contains(contents[2], "rm -rf build/obj") {
+		t.Errorf("after the correction: %q", contents[2])
+	}
+	if strings.Contains(contents[3], "I edited") {
+		t.Errorf("unchanged command reported as edited: %q", contents[3])
+	}
+}
+
+func TestStop(t *testing.T) {
+	var sent [][]llm.Message
+	var ran []string
+	client := scriptClient{sent: &sent, replies: [][]llm.Chunk{
+		{call("ls"), call("pwd")},
+		{say("never asked")},
+	}}
+	s := New(client, Options{Executor: fakeExecutor{&ran}})
+	if err := s.Send(context.Background(), "where am I?"); err != nil {
+		t.Fatal(err)
+	}
+	var decided []string
+	events := collect(t, s, false, func(p Proposal) Decision {
+		decided = append(decided, p.Command)
+		return Decision{Reason: "only printed", Stop: true}
+	})
+	if done := events[len(events)-1].(DoneEvent); done.Err != nil {
+		t.Errorf("turn ended with %v", done.Err)
+	}
+	if !reflect.DeepEqual(decided, []string{"ls", "pwd"}) || len(ran) != 0 {
+		t.Errorf("decided %q, ran %q", decided, ran)
+	}
+	if len(sent) != 1 {
+		t.Errorf("model asked %d times, want once", len(sent))
+	}
+}
+
+func TestExecute(t *testing.T) {
+	var sent [][]llm.Message
+	var ran []string
+	s := New(scriptClient{sent: &sent}, Options{Executor: fakeExecutor{&ran}})
+	if err := s.Execute(context.Background(), "true", executil.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	events := collect(t, s, true, nil)
+	if got := kinds(events); !reflect.DeepEqual(got, []string{"StartEvent", "OutputEvent", "ResultEvent"}) {
+		t.Errorf("events = %q", got)
+	}
+	if len(sent) != 0 {
+		t.Error("Execute asked the model to answer")
+	}
+	if h := s.History(); len(h) != 1 || !strings.HasPrefix(h[0].Content, "Command result:") {
+		t.Errorf("history = %+v", h)
+	}
+}
+
+func TestInterrupt(t *testing.T) {
+	var sent [][]llm.Message
+	s := New(scriptClient{sent: &sent}, Options{Executor: Local{Grace: time.Second}})
+	if s.Interrupt() {
+		t.Error("Interrupt with nothing running")
+	}
+	if err := s.Execute(context.Background(), "sleep 10", executil.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	for e := range s.Events() {
+		if _, ok := e.(StartEvent); ok {
+			break
+		}
+	}
+	for !s.Running() {
+		time.Sleep(time.Millisecond)
+	}
+	if !s.Interrupt() {
+		t.Fatal("nothing to interrupt")
+	}
+	events := collect(t, s, true, nil)
+	r := events[len(events)-1].(ResultEvent).Result
+	if !r.Interrupted || r.Success() {
+		t.Errorf("result = %+v", r)
+	}
+	if h := s.History(); !strings.HasPrefix(h[0].Content, "Command was interrupted by the user") {
+		t.Errorf("history = %q", h[0].Content)
+	}
+}
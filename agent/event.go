@@ -0,0 +1,84 @@
+package agent
+
+import (
+	executil "github.com/jrcrittenden/ai-shell/internal/exec"
+	"github.com/jrcrittenden/ai-shell/internal/injection"
+	"github.com/jrcrittenden/ai-shell/llm"
+)
+
+// Event is something that happened in a session. Events are delivered in
+// order on the channel returned by Session.Events.
+type Event interface {
+	event()
+}
+
+type (
+	// RequestEvent is sent before the history is sent to the model.
+	RequestEvent struct {
+		Messages []llm.Message
+	}
+	// TextEvent carries a piece of the model's answer as it streams in.
+	TextEvent struct {
+		Text string
+	}
+	// ReplyEvent is sent once the model has finished answering, with its
+	// whole text and the number of commands it proposed.
+	ReplyEvent struct {
+		Text      string
+		Proposals int
+	}
+	// ProposalEvent is sent for every command the model proposes, before
+	// it is decided on.
+	ProposalEvent struct {
+		Proposal Proposal
+	}
+	// DecisionNeededEvent asks for a decision on a proposal when the
+	// session has no Approver. The session waits until Decide is called.
+	DecisionNeededEvent struct {
+		Proposal Proposal
+	}
+	// StartEvent is sent when an approved command starts.
+	StartEvent struct {
+		Command string
+		Options executil.Options
+	}
+	// OutputEvent carries a line of output of the running command.
+	OutputEvent struct {
+		Output executil.Output
+	}
+	// ResultEvent is sent when a command has finished, or with Err if it
+	// could not be started. Result holds the full output; the model gets
+	// it clipped to the output budget.
+	ResultEvent struct {
+		Result executil.Result
+		Err    error
+	}
+	// SuspiciousEvent reports instruction-like content in output sent to
+	// the model, such as "stdout" or "output 3".
+	SuspiciousEvent struct {
+		Source   string
+		Findings []injection.Finding
+	}
+	// RangeEvent is sent when the model's request for lines of an earlier
+	// output was answered without running anything.
+	RangeEvent struct {
+		Request string
+	}
+	// DoneEvent ends a turn started by Send, with the error that ended it
+	// early, if any.
+	DoneEvent struct {
+		Err error
+	}
+)
+
+func (RequestEvent) event()        {}
+func (TextEvent) event()           {}
+func (ReplyEvent) event()          {}
+func (ProposalEvent) event()       {}
+func (DecisionNeededEvent) event() {}
+func (StartEvent) event()          {}
+func (OutputEvent) event()         {}
+func (ResultEvent) event()         {}
+func (SuspiciousEvent) event()     {}
+func (RangeEvent) event()          {}
+func (DoneEvent) event()           {}
@@ -0,0 +1,50 @@
+package agent
+
+import (
+	"context"
+	"time"
+
+	executil "github.com/jrcrittenden/ai-shell/internal/exec"
+)
+
+// Executor runs approved commands.
+type Executor interface {
+	// Run runs command, passing each line of output to output as it is
+	// produced. Cancelling ctx interrupts the command.
+	Run(ctx context.Context, command string, opts executil.Options, output func(executil.Output)) (executil.Result, error)
+}
+
+// Local runs commands on this machine through the system shell.
+type Local struct {
+	// Grace is how long an interrupted command may take to exit after
+	// SIGINT before it is killed.
+	Grace time.Duration
+	// Rewrite, if set, changes the command just before it runs, e.g. to
+	// put back secrets the model only saw as placeholders.
+	Rewrite func(string) string
+}
+
+func (l Local) Run(ctx context.Context, command string, opts executil.Options, output func(executil.Output)) (executil.Result, error) {
+	if l.Rewrite != nil {
+		command = l.Rewrite(command)
+	}
+	// Cancellation interrupts the command gracefully instead of killing it.
+	p, err := executil.Start(context.WithoutCancel(ctx), command, opts)
+	if err != nil {
+		return executil.Result{}, err
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			p.Interrupt(l.Grace)
+		case <-p.Done():
+		}
+	}()
+	for o := range p.Output() {
+		output(o)
+	}
+	if err := p.SandboxErr(); err != nil {
+		return executil.Result{}, err
+	}
+	return p.Result(), nil
+}
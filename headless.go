@@ -0,0 +1,373 @@
+// headless.go — one-shot, non-interactive mode (ai-shell -p "prompt") -----
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jrcrittenden/ai-shell/agent"
+	"github.com/jrcrittenden/ai-shell/internal/audit"
+	"github.com/jrcrittenden/ai-shell/internal/egress"
+	executil "github.com/jrcrittenden/ai-shell/internal/exec"
+	"github.com/jrcrittenden/ai-shell/internal/injection"
+	"github.com/jrcrittenden/ai-shell/internal/placeholder"
+	"github.com/jrcrittenden/ai-shell/internal/policy"
+	"github.com/jrcrittenden/ai-shell/internal/redact"
+)
+
+// What a headless run does with the commands the model proposes.
+const (
+	// commandsPrint prints them after the answer, each under a comment
+	// with its reason, ready to be copied.
+	commandsPrint = "print"
+	// commandsStdout writes only the commands to stdout, one per line, and
+	// the answer to stderr, for use in $(...) or a pipe.
+	commandsStdout = "stdout"
+	// commandsExecute asks for confirmation on the terminal and runs the
+	// confirmed ones.
+	commandsExecute = "execute"
+)
+
+// Exit codes of a headless run.
+const (
+	exitOK = 0
+	// exitError means the backend failed or the run could not start.
+	exitError = 1
+	// exitUsage means the flags were invalid.
+	exitUsage = 2
+	// exitFailed means a command ran but failed, or could not start.
+	exitFailed = 3
+	// exitRefused means a command was declined, or denied by the policy.
+	exitRefused = 4
+	// exitInterrupted means the run was interrupted with ctrl+c.
+	exitInterrupted = 130
+)
+
+// errNoTTY is returned by ttyAsk when there is no terminal to ask on.
+var errNoTTY = errors.New("no terminal to ask for confirmation on")
+
+// headless runs a single prompt through a session without the TUI and
+// writes what happens to out and errOut, as text or as JSON lines.
+type headless struct {
+	session  *agent.Session
+	commands string
+	json     bool
+	out      io.Writer
+	errOut   io.Writer
+	// ask shows prompt on the terminal and returns the line typed in
+	// answer; ttyAsk by default.
+	ask func(prompt string) (string, error)
+
+	policy   *policy.Policy
+	sandbox  executil.Profile
+	limits   executil.Limits
+	audit    *audit.Log
+	redactor *redact.Redactor
+	backend  string
+	model    string
+
+	// suspect is set once output sent to the model looked like a prompt
+	// injection; commands then have to be typed to run.
+	suspect bool
+	// text is set while the answer being streamed lacks a final newline.
+	text    bool
+	failed  bool
+	refused bool
+}
+
+// run sends prompt and handles the session's events until the turn ends,
+// returning the exit code.
+func (h *headless) run(ctx context.Context, prompt string) int {
+	if err := h.session.Send(ctx, prompt); err != nil {
+		fmt.Fprintf(h.errOut, "Error: %v\n", err)
+		return exitError
+	}
+	for e := range h.session.Events() {
+		if done, ok := e.(agent.DoneEvent); ok {
+			return h.done(ctx, done.Err)
+		}
+		h.handle(ctx, e)
+	}
+	return exitError
+}
+
+// handle reports e and answers the session when it waits for a decision.
+func (h *headless) handle(ctx context.Context, e agent.Event) {
+	switch e := e.(type) {
+	case agent.TextEvent:
+		h.emit(map[string]any{"type": "text", "text": e.Text})
+		if !h.json {
+			fmt.Fprint(h.answer(), e.Text)
+			h.text = !strings.HasSuffix(e.Text, "\n")
+		}
+
+	case agent.ReplyEvent:
+		h.endText()
+
+	case agent.DecisionNeededEvent:
+		p := e.Proposal
+		h.emit(map[string]any{"type": "proposal", "command": p.Command, "reason": p.Reason})
+		d, decision := h.decide(ctx, p)
+		event := map[string]any{"type": "decision", "command": p.Command, "decision": decision}
+		if d.Reason != "" {
+			event["reason"] = d.Reason
+		}
+		h.emit(event)
+		h.session.Decide(d)
+
+	case agent.StartEvent:
+		h.emit(map[string]any{"type": "start", "command": e.Command})
+
+	case agent.OutputEvent:
+		stream := "stdout"
+		w := h.out
+		if e.Output.Stream == executil.Stderr {
+			stream, w = "stderr", h.errOut
+		}
+		h.emit(map[string]any{"type": "output", "stream": stream, "line": e.Output.Line})
+		if !h.json {
+			fmt.Fprintln(w, e.Output.Line)
+		}
+
+	case agent.ResultEvent:
+		if e.Err != nil || !e.Result.Success() {
+			h.failed = true
+		}
+		if e.Err != nil {
+			h.emit(map[string]any{"type": "result", "command": e.Result.Command, "error": e.Err.Error()})
+			if !h.json {
+				fmt.Fprintf(h.errOut, "%s: %v\n", e.Result.Command, e.Err)
+			}
+			return
+		}
+		logged := e.Result
+		if h.redactor != nil {
+			logged.Command = h.redactor.Redact(logged.Command)
+			logged.Stdout = h.redactor.Redact(logged.Stdout)
+			logged.Stderr = h.redactor.Redact(logged.Stderr)
+		}
+		h.record(audit.Entry{Event: audit.EventExecution, Command: logged.Command, Details: json.RawMessage(logged.JSON())})
+		h.emit(map[string]any{"type": "result", "result": json.RawMessage(e.Result.JSON())})
+		if !h.json {
+			fmt.Fprintln(h.errOut, resultBadge(e.Result))
+			for _, w := range e.Result.Warnings {
+				fmt.Fprintf(h.errOut, "warning: %s\n", w)
+			}
+		}
+
+	case agent.SuspiciousEvent:
+		h.suspicious(e.Source, e.Findings)
+
+	case agent.RangeEvent:
+		h.emit(map[string]any{"type": "range", "request": e.Request})
+	}
+}
+
+// suspicious reports instruction-like content found in source, such as
+// "stdout" or "stdin", and makes commands from then on be typed to run.
+func (h *headless) suspicious(source string, findings []injection.Finding) {
+	h.suspect = true
+	lines := make([]string, len(findings))
+	for i, f := range findings {
+		lines[i] = f.String()
+	}
+	h.emit(map[string]any{"type": "suspicious", "source": source, "findings": lines})
+	if !h.json {
+		fmt.Fprintf(h.errOut, "[possible prompt injection in %s; commands must now be typed to run]\n  %s\n",
+			source, strings.Join(lines, "\n  "))
+	}
+}
+
+// decide answers a proposal according to h.commands and returns the
+// decision with the name it is reported under. Commands the policy denies
+// are neither printed nor run.
+func (h *headless) decide(ctx context.Context, p agent.Proposal) (agent.Decision, string) {
+	h.record(audit.Entry{Event: audit.EventProposal, Command: p.Command, Reason: p.Reason})
+	masked := placeholder.Mask(p.Command)
+	dir, _ := os.Getwd()
+	d := h.policy.Evaluate(policy.Input{Command: masked, Dir: dir, Risk: analyzeRisk(masked)})
+	if d.Action == policy.Deny {
+		reason := d.Message
+		if reason == "" {
+			reason = "the command is not allowed by policy"
+		}
+		return h.refuse(p, audit.PolicyDenied, fmt.Sprintf("denied by policy %q: %s", d.Rule, reason)), "denied"
+	}
+
+	// Printed commands are for the user to run, so they get the secrets the
+	// model only saw as placeholders.
+	printed := p.Command
+	if h.redactor != nil {
+		printed = h.redactor.Restore(printed)
+	}
+	switch h.commands {
+	case commandsStdout:
+		if !h.json {
+			fmt.Fprintln(h.out, printed)
+		}
+		return h.notRun(p), "printed"
+	case commandsPrint:
+		if !h.json {
+			h.endText()
+			if p.Reason != "" {
+				fmt.Fprintf(h.out, "# %s\n", p.Reason)
+			}
+			fmt.Fprintln(h.out, printed)
+		}
+		return h.notRun(p), "printed"
+	}
+
+	if names := placeholder.Names(p.Command); len(names) > 0 {
+		return h.refuse(p, audit.Denied, "it has placeholders to fill in: "+strings.Join(names, ", ")), "declined"
+	}
+
+	// Nothing runs unconfirmed; commands the TUI would have typed are typed
+	// here too.
+	word := ""
+	e := egress.Analyze(masked, egress.Options{Allow: h.policy.AllowHosts})
+	if d.Action == policy.Type || h.suspect || e.Uploads() {
+		word = confirmWord(p.Command)
+	}
+	h.endText()
+	prompt := fmt.Sprintf("\n$ %s\n", p.Command)
+	if p.Reason != "" {
+		prompt = fmt.Sprintf("\n# %s%s", p.Reason, prompt)
+	}
+	if e.Network() {
+		prompt += "Network: " + egressSummary(e) + "\n"
+	}
+	if word != "" {
+		prompt += fmt.Sprintf("Type %q to run it: ", word)
+	} else {
+		prompt += "Run it? [y/N] "
+	}
+	// ctrl+c does not end the read, so it is left behind when interrupted.
+	type reply struct {
+		line string
+		err  error
+	}
+	replies := make(chan reply, 1)
+	go func() {
+		line, err := h.ask(prompt)
+		replies <- reply{line, err}
+	}()
+	var answer string
+	select {
+	case r := <-replies:
+		if r.err != nil {
+			return h.refuse(p, audit.Denied, r.err.Error()), "declined"
+		}
+		answer = strings.TrimSpace(r.line)
+	case <-ctx.Done():
+		return h.refuse(p, audit.Denied, "interrupted by the user"), "declined"
+	}
+	if word != "" && answer != word || word == "" && !strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes") {
+		return h.refuse(p, audit.Denied, "declined by the user"), "declined"
+	}
+	h.record(audit.Entry{Event: audit.EventDecision, Command: p.Command, Decision: audit.Approved})
+	return agent.Decision{Run: true, Options: executil.Options{Sandbox: h.sandbox, Limits: h.limits}}, "approved"
+}
+
+// notRun tells the model that p was handed to the user and ends the turn,
+// since nothing new will be learned by asking again.
+func (h *headless) notRun(p agent.Proposal) agent.Decision {
+	return agent.Decision{
+		Feedback: fmt.Sprintf("Command `%s` was shown to the user but not run.", p.Command),
+		Stop:     true,
+	}
+}
+
+// refuse records that p will not run because of reason and ends the turn.
+func (h *headless) refuse(p agent.Proposal, decision, reason string) agent.Decision {
+	h.refused = true
+	h.record(audit.Entry{Event: audit.EventDecision, Command: p.Command, Decision: decision, DenyReason: reason})
+	if !h.json {
+		fmt.Fprintf(h.errOut, "[not run: %s]\n", reason)
+	}
+	return agent.Decision{Reason: reason, Stop: true}
+}
+
+// done reports the end of the run and returns its exit code.
+func (h *headless) done(ctx context.Context, err error) int {
+	h.endText()
+	code := exitOK
+	switch {
+	case ctx.Err() != nil:
+		code = exitInterrupted
+	case err != nil:
+		code = exitError
+	case h.failed:
+		code = exitFailed
+	case h.refused:
+		code = exitRefused
+	}
+	event := map[string]any{"type": "done", "exit_code": code}
+	if err != nil {
+		event["error"] = err.Error()
+	}
+	h.emit(event)
+	if code == exitError && !h.json {
+		fmt.Fprintf(h.errOut, "Error: %v\n", err)
+	}
+	return code
+}
+
+// answer is where the model's answer is written: stderr when stdout is
+// reserved for commands.
+func (h *headless) answer() io.Writer {
+	if h.commands == commandsStdout {
+		return h.errOut
+	}
+	return h.out
+}
+
+// endText ends a streamed answer that lacks a final newline.
+func (h *headless) endText() {
+	if h.text {
+		fmt.Fprintln(h.answer())
+		h.text = false
+	}
+}
+
+// emit writes event as a line of JSON in --json mode.
+func (h *headless) emit(event map[string]any) {
+	if !h.json {
+		return
+	}
+	b, _ := json.Marshal(event)
+	fmt.Fprintf(h.out, "%s\n", b)
+}
+
+// record appends e to the audit log, if one is configured.
+func (h *headless) record(e audit.Entry) {
+	if h.audit == nil {
+		return
+	}
+	e.Backend = h.backend
+	e.Model = h.model
+	if err := h.audit.Append(e); err != nil {
+		fmt.Fprintf(h.errOut, "[audit log error: %v]\n", err)
+	}
+}
+
+// ttyAsk shows prompt on the controlling terminal and reads a line from
+// it, so that confirmations work while stdin and stdout are redirected.
+func ttyAsk(prompt string) (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", errNoTTY
+	}
+	defer tty.Close()
+	fmt.Fprint(tty, prompt)
+	line, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return line, nil
+}
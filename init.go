@@ -0,0 +1,103 @@
+// init.go — "ai-shell init zsh|bash|fish" shell widgets ---------------------
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// widgets are the key-bound functions printed by "ai-shell init". Each one
+// sends the line being edited to a headless ai-shell as a request and
+// replaces the line with the suggested command, to be edited and run as
+// usual. %s is where the flags given to init go. $AI_SHELL overrides the
+// binary that is called.
+var widgets = map[string]string{
+	"zsh": `# ai-shell widget for zsh. Add to ~/.zshrc:
+#   eval "$(ai-shell init zsh)"
+# Ctrl+G turns the request on the command line into a command; bind
+# _ai_shell_widget to use another key.
+_ai_shell_widget() {
+  [[ -z $BUFFER ]] && return
+  local suggestion code
+  zle -R "ai-shell: thinking..."
+  suggestion=$(command "${AI_SHELL:-ai-shell}"%s -commands stdout -p "$BUFFER" 2>/dev/null </dev/null)
+  code=$?
+  if [[ -n $suggestion ]]; then
+    BUFFER=$suggestion
+    CURSOR=${#BUFFER}
+  else
+    zle -M "ai-shell: no command suggested (exit $code)"
+  fi
+  zle reset-prompt
+}
+zle -N _ai_shell_widget
+bindkey '^G' _ai_shell_widget
+`,
+
+	"bash": `# ai-shell widget for bash. Add to ~/.bashrc:
+#   eval "$(ai-shell init bash)"
+# Ctrl+G turns the request on the command line into a command; bind
+# _ai_shell_widget with "bind -x" to use another key.
+_ai_shell_widget() {
+  [[ -z $READLINE_LINE ]] && return
+  local suggestion code sep=' && '
+  suggestion=$(command "${AI_SHELL:-ai-shell}"%s -commands stdout -p "$READLINE_LINE" 2>/dev/null </dev/null)
+  code=$?
+  if [[ -n $suggestion ]]; then
+    # Readline edits a single line, so several commands are chained.
+    READLINE_LINE=${suggestion//$'\n'/"$sep"}
+    READLINE_POINT=${#READLINE_LINE}
+  else
+    printf 'ai-shell: no command suggested (exit %%d)\n' "$code" >&2
+  fi
+}
+bind -x '"\C-g": _ai_shell_widget'
+`,
+
+	"fish": `# ai-shell widget for fish. Add to ~/.config/fish/config.fish:
+#   ai-shell init fish | source
+# Ctrl+G turns the request on the command line into a command; bind
+# _ai_shell_widget to use another key.
+function _ai_shell_widget
+    set -l request (commandline)
+    test -z "$request"; and return
+    set -l bin ai-shell
+    set -q AI_SHELL; and set bin $AI_SHELL
+    set -l suggestion (command $bin%s -commands stdout -p "$request" 2>/dev/null </dev/null)
+    set -l code $status
+    if test (count $suggestion) -gt 0
+        commandline -r -- (string join \n -- $suggestion)
+    else
+        echo
+        echo "ai-shell: no command suggested (exit $code)"
+    end
+    commandline -f repaint
+end
+bind \cg _ai_shell_widget
+`,
+}
+
+// runInit implements "ai-shell init zsh|bash|fish [flags]", which prints
+// the widget for the shell. Flags after the shell name, such as -backend,
+// are passed to every request the widget makes.
+func runInit(args []string) int {
+	if len(args) == 0 || widgets[args[0]] == "" {
+		fmt.Fprintln(os.Stderr, "usage: ai-shell init zsh|bash|fish [flags for each request]")
+		return exitUsage
+	}
+	var flags strings.Builder
+	for _, a := range args[1:] {
+		flags.WriteString(" " + shellQuote(args[0], a))
+	}
+	fmt.Printf(widgets[args[0]], flags.String())
+	return exitOK
+}
+
+// shellQuote quotes s as a single word for shell.
+func shellQuote(shell, s string) string {
+	if shell == "fish" {
+		return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
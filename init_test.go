@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// initScript returns what "ai-shell init" prints for args.
+func initScript(t *testing.T, args ...string) string {
+	t.Helper()
+	r, w, _ := os.Pipe()
+	stdout := os.Stdout
+	os.Stdout = w
+	code := runInit(args)
+	os.Stdout = stdout
+	w.Close()
+	out, _ := io.ReadAll(r)
+	if code != exitOK {
+		t.Fatalf("runInit(%q) = %d", args, code)
+	}
+	return string(out)
+}
+
+func TestInitWidgets(t *testing.T) {
+	for shell := range widgets {
+		script := initScript(t, shell, "-backend", "it's")
+		if !strings.Contains(script, "-commands stdout -p") || strings.Contains(script, "%!") {
+			t.Errorf("%s widget:\n%s", shell, script)
+		}
+	}
+	if code := runInit([]string{"tcsh"}); code != exitUsage {
+		t.Errorf("unknown shell: exit %d", code)
+	}
+}
+
+func TestInitBash(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not installed")
+	}
+	// A stand-in for ai-shell that suggests two commands naming its
+	// arguments.
+	stub := filepath.Join(t.TempDir(), "ai-shell")
+	os.WriteFile(stub, []byte("#!/bin/sh\nfor a; do printf '[%s]' \"$a\"; done; echo; echo pwd\n"), 0o755)
+
+	script := initScript(t, "bash", "-backend", "it's")
+	cmd := exec.Command(bash, "-c", script+`
+READLINE_LINE="list files"
+_ai_shell_widget
+printf '%s' "$READLINE_LINE"`)
+	cmd.Env = append(os.Environ(), "AI_SHELL="+stub)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("%v: %s", err, stderr.String())
+	}
+	want := "[-backend][it's][-commands][stdout][-p][list files] && pwd"
+	if string(out) != want {
+		t.Errorf("line = %q, want %q", out, want)
+	}
+}
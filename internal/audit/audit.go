@@ -0,0 +1,287 @@
+// Package audit keeps an append-only, hash-chained JSONL record of every
+// command the assistant proposed, what the user decided and what ran.
+//
+// Each entry stores the hash of the previous entry and its own hash over
+// its contents, so editing, reordering or deleting an entry breaks the
+// chain. The sequence number and hash of the newest entry are also kept in
+// a ".head" file next to the log so that truncating the end is detected.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Event types recorded in the log.
+const (
+	EventProposal  = "proposal"
+	EventDecision  = "decision"
+	EventEdit      = "edit"
+	EventExecution = "execution"
+	EventUndo      = "undo"
+)
+
+// Decisions recorded with EventDecision.
+const (
+	Approved     = "approved"
+	Denied       = "denied"
+	AutoApproved = "auto-approved"
+	// PreflightFailed proposals were sent back to the model unseen.
+	PreflightFailed = "preflight-failed"
+	// AlwaysAllowed is an approval that also added an allow rule.
+	AlwaysAllowed = "always-allowed"
+	PolicyDenied  = "policy-denied"
+	// PlanApproved commands ran as a step of a plan the user approved.
+	PlanApproved = "plan-approved"
+)
+
+// Entry is one line of the audit log.
+type Entry struct {
+	Seq      int64     `json:"seq"`
+	Time     time.Time `json:"time"`
+	Host     string    `json:"host"`
+	User     string    `json:"user"`
+	Event    string    `json:"event"`
+	Backend  string    `json:"backend,omitempty"`
+	Model    string    `json:"model,omitempty"`
+	Command  string    `json:"command,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+	Decision string    `json:"decision,omitempty"`
+	// DenyReason is the user's or the policy's reason for a denial.
+	DenyReason string `json:"deny_reason,omitempty"`
+	// Original is the proposed command when the user edited it.
+	Original string `json:"original,omitempty"`
+	// Details holds event specific data such as the execution result or
+	// the sandbox and limits a command was approved with.
+	Details any `json:"details,omitempty"`
+
+	Prev string `json:"prev"`
+	Hash string `json:"hash,omitempty"`
+}
+
+// sum computes the hash of e with its Hash field cleared. Details must be
+// raw JSON, as Append and Verify leave it, so that the bytes hashed are
+// those in the log rather than a re-encoding with other key order.
+func (e Entry) sum() (string, []byte, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", nil, err
+	}
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:]), data, nil
+}
+
+// head is the content of the ".head" file.
+type head struct {
+	Seq  int64  `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+// Log appends entries to an audit file. Several Logs, in one process or
+// in several, may append to the same file.
+type Log struct {
+	mu   sync.Mutex
+	path string
+	host string
+	user string
+}
+
+// DefaultPath returns $HOME/.cache/ai-shell/audit.jsonl.
+func DefaultPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ai-shell", "audit.jsonl")
+}
+
+// Open prepares path for appending, continuing the chain of any entries
+// already in it.
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	l := &Log{path: path}
+	l.host, _ = os.Hostname()
+	if u, err := user.Current(); err == nil {
+		l.user = u.Username
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := lastEntry(f); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Append completes e with sequence number, time, host, user and chain
+// hashes and writes it to the log. The file stays locked from reading the
+// last entry until the head is written, so that appends of other Logs on
+// the same file continue the chain rather than fork it.
+func (l *Log) Append(e Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := lock(f); err != nil {
+		return err
+	}
+	last, err := lastEntry(f)
+	if err != nil {
+		return err
+	}
+	if last != nil {
+		e.Seq, e.Prev = last.Seq+1, last.Hash
+	} else {
+		e.Seq, e.Prev = 1, ""
+	}
+
+	e.Time = time.Now().UTC()
+	e.Host = l.host
+	e.User = l.user
+	if e.Details != nil {
+		raw, err := json.Marshal(e.Details)
+		if err != nil {
+			return err
+		}
+		e.Details = json.RawMessage(raw)
+	}
+	hash, _, err := e.sum()
+	if err != nil {
+		return err
+	}
+	e.Hash = hash
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	h, _ := json.Marshal(head{Seq: e.Seq, Hash: e.Hash})
+	return os.WriteFile(l.path+".head", h, 0o600)
+}
+
+// lastEntry returns the final entry of the log f, or nil if it is empty.
+// It reads the file backwards from the end, so that appending stays cheap
+// however long the log grows.
+func lastEntry(f *os.File) (*Entry, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	var tail []byte
+	for pos := info.Size(); pos > 0; {
+		n := min(pos, 4096)
+		pos -= n
+		chunk := make([]byte, n)
+		if _, err := f.ReadAt(chunk, pos); err != nil {
+			return nil, err
+		}
+		tail = append(chunk, tail...)
+		line := bytes.TrimRight(tail, "\n")
+		i := bytes.LastIndexByte(line, '\n')
+		if i < 0 && pos > 0 {
+			continue
+		}
+		if line = line[i+1:]; len(line) == 0 {
+			return nil, nil
+		}
+		var e Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, fmt.Errorf("audit log %s is corrupt: %w", f.Name(), err)
+		}
+		return &e, nil
+	}
+	return nil, nil
+}
+
+// Verify checks the whole chain of the log at path and returns the number
+// of valid entries. The error describes the first problem found.
+func Verify(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var seq int64
+	prev := ""
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 64<<10), 16<<20)
+	for line := 1; s.Scan(); line++ {
+		// Details stay raw so that they are hashed as written.
+		var raw struct {
+			Entry
+			Details json.RawMessage `json:"details,omitempty"`
+		}
+		if err := json.Unmarshal(s.Bytes(), &raw); err != nil {
+			return seq, fmt.Errorf("line %d: not a valid entry: %w", line, err)
+		}
+		e := raw.Entry
+		if raw.Details != nil {
+			e.Details = raw.Details
+		}
+		if e.Seq != seq+1 {
+			return seq, fmt.Errorf("line %d: sequence %d follows %d; entries were removed or reordered", line, e.Seq, seq)
+		}
+		if e.Prev != prev {
+			return seq, fmt.Errorf("line %d: chain broken; previous hash does not match", line)
+		}
+		want, _, err := e.sum()
+		if err != nil {
+			return seq, err
+		}
+		if e.Hash != want {
+			return seq, fmt.Errorf("line %d: entry %d was modified", line, e.Seq)
+		}
+		seq, prev = e.Seq, e.Hash
+	}
+	if err := s.Err(); err != nil {
+		return seq, err
+	}
+
+	data, err := os.ReadFile(path + ".head")
+	if errors.Is(err, os.ErrNotExist) {
+		if seq == 0 {
+			return 0, nil
+		}
+		return seq, errors.New("head file is missing")
+	}
+	if err != nil {
+		return seq, err
+	}
+	var h head
+	if err := json.Unmarshal(data, &h); err != nil {
+		return seq, fmt.Errorf("head file is corrupt: %w", err)
+	}
+	if h.Seq != seq || h.Hash != prev {
+		return seq, fmt.Errorf("log ends at entry %d but %d entries were written; the log was truncated", seq, h.Seq)
+	}
+	return seq, nil
+}
@@ -0,0 +1,132 @@
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func writeLog(t *testing.T, n int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	for i := 0; i < n; i++ {
+		if err := l.Append(Entry{Event: EventProposal, Command: "ls"}); err != nil {
+			t.Fatalf("Append error: %v", err)
+		}
+	}
+	return path
+}
+
+func TestVerifyIntactLog(t *testing.T) {
+	path := writeLog(t, 3)
+
+	// Reopening continues the existing chain.
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Append(Entry{Event: EventDecision, Decision: Approved}); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := Verify(path)
+	if err != nil || n != 4 {
+		t.Fatalf("Verify = %d, %v", n, err)
+	}
+}
+
+func TestVerifyDetails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keys out of order, as Result.JSON writes them, and a map, which is
+	// encoded with sorted keys.
+	raw := json.RawMessage("{\n  \"stdout\": \"ok\",\n  \"exit_code\": 0,\n  \"cwd\": \"/tmp\"\n}")
+	for _, details := range []any{map[string]string{"sandbox": "none", "limits": "off"}, raw} {
+		if err := l.Append(Entry{Event: EventExecution, Command: "ls", Details: details}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := Verify(path); err != nil || n != 2 {
+		t.Fatalf("Verify = %d, %v", n, err)
+	}
+
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, []byte(strings.Replace(string(data), `"stdout":"ok"`, `"stdout":"no"`, 1)), 0o600)
+	if _, err := Verify(path); err == nil || !strings.Contains(err.Error(), "entry 2 was modified") {
+		t.Fatalf("expected a modified detail to be detected, got %v", err)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	path := writeLog(t, 3)
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, []byte(strings.Replace(string(data), `"command":"ls"`, `"command":"rm"`, 1)), 0o600)
+
+	if _, err := Verify(path); err == nil || !strings.Contains(err.Error(), "modified") {
+		t.Fatalf("expected modification to be detected, got %v", err)
+	}
+}
+
+func TestVerifyDetectsTruncation(t *testing.T) {
+	path := writeLog(t, 3)
+	data, _ := os.ReadFile(path)
+	lines := strings.SplitAfter(string(data), "\n")
+	os.WriteFile(path, []byte(strings.Join(lines[:2], "")), 0o600)
+
+	if _, err := Verify(path); err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Fatalf("expected truncation to be detected, got %v", err)
+	}
+
+	os.WriteFile(path, []byte(strings.Join(lines[1:], "")), 0o600)
+	if _, err := Verify(path); err == nil {
+		t.Fatal("expected removal of the first entry to be detected")
+	}
+}
+
+func TestTwoLogsShareTheChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	a, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Append(Entry{Event: EventProposal, Command: "ls"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Append(Entry{Event: EventProposal, Command: "pwd"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two sessions appending at the same time still form one chain.
+	var wg sync.WaitGroup
+	for _, l := range []*Log{a, b} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				if err := l.Append(Entry{Event: EventDecision, Decision: Approved}); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	n, err := Verify(path)
+	if err != nil || n != 52 {
+		t.Fatalf("Verify = %d, %v", n, err)
+	}
+}
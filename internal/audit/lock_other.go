@@ -0,0 +1,9 @@
+//go:build !unix
+
+package audit
+
+import "os"
+
+// lock is a no-op on platforms without flock; only the Log's own mutex
+// orders its appends there.
+func lock(f *os.File) error { return nil }
@@ -0,0 +1,202 @@
+// Package autopilot keeps track of an autonomous run, in which commands the
+// policy allows are executed without asking until the task is done or one
+// of the run's limits is reached.
+package autopilot
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits bound an autonomous run. Zero values are unlimited.
+type Limits struct {
+	// Steps is the number of commands that may be executed.
+	Steps int
+	// Time is the wall-clock time the run may take.
+	Time time.Duration
+	// Tokens is the estimated number of tokens sent to and received from
+	// the model.
+	Tokens int
+}
+
+// DefaultLimits returns the limits used when none are configured.
+func DefaultLimits() Limits {
+	return Limits{Steps: 20, Time: 15 * time.Minute, Tokens: 200_000}
+}
+
+// ParseLimits parses a space separated list of key=value pairs, such as
+// "steps=10 time=5m tokens=50000", on top of base.
+func ParseLimits(spec string, base Limits) (Limits, error) {
+	l := base
+	for _, field := range strings.Fields(spec) {
+		k, v, ok := strings.Cut(field, "=")
+		if !ok {
+			return base, fmt.Errorf("limit %q: expected key=value", field)
+		}
+		var err error
+		switch k {
+		case "steps":
+			l.Steps, err = strconv.Atoi(v)
+		case "time":
+			l.Time, err = time.ParseDuration(v)
+		case "tokens":
+			mult := 1
+			if n, ok := strings.CutSuffix(strings.ToLower(v), "k"); ok {
+				v, mult = n, 1000
+			}
+			l.Tokens, err = strconv.Atoi(v)
+			l.Tokens *= mult
+		default:
+			return base, fmt.Errorf("unknown limit %q", k)
+		}
+		if err != nil {
+			return base, fmt.Errorf("limit %s: %w", k, err)
+		}
+	}
+	return l, nil
+}
+
+// String formats the limits in the syntax accepted by ParseLimits.
+func (l Limits) String() string {
+	var parts []string
+	if l.Steps > 0 {
+		parts = append(parts, fmt.Sprintf("steps=%d", l.Steps))
+	}
+	if l.Time > 0 {
+		parts = append(parts, "time="+l.Time.String())
+	}
+	if l.Tokens > 0 {
+		parts = append(parts, fmt.Sprintf("tokens=%d", l.Tokens))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Step is one command executed during a run.
+type Step struct {
+	Command  string
+	ExitCode int
+	// Running is set until the command has finished.
+	Running bool
+}
+
+// Run is the state of one autonomous run.
+type Run struct {
+	Goal    string
+	Limits  Limits
+	Started time.Time
+	Steps   []Step
+	// Tokens is the estimated number of tokens used so far.
+	Tokens int
+	// Paused runs send every proposal to the approval dialog.
+	Paused bool
+	// Stopped gives the reason the run ended; it is empty while the run
+	// is active.
+	Stopped string
+}
+
+// New starts a run towards goal at now.
+func New(goal string, limits Limits, now time.Time) *Run {
+	return &Run{Goal: goal, Limits: limits, Started: now}
+}
+
+// Active reports whether the run has not stopped.
+func (r *Run) Active() bool {
+	return r != nil && r.Stopped == ""
+}
+
+// Stop ends the run for reason unless it has already ended.
+func (r *Run) Stop(reason string) {
+	if r.Stopped == "" {
+		r.Stopped = reason
+	}
+}
+
+// Check stops the run if its time or token limit has been reached and
+// reports whether it is still active.
+func (r *Run) Check(now time.Time) bool {
+	switch {
+	case !r.Active():
+	case r.Limits.Time > 0 && now.Sub(r.Started) >= r.Limits.Time:
+		r.Stop(fmt.Sprintf("time limit of %s reached", r.Limits.Time))
+	case r.Limits.Tokens > 0 && r.Tokens >= r.Limits.Tokens:
+		r.Stop(fmt.Sprintf("token limit of %d reached", r.Limits.Tokens))
+	}
+	return r.Active()
+}
+
+// CanStep reports whether another command may run within the step limit.
+func (r *Run) CanStep() bool {
+	return r.Limits.Steps <= 0 || len(r.Steps) < r.Limits.Steps
+}
+
+// Begin records that command started running.
+func (r *Run) Begin(command string) {
+	r.Steps = append(r.Steps, Step{Command: command, Running: true})
+}
+
+// End records the exit code of the running command.
+func (r *Run) End(exitCode int) {
+	if n := len(r.Steps); n > 0 && r.Steps[n-1].Running {
+		r.Steps[n-1].Running = false
+		r.Steps[n-1].ExitCode = exitCode
+	}
+}
+
+// AddTokens adds the estimated size of text to the tokens used.
+func (r *Run) AddTokens(text string) {
+	r.Tokens += EstimateTokens(text)
+}
+
+// EstimateTokens approximates the number of tokens in text at four bytes
+// per token, which is close for English and shell output.
+func EstimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// Status summarizes the run's progress against its limits on one line.
+func (r *Run) Status(now time.Time) string {
+	steps := strconv.Itoa(len(r.Steps))
+	if r.Limits.Steps > 0 {
+		steps += "/" + strconv.Itoa(r.Limits.Steps)
+	}
+	elapsed := now.Sub(r.Started).Truncate(time.Second).String()
+	if r.Limits.Time > 0 {
+		elapsed += "/" + r.Limits.Time.String()
+	}
+	tokens := "~" + formatTokens(r.Tokens)
+	if r.Limits.Tokens > 0 {
+		tokens += "/" + formatTokens(r.Limits.Tokens)
+	}
+	return fmt.Sprintf("step %s · %s · %s tokens", steps, elapsed, tokens)
+}
+
+func formatTokens(n int) string {
+	if n >= 1000 {
+		return fmt.Sprintf("%.1fk", float64(n)/1000)
+	}
+	return strconv.Itoa(n)
+}
+
+// Prompt returns the instructions that start an autonomous run.
+func Prompt(goal string) string {
+	return fmt.Sprintf(`Work on the following task autonomously: propose one command at a time and you will get its result back. Commands allowed by the user's policy run without confirmation; others are shown to the user. Stop proposing commands when the task is done and reply with a line starting with "%s" followed by a short summary. If you cannot make progress, explain why instead of proposing a command.
+
+Task: %s`, doneMarker, goal)
+}
+
+const doneMarker = "TASK COMPLETE:"
+
+var doneLine = regexp.MustCompile(`(?m)^\s*\**` + regexp.QuoteMeta(doneMarker) + `\**\s*(.*)$`)
+
+// Completed reports whether the model declared the task done in text and
+// returns its summary.
+func Completed(text string) (string, bool) {
+	m := doneLine.FindStringSubmatch(text)
+	if m == nil {
+		return "", false
+	}
+	return strings.TrimSpace(m[1]), true
+}
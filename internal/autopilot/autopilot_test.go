@@ -0,0 +1,82 @@
+package autopilot
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLimits(t *testing.T) {
+	l, err := ParseLimits("steps=5 tokens=50k", DefaultLimits())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Limits{Steps: 5, Time: 15 * time.Minute, Tokens: 50000}
+	if l != want {
+		t.Errorf("ParseLimits = %+v, want %+v", l, want)
+	}
+	if l.String() != "steps=5 time=15m0s tokens=50000" {
+		t.Errorf("String = %q", l.String())
+	}
+	for _, bad := range []string{"steps", "speed=3", "time=soon"} {
+		if _, err := ParseLimits(bad, Limits{}); err == nil {
+			t.Errorf("ParseLimits(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestRunLimits(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	r := New("build it", Limits{Steps: 2, Time: time.Minute, Tokens: 100}, start)
+
+	r.Begin("make")
+	r.End(0)
+	if !r.CanStep() {
+		t.Fatal("second step refused")
+	}
+	r.Begin("make test")
+	if r.CanStep() {
+		t.Fatal("third step allowed")
+	}
+	r.End(2)
+	if r.Steps[1].ExitCode != 2 || r.Steps[1].Running {
+		t.Errorf("step = %+v", r.Steps[1])
+	}
+
+	if !r.Check(start.Add(30 * time.Second)) {
+		t.Fatal("run stopped early")
+	}
+	if got := r.Status(start.Add(30 * time.Second)); got != "step 2/2 · 30s/1m0s · ~0/100 tokens" {
+		t.Errorf("Status = %q", got)
+	}
+	r.AddTokens(strings.Repeat("x", 400))
+	if r.Check(start.Add(31*time.Second)) || !strings.Contains(r.Stopped, "token limit") {
+		t.Errorf("token limit not enforced: %q", r.Stopped)
+	}
+	r.Stop("something else")
+	if !strings.Contains(r.Stopped, "token limit") {
+		t.Errorf("Stop replaced the first reason: %q", r.Stopped)
+	}
+
+	r = New("wait", Limits{Time: time.Minute}, start)
+	if r.Check(start.Add(time.Minute)) || !strings.Contains(r.Stopped, "time limit") {
+		t.Errorf("time limit not enforced: %q", r.Stopped)
+	}
+	var none *Run
+	if none.Active() {
+		t.Error("nil run is active")
+	}
+}
+
+func TestCompleted(t *testing.T) {
+	if _, ok := Completed("Running the tests next."); ok {
+		t.Error("completion without the marker")
+	}
+	summary, ok := Completed("All set.\n**TASK COMPLETE:** Installed Go 1.22 and built the project.\n")
+	if !ok || summary != "Installed Go 1.22 and built the project." {
+		t.Errorf("Completed = %q, %v", summary, ok)
+	}
+	if !strings.Contains(Prompt("install go"), doneMarker) {
+		t.Error("prompt does not tell the model how to finish")
+	}
+}
@@ -0,0 +1,291 @@
+// Package checkpoint snapshots the working directory before AI-proposed
+// commands run, so that their effect on files can be shown and undone.
+//
+// Snapshots are commits in a shadow git repository kept under the user's
+// cache directory; the project's own .git is never touched. Files matched
+// by the project's .gitignore are not captured. Only the most recent
+// snapshots are kept.
+package checkpoint
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// gitTimeout bounds each git invocation; a tree too large to snapshot in
+// this time is not checkpointed.
+const gitTimeout = 15 * time.Second
+
+// snapshotRefs is where the snapshots are recorded, one ref each, named so
+// that they sort oldest first.
+const snapshotRefs = "refs/checkpoints/"
+
+var (
+	// keepSnapshots is how many snapshots are kept. A command takes two,
+	// so undo reaches about half as many commands back.
+	keepSnapshots = 400
+	// pruneSlack is how many snapshots beyond keepSnapshots pile up before
+	// they are pruned, so that git gc runs only now and then.
+	pruneSlack = 100
+)
+
+// Checkpoint is the state of the working directory before a command.
+type Checkpoint struct {
+	ID      string
+	Command string
+	Time    time.Time
+}
+
+// Change is one file that differs between two states.
+type Change struct {
+	// Status is git's letter: A(dded), M(odified), D(eleted), T(ype).
+	Status string
+	Path   string
+}
+
+// Diff describes what changed between two states.
+type Diff struct {
+	Changes []Change
+	Stat    string
+	Patch   string
+}
+
+// Empty reports whether nothing changed.
+func (d Diff) Empty() bool {
+	return len(d.Changes) == 0
+}
+
+// Store keeps checkpoints of one directory.
+type Store struct {
+	dir    string
+	gitDir string
+}
+
+// DefaultDir returns $HOME/.cache/ai-shell/checkpoints.
+func DefaultDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ai-shell", "checkpoints")
+}
+
+// Open prepares the shadow repository for dir under cacheDir. Directories
+// that are too broad to snapshot, like / or the home directory, are
+// refused.
+func Open(dir, cacheDir string) (*Store, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	home, _ := os.UserHomeDir()
+	if dir == "/" || dir == home {
+		return nil, fmt.Errorf("checkpoints: refusing to snapshot %s; run ai-shell inside a project directory", dir)
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, errors.New("checkpoints: git is not installed")
+	}
+	sum := sha256.Sum256([]byte(dir))
+	s := &Store{dir: dir, gitDir: filepath.Join(cacheDir, hex.EncodeToString(sum[:8])+".git")}
+	if _, err := os.Stat(filepath.Join(s.gitDir, "HEAD")); err != nil {
+		if err := os.MkdirAll(s.gitDir, 0o700); err != nil {
+			return nil, err
+		}
+		if _, err := s.git(context.Background(), "init", "--quiet"); err != nil {
+			return nil, err
+		}
+		// The shadow repository must not run the project's hooks.
+		for _, kv := range [][2]string{{"core.hooksPath", "/dev/null"}, {"core.fsmonitor", "false"}, {"gc.auto", "0"}} {
+			if _, err := s.git(context.Background(), "config", kv[0], kv[1]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return s, nil
+}
+
+// Dir returns the directory being checkpointed.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// git runs git on the shadow repository with dir as its work tree.
+func (s *Store) git(ctx context.Context, args ...string) (string, error) {
+	return s.gitInput(ctx, "", args...)
+}
+
+// gitInput runs git like git, with input on its standard input.
+func (s *Store) gitInput(ctx context.Context, input string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = s.dir
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Env = append(os.Environ(),
+		"GIT_DIR="+s.gitDir,
+		"GIT_WORK_TREE="+s.dir,
+		"GIT_AUTHOR_NAME=ai-shell", "GIT_AUTHOR_EMAIL=ai-shell@localhost",
+		"GIT_COMMITTER_NAME=ai-shell", "GIT_COMMITTER_EMAIL=ai-shell@localhost",
+		"GIT_CONFIG_NOSYSTEM=1",
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("checkpoints: git %s timed out", args[0])
+		}
+		return "", fmt.Errorf("checkpoints: git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// snapshot commits the current state of the work tree and returns the
+// commit. The commits have no parents, so a pruned snapshot is not kept
+// alive by a newer one.
+func (s *Store) snapshot(ctx context.Context, message string) (string, error) {
+	if _, err := s.git(ctx, "add", "--all"); err != nil {
+		return "", err
+	}
+	tree, err := s.git(ctx, "write-tree")
+	if err != nil {
+		return "", err
+	}
+	commit, err := s.git(ctx, "commit-tree", strings.TrimSpace(tree), "-m", message)
+	if err != nil {
+		return "", err
+	}
+	commit = strings.TrimSpace(commit)
+	ref := fmt.Sprintf("%s%020d", snapshotRefs, time.Now().UnixNano())
+	if _, err := s.git(ctx, "update-ref", ref, commit); err != nil {
+		return "", err
+	}
+	// Pruning is housekeeping; a failure leaves the snapshots for next time.
+	s.prune(ctx)
+	return commit, nil
+}
+
+// prune deletes all but the newest keepSnapshots snapshots, and the
+// objects only they used, once pruneSlack more have piled up.
+func (s *Store) prune(ctx context.Context) error {
+	out, err := s.git(ctx, "for-each-ref", "--format=%(refname)", snapshotRefs)
+	if err != nil {
+		return err
+	}
+	refs := strings.Fields(out)
+	if len(refs) <= keepSnapshots+pruneSlack {
+		return nil
+	}
+	var del strings.Builder
+	for _, ref := range refs[:len(refs)-keepSnapshots] {
+		fmt.Fprintf(&del, "delete %s\n", ref)
+	}
+	if _, err := s.gitInput(ctx, del.String(), "update-ref", "--stdin"); err != nil {
+		return err
+	}
+	if _, err := s.git(ctx, "reflog", "expire", "--expire=now", "--all"); err != nil {
+		return err
+	}
+	_, err = s.git(ctx, "gc", "--prune=now", "--quiet")
+	return err
+}
+
+// Create snapshots the directory before command runs.
+func (s *Store) Create(ctx context.Context, command string) (Checkpoint, error) {
+	id, err := s.snapshot(ctx, "before: "+command)
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	return Checkpoint{ID: id, Command: command, Time: time.Now()}, nil
+}
+
+// Changes snapshots the directory again and reports what changed since cp.
+func (s *Store) Changes(ctx context.Context, cp Checkpoint) (Diff, error) {
+	now, err := s.snapshot(ctx, "after: "+cp.Command)
+	if err != nil {
+		return Diff{}, err
+	}
+	return s.diff(ctx, cp.ID, now)
+}
+
+// diff compares two snapshots.
+func (s *Store) diff(ctx context.Context, from, to string) (Diff, error) {
+	// With -z paths are neither quoted nor escaped, so they can be used
+	// as they are.
+	status, err := s.git(ctx, "diff", "-z", "--no-renames", "--name-status", from, to)
+	if err != nil {
+		return Diff{}, err
+	}
+	var d Diff
+	fields := strings.Split(strings.TrimSuffix(status, "\x00"), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		d.Changes = append(d.Changes, Change{Status: fields[i], Path: fields[i+1]})
+	}
+	if d.Empty() {
+		return d, nil
+	}
+	if d.Stat, err = s.git(ctx, "diff", "--no-renames", "--stat", from, to); err != nil {
+		return Diff{}, err
+	}
+	if d.Patch, err = s.git(ctx, "diff", "--no-renames", "--no-color", from, to); err != nil {
+		return Diff{}, err
+	}
+	return d, nil
+}
+
+// Restore puts the directory back into the state of cp: files changed or
+// deleted since are restored and files created since are removed. The
+// state before restoring is snapshotted first, and the returned Diff
+// describes what the restore changed.
+func (s *Store) Restore(ctx context.Context, cp Checkpoint) (Diff, error) {
+	now, err := s.snapshot(ctx, "before undo: "+cp.Command)
+	if err != nil {
+		return Diff{}, err
+	}
+	d, err := s.diff(ctx, now, cp.ID)
+	if err != nil || d.Empty() {
+		return d, err
+	}
+	restore := false
+	for _, c := range d.Changes {
+		if c.Status != "D" {
+			restore = true
+			continue
+		}
+		// Created after the checkpoint.
+		path := filepath.Join(s.dir, c.Path)
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return Diff{}, fmt.Errorf("checkpoints: %w", err)
+		}
+		s.removeEmptyParents(path)
+	}
+	if restore {
+		if _, err := s.git(ctx, "checkout", cp.ID, "--", "."); err != nil {
+			return Diff{}, err
+		}
+	}
+	// Record the restored state so the next checkpoint diffs against it.
+	if _, err := s.snapshot(ctx, "undo: "+cp.Command); err != nil {
+		return Diff{}, err
+	}
+	return d, nil
+}
+
+// removeEmptyParents removes the directories above path that are left
+// empty, up to the checkpointed directory.
+func (s *Store) removeEmptyParents(path string) {
+	for dir := filepath.Dir(path); dir != s.dir && strings.HasPrefix(dir, s.dir); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package checkpoint
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func write(t *testing.T, path, content string) {
+	t.Helper()
+	os.MkdirAll(filepath.Dir(path), 0o755)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckpointChangesAndRestore(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	ctx := context.Background()
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "keep.txt"), "original\n")
+	write(t, filepath.Join(dir, "doomed.txt"), "delete me\n")
+	write(t, filepath.Join(dir, ".gitignore"), "*.log\n")
+	write(t, filepath.Join(dir, "build.log"), "ignored\n")
+
+	s, err := Open(dir, t.TempDir())
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	cp, err := s.Create(ctx, "mangle")
+	if err != nil {
+		t.Fatalf("Create error: %v", err)
+	}
+
+	write(t, filepath.Join(dir, "keep.txt"), "mangled\n")
+	os.Remove(filepath.Join(dir, "doomed.txt"))
+	write(t, filepath.Join(dir, "new", "deep", "file.txt"), "new\n")
+
+	d, err := s.Changes(ctx, cp)
+	if err != nil {
+		t.Fatalf("Changes error: %v", err)
+	}
+	got := map[string]string{}
+	for _, c := range d.Changes {
+		got[c.Path] = c.Status
+	}
+	want := map[string]string{"keep.txt": "M", "doomed.txt": "D", "new/deep/file.txt": "A"}
+	if len(got) != len(want) {
+		t.Fatalf("changes = %v, want %v", got, want)
+	}
+	for path, status := range want {
+		if got[path] != status {
+			t.Errorf("%s: status %q, want %q", path, got[path], status)
+		}
+	}
+	if !strings.Contains(d.Patch, "-original") || !strings.Contains(d.Patch, "+mangled") {
+		t.Errorf("patch lacks the edit:\n%s", d.Patch)
+	}
+
+	if _, err := s.Restore(ctx, cp); err != nil {
+		t.Fatalf("Restore error: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "keep.txt")); string(data) != "original\n" {
+		t.Errorf("keep.txt = %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "doomed.txt")); err != nil {
+		t.Errorf("doomed.txt not restored: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new")); !os.IsNotExist(err) {
+		t.Errorf("created directory not removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "build.log")); err != nil {
+		t.Errorf("ignored file was touched: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git")); !os.IsNotExist(err) {
+		t.Errorf("project directory gained a .git: %v", err)
+	}
+}
+
+func TestOpenRefusesHome(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip(err)
+	}
+	if _, err := Open(home, t.TempDir()); err == nil {
+		t.Fatal("expected the home directory to be refused")
+	}
+}
+
+func TestRestoreNonASCIIPaths(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	ctx := context.Background()
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "ünï", "café.txt"), "original\n")
+
+	s, err := Open(dir, t.TempDir())
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	cp, err := s.Create(ctx, "mangle")
+	if err != nil {
+		t.Fatalf("Create error: %v", err)
+	}
+	write(t, filepath.Join(dir, "ünï", "café.txt"), "mangled\n")
+	write(t, filepath.Join(dir, "naïve dir", "new\tfile.txt"), "new\n")
+
+	d, err := s.Restore(ctx, cp)
+	if err != nil {
+		t.Fatalf("Restore error: %v", err)
+	}
+	want := map[string]string{"ünï/café.txt": "M", "naïve dir/new\tfile.txt": "D"}
+	if len(d.Changes) != len(want) {
+		t.Fatalf("changes = %v, want %v", d.Changes, want)
+	}
+	for _, c := range d.Changes {
+		if want[c.Path] != c.Status {
+			t.Errorf("%q: status %q, want %q", c.Path, c.Status, want[c.Path])
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "ünï", "café.txt")); string(data) != "original\n" {
+		t.Errorf("café.txt = %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "naïve dir")); !os.IsNotExist(err) {
+		t.Errorf("created directory not removed: %v", err)
+	}
+}
+
+func TestSnapshotsArePruned(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	defer func(keep, slack int) { keepSnapshots, pruneSlack = keep, slack }(keepSnapshots, pruneSlack)
+	keepSnapshots, pruneSlack = 2, 1
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	s, err := Open(dir, t.TempDir())
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	var ids []string
+	for i := range 4 {
+		write(t, filepath.Join(dir, "file.txt"), strings.Repeat("x", i+1))
+		cp, err := s.Create(ctx, "step")
+		if err != nil {
+			t.Fatalf("Create error: %v", err)
+		}
+		ids = append(ids, cp.ID)
+	}
+	refs, err := s.git(ctx, "for-each-ref", "--format=%(refname)", snapshotRefs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(strings.Fields(refs)); n != keepSnapshots {
+		t.Errorf("%d snapshots kept, want %d", n, keepSnapshots)
+	}
+	if _, err := s.git(ctx, "cat-file", "-e", ids[0]); err == nil {
+		t.Error("the oldest snapshot survived pruning")
+	}
+	if _, err := s.git(ctx, "cat-file", "-e", ids[3]); err != nil {
+		t.Errorf("the newest snapshot was pruned: %v", err)
+	}
+}
@@ -0,0 +1,452 @@
+package egress
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/jrcrittenden/ai-shell/internal/shell"
+)
+
+// client records the destinations and payloads of one network program
+// and reports whether the program sends what it reads on stdin.
+type client func(a *analyzer, name string, args []arg) (usesStdin bool)
+
+var clients = map[string]client{
+	"curl":       curl,
+	"wget":       wget,
+	"http":       httpie,
+	"https":      httpie,
+	"xh":         httpie,
+	"ssh":        ssh,
+	"scp":        copier,
+	"sftp":       sftp,
+	"rsync":      copier,
+	"nc":         netcat,
+	"ncat":       netcat,
+	"netcat":     netcat,
+	"telnet":     hostPort,
+	"ftp":        hostPort,
+	"socat":      socat,
+	"git":        git,
+	"dig":        lookup,
+	"nslookup":   lookup,
+	"host":       lookup,
+	"drill":      lookup,
+	"ping":       lookup,
+	"ping6":      lookup,
+	"traceroute": lookup,
+	"whois":      lookup,
+}
+
+// readers print the files named by their operands. The value lists the
+// options that take a separate argument.
+var (
+	readers = shell.Set("cat", "tac", "head", "tail", "base64", "base32", "xxd", "od", "hexdump",
+		"gzip", "bzip2", "xz", "zstd", "tar", "zip", "gpg", "openssl", "strings", "sort", "uniq", "cut", "jq")
+	readerOpts = map[string]map[string]bool{
+		"head":    shell.Set("-n", "-c"),
+		"tail":    shell.Set("-n", "-c"),
+		"tar":     shell.Set("-f", "--file", "-C", "--directory", "-T", "--exclude"),
+		"gpg":     shell.Set("-r", "--recipient", "-o", "--output"),
+		"openssl": shell.Set("-in", "-out", "-pass", "-k"),
+		"cut":     shell.Set("-d", "-f", "-c", "-b"),
+		"base64":  shell.Set("-w"),
+		"xxd":     shell.Set("-l", "-s", "-c"),
+		"od":      shell.Set("-t", "-N", "-j"),
+	}
+)
+
+// unwrap drops wrappers such as sudo and their options. It reports
+// whether xargs was among them.
+func unwrap(args []arg) ([]arg, bool) {
+	values := make([]string, len(args))
+	for i, w := range args {
+		values[i] = w.value
+	}
+	start, wrappers := shell.Unwrap(values)
+	xargs := false
+	for _, i := range wrappers {
+		xargs = xargs || filepath.Base(values[i]) == "xargs"
+	}
+	return args[start:], xargs
+}
+
+// option is one parsed command line option.
+type option struct {
+	name  string
+	value string
+}
+
+// parse splits args into options and operands. Options named in withValue
+// take the next argument unless it is attached, as in -dVALUE or
+// --data=VALUE.
+func parse(args []arg, withValue map[string]bool) (opts []option, operands []arg) {
+	for i := 0; i < len(args); i++ {
+		w := args[i].value
+		switch {
+		case w == "--":
+			return opts, append(operands, args[i+1:]...)
+		case strings.HasPrefix(w, "--"):
+			name, value, attached := strings.Cut(w, "=")
+			if !attached && withValue[name] && i+1 < len(args) {
+				i++
+				value = args[i].value
+			}
+			opts = append(opts, option{name, value})
+		case strings.HasPrefix(w, "-") && len(w) > 1:
+			name := w[:2]
+			switch {
+			case withValue[w]:
+				// Single-dash long options, e.g. openssl -in.
+				name = w
+				if i+1 < len(args) {
+					i++
+					opts = append(opts, option{name, args[i].value})
+					continue
+				}
+			case withValue[name] && len(w) > 2:
+				opts = append(opts, option{name, w[2:]})
+				continue
+			case withValue[name] && i+1 < len(args):
+				i++
+				opts = append(opts, option{name, args[i].value})
+				continue
+			case len(w) > 2:
+				name = w
+			}
+			opts = append(opts, option{name: name})
+		default:
+			operands = append(operands, args[i])
+		}
+	}
+	return opts, operands
+}
+
+// operands returns the arguments that are not options or their values.
+func operands(args []arg, withValue map[string]bool) []arg {
+	_, ops := parse(args, withValue)
+	var out []arg
+	for _, w := range ops {
+		if w.value != "-" {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+var curlValue = shell.Set("-d", "-F", "-T", "-H", "-o", "-u", "-X", "-A", "-e", "-x", "-b", "-c", "-K", "-w", "-m", "-r", "-E", "-U", "-Y", "-y", "-z", "-C", "-D", "-Q", "-t",
+	"--data", "--data-binary", "--data-raw", "--data-ascii", "--data-urlencode", "--json", "--form", "--form-string",
+	"--upload-file", "--header", "--output", "--user", "--request", "--user-agent", "--referer", "--proxy", "--cookie",
+	"--cookie-jar", "--config", "--write-out", "--max-time", "--connect-timeout", "--retry", "--url", "--resolve",
+	"--cacert", "--cert", "--key", "--range", "--output-dir", "--proxy-user", "--oauth2-bearer", "--unix-socket",
+	"--interface", "--dns-servers", "--doh-url", "--connect-to", "--limit-rate", "--max-filesize", "--retry-delay")
+
+func curl(a *analyzer, name string, args []arg) bool {
+	opts, ops := parse(args, curlValue)
+	usesStdin := false
+	for _, o := range opts {
+		switch o.name {
+		case "-d", "--data", "--data-binary", "--data-ascii", "--data-urlencode", "--json":
+			value := o.value
+			if o.name == "--data-urlencode" {
+				// name@file and name=content forms.
+				if i := strings.IndexAny(value, "=@"); i > 0 && value[i] == '@' {
+					value = value[i:]
+				}
+			}
+			usesStdin = a.curlData(value, name) || usesStdin
+		case "--data-raw", "--form-string":
+			a.payloads(a.dataOrEnv(o.value, name))
+		case "-F", "--form":
+			_, value, _ := strings.Cut(o.value, "=")
+			if strings.HasPrefix(value, "@") || strings.HasPrefix(value, "<") {
+				usesStdin = a.curlData("@"+strings.Split(value[1:], ";")[0], name) || usesStdin
+			} else {
+				a.payloads(a.dataOrEnv(value, name))
+			}
+		case "-T", "--upload-file":
+			if o.value == "-" || o.value == "." {
+				usesStdin = true
+			} else {
+				a.payload(a.file(o.value, name))
+			}
+		case "-u", "--user", "-H", "--header", "--oauth2-bearer", "-b", "--cookie":
+			for _, p := range a.dataOrEnv(o.value, name) {
+				if p.Kind == Env {
+					a.payload(p)
+				}
+			}
+		case "--url":
+			a.url(o.value, name)
+		}
+	}
+	for _, w := range ops {
+		a.url(w.value, name)
+	}
+	return usesStdin
+}
+
+// curlData records a curl data argument, where @file sends a file and @-
+// sends stdin.
+func (a *analyzer) curlData(value, program string) bool {
+	if file, ok := strings.CutPrefix(value, "@"); ok {
+		if file == "-" {
+			return true
+		}
+		a.payload(a.file(file, program))
+		return false
+	}
+	a.payloads(a.dataOrEnv(value, program))
+	return false
+}
+
+func (a *analyzer) payloads(ps []Payload) {
+	for _, p := range ps {
+		a.payload(p)
+	}
+}
+
+var wgetValue = shell.Set("-O", "-o", "-a", "-P", "-U", "-e", "-t", "-T", "-w", "-i", "-B", "-Q", "-l", "-D", "-X", "-I", "-A", "-R",
+	"--post-data", "--post-file", "--body-data", "--body-file", "--header", "--output-document", "--user", "--password", "--method")
+
+func wget(a *analyzer, name string, args []arg) bool {
+	opts, ops := parse(args, wgetValue)
+	for _, o := range opts {
+		switch o.name {
+		case "--post-file", "--body-file":
+			a.payload(a.file(o.value, name))
+		case "--post-data", "--body-data", "--header", "--user", "--password":
+			for _, p := range a.dataOrEnv(o.value, name) {
+				if p.Kind == Env || o.name == "--post-data" || o.name == "--body-data" {
+					a.payload(p)
+				}
+			}
+		}
+	}
+	for _, w := range ops {
+		a.url(w.value, name)
+	}
+	return false
+}
+
+// httpie handles http, https and xh: [METHOD] URL [ITEM...], where items
+// like field=@file or @file send files.
+func httpie(a *analyzer, name string, args []arg) bool {
+	_, ops := parse(args, shell.Set("-a", "--auth", "-o", "--output", "--session", "--verify", "--cert", "--cert-key", "--proxy"))
+	if len(ops) > 0 && strings.ToUpper(ops[0].value) == ops[0].value && !strings.ContainsAny(ops[0].value, ":/.") {
+		ops = ops[1:]
+	}
+	if len(ops) == 0 {
+		return false
+	}
+	target := ops[0].value
+	if strings.HasPrefix(target, ":") {
+		target = "localhost" + target
+	}
+	a.url(target, name)
+	for _, w := range ops[1:] {
+		if i := strings.Index(w.value, "@"); i >= 0 && (i == 0 || strings.ContainsAny(w.value[:i], "=:")) {
+			a.payload(a.file(strings.TrimLeft(w.value[i:], "@"), name))
+			continue
+		}
+		if _, value, ok := strings.Cut(w.value, "="); ok {
+			a.payloads(a.dataOrEnv(value, name))
+		}
+	}
+	return true
+}
+
+var sshValue = shell.Set("-b", "-c", "-D", "-E", "-e", "-F", "-I", "-i", "-J", "-L", "-l", "-m", "-O", "-o", "-p", "-Q", "-R", "-S", "-W", "-w")
+
+func ssh(a *analyzer, name string, args []arg) bool {
+	opts, ops := parse(args, sshValue)
+	port := ""
+	for _, o := range opts {
+		switch o.name {
+		case "-p":
+			port = o.value
+		case "-J":
+			for _, jump := range strings.Split(o.value, ",") {
+				a.sshHost(jump, "", name)
+			}
+		}
+	}
+	if len(ops) > 0 {
+		a.sshHost(ops[0].value, port, name)
+	}
+	return true
+}
+
+// sshHost records [user@]host[:port] or an ssh:// URL and reports whether
+// s was one.
+func (a *analyzer) sshHost(s, port, program string) bool {
+	if strings.Contains(s, "://") {
+		return a.url(s, program)
+	}
+	if _, h, ok := strings.Cut(s, "@"); ok {
+		s = h
+	}
+	if h, p, ok := strings.Cut(s, ":"); ok && port == "" && !strings.Contains(p, ":") {
+		s, port = h, p
+	}
+	a.dest(s, port, program)
+	return true
+}
+
+var copierValue = shell.Set("-c", "-F", "-i", "-J", "-l", "-o", "-P", "-S", "-e", "--rsh", "--exclude", "--include", "--files-from", "--port")
+
+// copier handles scp and rsync: when the last operand is remote, the other
+// local operands are uploaded.
+func copier(a *analyzer, name string, args []arg) bool {
+	_, ops := parse(args, copierValue)
+	if len(ops) < 2 {
+		return false
+	}
+	var local []arg
+	for _, w := range ops[:len(ops)-1] {
+		if !a.remote(w.value, name) {
+			local = append(local, w)
+		}
+	}
+	if a.remote(ops[len(ops)-1].value, name) {
+		for _, w := range local {
+			a.payload(a.file(w.value, name))
+		}
+	}
+	return false
+}
+
+func sftp(a *analyzer, name string, args []arg) bool {
+	opts, ops := parse(args, shell.Set("-B", "-b", "-c", "-D", "-F", "-i", "-J", "-l", "-o", "-P", "-R", "-S"))
+	port := ""
+	for _, o := range opts {
+		switch o.name {
+		case "-P":
+			port = o.value
+		case "-b":
+			if o.value != "-" {
+				a.payload(a.file(o.value, name))
+			}
+		}
+	}
+	if len(ops) > 0 {
+		host, _, _ := strings.Cut(ops[0].value, ":")
+		a.sshHost(host, port, name)
+	}
+	return true
+}
+
+var netcatValue = shell.Set("-p", "-s", "-w", "-i", "-q", "-x", "-X", "-O", "-I", "-T", "-e", "-c", "-P", "-m", "--proxy", "--exec", "--sh-exec")
+
+func netcat(a *analyzer, name string, args []arg) bool {
+	opts, ops := parse(args, netcatValue)
+	listen := ""
+	for _, o := range opts {
+		if strings.HasPrefix(o.name, "-") && !strings.HasPrefix(o.name, "--") && strings.Contains(o.name, "l") || o.name == "--listen" {
+			listen = "*"
+		}
+		if o.name == "-p" && listen != "" {
+			a.dest(listen, o.value, name)
+		}
+	}
+	switch {
+	case listen != "" && len(ops) > 0:
+		a.dest(listen, ops[len(ops)-1].value, name)
+	case listen != "":
+		// The port came with -p.
+	case len(ops) >= 2:
+		a.dest(ops[0].value, ops[1].value, name)
+	case len(ops) == 1:
+		a.dest(ops[0].value, "", name)
+	}
+	return true
+}
+
+func hostPort(a *analyzer, name string, args []arg) bool {
+	_, ops := parse(args, shell.Set("-l", "-n", "-b", "-e", "-X", "-P"))
+	switch {
+	case len(ops) >= 2:
+		a.dest(ops[0].value, ops[1].value, name)
+	case len(ops) == 1:
+		a.sshHost(ops[0].value, "", name)
+	}
+	return true
+}
+
+// socat connects two addresses, such as TCP:host:port and FILE:path.
+func socat(a *analyzer, name string, args []arg) bool {
+	_, ops := parse(args, shell.Set("-d", "-lf", "-t", "-T"))
+	usesStdin := false
+	for _, w := range ops {
+		if w.value == "-" {
+			usesStdin = true
+			continue
+		}
+		kind, rest, _ := strings.Cut(w.value, ":")
+		rest, _, _ = strings.Cut(rest, ",")
+		switch strings.ToUpper(kind) {
+		case "TCP", "TCP4", "TCP6", "UDP", "UDP4", "UDP6", "OPENSSL", "SSL", "SCTP", "DCCP":
+			if host, port, ok := strings.Cut(rest, ":"); ok {
+				a.dest(host, port, name)
+			} else {
+				a.dest("*", rest, name)
+			}
+		case "TCP-LISTEN", "TCP4-LISTEN", "TCP6-LISTEN", "UDP-LISTEN", "OPENSSL-LISTEN", "SSL-LISTEN":
+			a.dest("*", rest, name)
+		case "FILE", "OPEN", "GOPEN":
+			a.payload(a.file(rest, name))
+		case "STDIN", "STDIO":
+			usesStdin = true
+		case "EXEC", "SYSTEM":
+			a.payload(Payload{Kind: Output, Source: clip(rest), Program: name})
+		}
+	}
+	return usesStdin
+}
+
+// git handles commands that talk to a remote given as a URL; named remotes
+// are resolved by git and cannot be checked here.
+func git(a *analyzer, name string, args []arg) bool {
+	_, ops := parse(args, shell.Set("-C", "-c", "--git-dir", "--work-tree", "-b", "--branch", "--depth", "-o", "--origin"))
+	if len(ops) == 0 {
+		return false
+	}
+	sub := ops[0].value
+	switch sub {
+	case "push", "pull", "fetch", "clone", "ls-remote":
+	default:
+		return false
+	}
+	for _, w := range ops[1:] {
+		if strings.Contains(w.value, "://") || strings.Contains(w.value, "@") && strings.Contains(w.value, ":") {
+			host := w.value
+			if !strings.Contains(host, "://") {
+				// user@host:path
+				host, _, _ = strings.Cut(host, ":")
+			}
+			if a.sshHost(host, "", "git "+sub) && sub == "push" {
+				a.payload(Payload{Kind: Data, Source: "commits of the current repository", Program: "git push"})
+			}
+			break
+		}
+	}
+	return false
+}
+
+// lookup handles DNS and ICMP tools. Names built from variables or
+// command output can smuggle data out through DNS queries.
+func lookup(a *analyzer, name string, args []arg) bool {
+	_, ops := parse(args, shell.Set("-c", "-i", "-W", "-w", "-t", "-p", "-q", "-s", "-I", "-m", "-f", "-b", "-k", "-x", "-y", "-h", "-T", "-type", "-port"))
+	for _, w := range ops {
+		host := strings.TrimPrefix(w.value, "@")
+		if w.lit && (strings.HasPrefix(host, "+") || !strings.Contains(host, ".") && host != "localhost") {
+			// dig +short, record types such as MX.
+			continue
+		}
+		if host = strings.TrimSuffix(host, "."); host == "" {
+			continue
+		}
+		a.dest(host, "", name)
+	}
+	return false
+}
@@ -0,0 +1,494 @@
+// Package egress finds where a command line sends data over the network.
+//
+// Analyze recognizes the usual ways of moving data off a machine: HTTP
+// clients, ssh and its file copy tools, raw sockets through nc, socat or
+// bash's /dev/tcp, and DNS lookups whose names are built from command
+// output, also inside the scripts of sh -c and eval. For each it reports
+// the destination hosts and the local files, environment variables,
+// redacted secrets and command output that are sent along.
+package egress
+
+import (
+	"fmt"
+	"net"
+	neturl "net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/jrcrittenden/ai-shell/internal/shell"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// Destination is a host a command connects to.
+type Destination struct {
+	Host    string
+	Port    string
+	Program string
+	// Allowed reports whether the host is on the allow-list.
+	Allowed bool
+}
+
+func (d Destination) String() string {
+	host := d.Host
+	if d.Port != "" {
+		host = net.JoinHostPort(d.Host, d.Port)
+	}
+	return fmt.Sprintf("%s (%s)", host, d.Program)
+}
+
+// Payload kinds.
+const (
+	File   = "file"
+	Env    = "env"
+	Output = "output"
+	Data   = "data"
+	// Secret is a placeholder of a redacted secret, which is restored
+	// before the command runs.
+	Secret = "secret"
+)
+
+// Payload is local data a command sends to its destinations.
+type Payload struct {
+	Kind string
+	// Source is the path, variable name, command or literal data.
+	Source  string
+	Program string
+	// Sensitive marks credentials and keys, such as ~/.ssh or $AWS_SECRET.
+	Sensitive bool
+}
+
+func (p Payload) String() string {
+	s := map[string]string{
+		File:   "file " + p.Source,
+		Env:    "$" + p.Source,
+		Output: "output of " + p.Source,
+		Data:   "data " + p.Source,
+		Secret: "secret " + p.Source,
+	}[p.Kind]
+	if p.Sensitive {
+		s += " (sensitive)"
+	}
+	return s
+}
+
+// Report lists the destinations and payloads of a command line.
+type Report struct {
+	Destinations []Destination
+	Payloads     []Payload
+}
+
+// Network reports whether the command connects to the network.
+func (r Report) Network() bool {
+	return len(r.Destinations) > 0
+}
+
+// Unlisted returns the destinations that are not on the allow-list.
+func (r Report) Unlisted() []Destination {
+	var out []Destination
+	for _, d := range r.Destinations {
+		if !d.Allowed {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// Uploads reports whether local data is sent to a host that is not on the
+// allow-list.
+func (r Report) Uploads() bool {
+	return len(r.Payloads) > 0 && len(r.Unlisted()) > 0
+}
+
+// Sensitive reports whether a credential or key is among the payloads.
+func (r Report) Sensitive() bool {
+	for _, p := range r.Payloads {
+		if p.Sensitive {
+			return true
+		}
+	}
+	return false
+}
+
+// Options configure Analyze.
+type Options struct {
+	// Allow lists the hosts data may be sent to. "*.example.com" matches
+	// example.com and its subdomains; the loopback addresses are always
+	// allowed.
+	Allow []string
+}
+
+// Allowed reports whether host matches one of the patterns in allow.
+func Allowed(host string, allow []string) bool {
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	switch host {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	}
+	for _, pattern := range allow {
+		pattern = strings.ToLower(pattern)
+		if base, ok := strings.CutPrefix(pattern, "*."); ok && host == base {
+			return true
+		}
+		if ok, _ := path.Match(pattern, host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// sensitivePath matches credential stores, keys and secrets files.
+	sensitivePath = regexp.MustCompile(`(^|/)(\.ssh|\.aws|\.gnupg|\.kube|\.docker|\.netrc|\.pgpass|\.git-credentials|\.npmrc|\.pypirc|\.env[^/]*|id_[a-z0-9]+|[^/]*\.(pem|key|p12|pfx|kdbx)|shadow|credentials[^/]*|secrets?[^/]*)(/|$)`)
+	// sensitiveEnv matches environment variables that usually hold secrets.
+	sensitiveEnv = regexp.MustCompile(`(?i)(TOKEN|SECRET|PASSWORD|PASSWD|API_?KEY|ACCESS_?KEY|PRIVATE|CREDENTIAL|AUTH)`)
+	// envRef finds variable references in the source text of a word.
+	envRef = regexp.MustCompile(`\$\{?([A-Za-z_][A-Za-z0-9_]*)`)
+	// secretRef finds the placeholders of redacted secrets.
+	secretRef = regexp.MustCompile(`REDACTED_[A-Za-z0-9_]+`)
+	// tarBundle matches tar's old-style option bundle, e.g. czvf.
+	tarBundle = regexp.MustCompile(`^[AcdrtuxzjJavfpPkOSW]+$`)
+	// devNet matches bash's network redirection targets.
+	devNet = regexp.MustCompile(`^/dev/(tcp|udp)/([^/]+)/([^/]+)$`)
+)
+
+// Analyze parses command and reports its network destinations and the
+// local data it sends. Commands that cannot be parsed yield an empty
+// report; the risk analysis reports those.
+func Analyze(command string, opts Options) Report {
+	a := &analyzer{}
+	a.script(command, nil)
+	for i, d := range a.report.Destinations {
+		a.report.Destinations[i].Allowed = Allowed(d.Host, opts.Allow)
+	}
+	return a.report
+}
+
+type analyzer struct {
+	src   string
+	stdin map[*syntax.Stmt][]Payload
+	// input is what the whole script reads, for the script of sh -c or
+	// eval in a pipeline.
+	input  []Payload
+	report Report
+	// found is set when a destination is recorded, even one recorded
+	// before.
+	found bool
+}
+
+// script adds what the shell code src sends to the report. input is what
+// src reads on its standard input.
+func (a *analyzer) script(src string, input []Payload) {
+	f, err := syntax.NewParser().Parse(strings.NewReader(src), "")
+	if err != nil {
+		return
+	}
+	// The script's own source gives the offsets of its nodes.
+	sub := &analyzer{src: src, stdin: map[*syntax.Stmt][]Payload{}, input: input, report: a.report}
+	// Pipeline stages read the output of the stages before them.
+	syntax.Walk(f, func(node syntax.Node) bool {
+		if b, ok := node.(*syntax.BinaryCmd); ok && (b.Op == syntax.Pipe || b.Op == syntax.PipeAll) {
+			var upstream []Payload
+			for _, st := range shell.FlattenPipe(b) {
+				if _, seen := sub.stdin[st]; !seen {
+					sub.stdin[st] = append([]Payload(nil), upstream...)
+				}
+				upstream = append(upstream, sub.sources(st)...)
+			}
+		}
+		return true
+	})
+	syntax.Walk(f, func(node syntax.Node) bool {
+		if st, ok := node.(*syntax.Stmt); ok {
+			sub.stmt(st)
+		}
+		return true
+	})
+	a.report = sub.report
+	a.found = a.found || sub.found
+}
+
+// arg is a command argument: its literal value, or, if it is not a plain
+// literal, its text without quotes and with expansions as written.
+type arg struct {
+	value string
+	lit   bool
+}
+
+func (a *analyzer) text(n syntax.Node) string {
+	return a.src[n.Pos().Offset():n.End().Offset()]
+}
+
+// unquoted returns w without its quotes, keeping expansions as written:
+// "https://x/?k=$KEY" becomes https://x/?k=$KEY.
+func (a *analyzer) unquoted(w *syntax.Word) string {
+	var sb strings.Builder
+	var parts func([]syntax.WordPart, bool)
+	parts = func(ps []syntax.WordPart, quoted bool) {
+		for _, part := range ps {
+			switch p := part.(type) {
+			case *syntax.Lit:
+				sb.WriteString(shell.Unescape(p.Value, quoted))
+			case *syntax.SglQuoted:
+				sb.WriteString(p.Value)
+			case *syntax.DblQuoted:
+				parts(p.Parts, true)
+			default:
+				sb.WriteString(a.text(p))
+			}
+		}
+	}
+	parts(w.Parts, false)
+	return sb.String()
+}
+
+// words returns the arguments of call after wrappers such as sudo, and
+// whether xargs was among the wrappers.
+func (a *analyzer) words(call *syntax.CallExpr) ([]arg, bool) {
+	args := make([]arg, len(call.Args))
+	for i, w := range call.Args {
+		v, ok := shell.Literal(w)
+		if !ok {
+			v = a.unquoted(w)
+		}
+		args[i] = arg{v, ok}
+	}
+	return unwrap(args)
+}
+
+// stmt analyzes one statement: its command if that is a network client,
+// and any redirection to or from /dev/tcp or /dev/udp.
+func (a *analyzer) stmt(st *syntax.Stmt) {
+	var stdin []Payload
+	stdin = append(stdin, a.input...)
+	stdin = append(stdin, a.stdin[st]...)
+	stdin = append(stdin, a.inputs(st)...)
+
+	for _, r := range st.Redirs {
+		v, ok := shell.Literal(r.Word)
+		if !ok {
+			continue
+		}
+		m := devNet.FindStringSubmatch(v)
+		if m == nil {
+			continue
+		}
+		a.dest(m[2], m[3], "/dev/"+m[1])
+		switch r.Op {
+		case syntax.RdrOut, syntax.AppOut, syntax.ClbOut, syntax.RdrAll, syntax.AppAll, syntax.RdrInOut:
+			if st.Cmd != nil {
+				for _, p := range a.sources(&syntax.Stmt{Cmd: st.Cmd}) {
+					p.Program = "/dev/" + m[1]
+					a.payload(p)
+				}
+			}
+		}
+	}
+
+	call, ok := st.Cmd.(*syntax.CallExpr)
+	if !ok {
+		return
+	}
+	args, xargs := a.words(call)
+	if len(args) == 0 {
+		return
+	}
+	name := filepath.Base(args[0].value)
+	if src, ok := inlineScript(name, args[1:]); ok {
+		a.script(src, stdin)
+		return
+	}
+	handler, ok := clients[name]
+	if !ok {
+		return
+	}
+	a.found = false
+	usesStdin := handler(a, name, args[1:])
+	if !a.found {
+		return
+	}
+	for _, w := range args[1:] {
+		a.envs(name, w)
+		a.secrets(name, w.value)
+	}
+	// xargs passes what it reads as arguments.
+	if usesStdin || xargs {
+		for _, p := range stdin {
+			p.Program = name
+			a.payload(p)
+		}
+	}
+}
+
+// inputs returns what a statement's input redirections feed it.
+func (a *analyzer) inputs(st *syntax.Stmt) []Payload {
+	var out []Payload
+	for _, r := range st.Redirs {
+		switch r.Op {
+		case syntax.RdrIn:
+			if v, ok := shell.Literal(r.Word); ok && !devNet.MatchString(v) {
+				out = append(out, a.file(v, ""))
+			}
+		case syntax.WordHdoc:
+			out = append(out, a.dataOrEnv(a.text(r.Word), "")...)
+		case syntax.Hdoc, syntax.DashHdoc:
+			if r.Hdoc != nil {
+				out = append(out, a.dataOrEnv(a.text(r.Hdoc), "")...)
+			}
+		}
+	}
+	return out
+}
+
+// sources returns what a pipeline stage writes to its output: the files a
+// reader prints, the variables echo prints or the output of the command.
+func (a *analyzer) sources(st *syntax.Stmt) []Payload {
+	out := a.inputs(st)
+	call, ok := st.Cmd.(*syntax.CallExpr)
+	if !ok {
+		if st.Cmd != nil {
+			out = append(out, Payload{Kind: Output, Source: a.text(st.Cmd)})
+		}
+		return out
+	}
+	args, _ := a.words(call)
+	if len(args) == 0 {
+		// A wrapper on its own, such as env.
+		return append(out, Payload{Kind: Output, Source: a.text(call)})
+	}
+	name := filepath.Base(args[0].value)
+	switch {
+	case readers[name]:
+		args = args[1:]
+		if name == "tar" && len(args) > 0 && tarBundle.MatchString(args[0].value) {
+			// Old-style options: tar czf archive.tgz dir.
+			skip := 1
+			if strings.Contains(args[0].value, "f") {
+				skip = 2
+			}
+			args = args[min(skip, len(args)):]
+		}
+		for _, w := range operands(args, readerOpts[name]) {
+			out = append(out, a.file(w.value, ""))
+		}
+	case name == "echo" || name == "printf":
+		for _, w := range args[1:] {
+			out = append(out, a.dataOrEnv(w.value, "")...)
+		}
+	default:
+		out = append(out, Payload{Kind: Output, Source: a.text(call)})
+	}
+	return out
+}
+
+// dataOrEnv describes literal text sent by a command: the variables and
+// redacted secrets it contains, or the text itself.
+func (a *analyzer) dataOrEnv(text, program string) []Payload {
+	var out []Payload
+	for _, m := range envRef.FindAllStringSubmatch(text, -1) {
+		out = append(out, Payload{Kind: Env, Source: m[1], Program: program, Sensitive: sensitiveEnv.MatchString(m[1])})
+	}
+	for _, name := range secretRef.FindAllString(text, -1) {
+		out = append(out, Payload{Kind: Secret, Source: name, Program: program, Sensitive: true})
+	}
+	if out == nil && strings.TrimSpace(text) != "" {
+		out = append(out, Payload{Kind: Data, Source: clip(text), Program: program})
+	}
+	return out
+}
+
+// envs reports the variables expanded in a network client's arguments.
+func (a *analyzer) envs(program string, w arg) {
+	if w.lit {
+		return
+	}
+	for _, m := range envRef.FindAllStringSubmatch(w.value, -1) {
+		a.payload(Payload{Kind: Env, Source: m[1], Program: program, Sensitive: sensitiveEnv.MatchString(m[1])})
+	}
+	if strings.Contains(w.value, "$(") || strings.Contains(w.value, "`") {
+		a.payload(Payload{Kind: Output, Source: clip(w.value), Program: program})
+	}
+}
+
+// secrets reports the redacted secrets in a network client's argument.
+// Their placeholders are replaced by the secrets before the command runs.
+func (a *analyzer) secrets(program, value string) {
+	for _, name := range secretRef.FindAllString(value, -1) {
+		a.payload(Payload{Kind: Secret, Source: name, Program: program, Sensitive: true})
+	}
+}
+
+// inlineScript returns the shell code that name runs from its arguments:
+// the script of sh -c or the arguments of eval.
+func inlineScript(name string, args []arg) (string, bool) {
+	values := make([]string, len(args))
+	for i, w := range args {
+		values[i] = w.value
+	}
+	i, j, ok := shell.Script(name, values)
+	return strings.Join(values[i:j], " "), ok
+}
+
+func (a *analyzer) file(p, program string) Payload {
+	return Payload{Kind: File, Source: p, Program: program, Sensitive: sensitivePath.MatchString(p)}
+}
+
+func (a *analyzer) dest(host, port, program string) {
+	a.found = true
+	for _, d := range a.report.Destinations {
+		if d.Host == host && d.Port == port && d.Program == program {
+			return
+		}
+	}
+	a.report.Destinations = append(a.report.Destinations, Destination{Host: host, Port: port, Program: program})
+}
+
+func (a *analyzer) payload(p Payload) {
+	for _, q := range a.report.Payloads {
+		if q == p {
+			return
+		}
+	}
+	a.report.Payloads = append(a.report.Payloads, p)
+}
+
+// url records the destination of a URL or bare host[:port][/path] and
+// reports whether s was one.
+func (a *analyzer) url(s, program string) bool {
+	if !strings.Contains(s, "://") {
+		s = "//" + s
+	}
+	u, err := neturl.Parse(s)
+	if err != nil || u.Hostname() == "" {
+		return false
+	}
+	a.dest(u.Hostname(), u.Port(), program)
+	return true
+}
+
+// remote records the host of an scp-style user@host:path argument and
+// reports whether w is one.
+func (a *analyzer) remote(w, program string) bool {
+	if strings.Contains(w, "://") {
+		a.url(w, program)
+		return true
+	}
+	host, _, ok := strings.Cut(w, ":")
+	if !ok || host == "" || strings.Contains(host, "/") {
+		return false
+	}
+	if _, h, ok := strings.Cut(host, "@"); ok {
+		host = h
+	}
+	a.dest(strings.Trim(host, "[]"), "", program)
+	return true
+}
+
+func clip(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > 40 {
+		return string(r[:40]) + "…"
+	}
+	return s
+}
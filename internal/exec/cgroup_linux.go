@@ -0,0 +1,223 @@
+package exec
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// cgroupControllers are the controllers the command cgroups need.
+var cgroupControllers = []string{"memory", "pids"}
+
+var (
+	cgroupOnce sync.Once
+	cgroupRoot string
+	cgroupErr  error
+	cgroupSeq  atomic.Int64
+)
+
+// commandCgroups returns the cgroup v2 directory the commands' cgroups are
+// created in, setting it up on first use.
+func commandCgroups() (string, error) {
+	cgroupOnce.Do(func() { cgroupRoot, cgroupErr = setupCgroups() })
+	return cgroupRoot, cgroupErr
+}
+
+// setupCgroups prepares the delegated cgroup ai-shell runs in. Under
+// cgroup v2 a cgroup that enables controllers for its children may not
+// hold processes itself, so ai-shell moves into a leaf of its own and
+// creates a sibling subtree for the commands:
+//
+//	<own>/ai-shell          ai-shell itself
+//	<own>/ai-shell-<pid>/N  one cgroup per command
+func setupCgroups() (string, error) {
+	own, err := ownCgroup()
+	if err != nil {
+		return "", err
+	}
+	available, err := readFields(filepath.Join(own, "cgroup.controllers"))
+	if err != nil {
+		return "", err
+	}
+	for _, c := range cgroupControllers {
+		if !slices.Contains(available, c) {
+			return "", fmt.Errorf("the %s controller is not delegated to %s", c, own)
+		}
+	}
+	enable := "+" + strings.Join(cgroupControllers, " +")
+	enabled, err := readFields(filepath.Join(own, "cgroup.subtree_control"))
+	if err != nil {
+		return "", err
+	}
+	if !containsAll(enabled, cgroupControllers) {
+		procs, err := readFields(filepath.Join(own, "cgroup.procs"))
+		if err != nil {
+			return "", err
+		}
+		self := strconv.Itoa(os.Getpid())
+		for _, pid := range procs {
+			if pid != self {
+				return "", fmt.Errorf("%s holds other processes than ai-shell; start it in a cgroup of its own, e.g. with systemd-run --user --scope -p Delegate=yes", own)
+			}
+		}
+		leaf := filepath.Join(own, "ai-shell")
+		if err := os.Mkdir(leaf, 0o755); err != nil && !errors.Is(err, os.ErrExist) {
+			return "", err
+		}
+		if err := writeCgroup(leaf, "cgroup.procs", self); err != nil {
+			return "", err
+		}
+		if err := writeCgroup(own, "cgroup.subtree_control", enable); err != nil {
+			return "", err
+		}
+	}
+	root := filepath.Join(own, fmt.Sprintf("ai-shell-%d", os.Getpid()))
+	if err := os.Mkdir(root, 0o755); err != nil && !errors.Is(err, os.ErrExist) {
+		return "", err
+	}
+	if err := writeCgroup(root, "cgroup.subtree_control", enable); err != nil {
+		os.Remove(root)
+		return "", err
+	}
+	return root, nil
+}
+
+// ownCgroup returns the cgroup v2 directory of the current process.
+func ownCgroup() (string, error) {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if rel, ok := strings.CutPrefix(line, "0::"); ok {
+			dir := filepath.Join("/sys/fs/cgroup", rel)
+			if _, err := os.Stat(filepath.Join(dir, "cgroup.controllers")); err != nil {
+				return "", errors.New("the cgroup v2 hierarchy is not mounted at /sys/fs/cgroup")
+			}
+			return dir, nil
+		}
+	}
+	return "", errors.New("not running under cgroup v2")
+}
+
+func readFields(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(data)), nil
+}
+
+func containsAll(have, want []string) bool {
+	for _, w := range want {
+		if !slices.Contains(have, w) {
+			return false
+		}
+	}
+	return true
+}
+
+func writeCgroup(dir, file, value string) error {
+	return os.WriteFile(filepath.Join(dir, file), []byte(value), 0o644)
+}
+
+// cgroup is a transient cgroup v2 holding a single command.
+type cgroup struct {
+	path string
+	fd   int
+}
+
+// newCgroup creates a cgroup enforcing the memory and process limits of
+// the whole command. It returns nil if there is nothing to enforce, and an
+// error if cgroups are not delegated to ai-shell.
+func newCgroup(l Limits) (*cgroup, error) {
+	if l.Memory == 0 && l.Procs == 0 {
+		return nil, nil
+	}
+	root, err := commandCgroups()
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(root, strconv.FormatInt(cgroupSeq.Add(1), 10))
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		return nil, err
+	}
+	c := &cgroup{path: dir, fd: -1}
+	if l.Memory > 0 {
+		if err := writeCgroup(dir, "memory.max", strconv.FormatInt(l.Memory, 10)); err != nil {
+			c.remove()
+			return nil, err
+		}
+		// Swapping out would let the command exceed the limit.
+		writeCgroup(dir, "memory.swap.max", "0")
+	}
+	if l.Procs > 0 {
+		if err := writeCgroup(dir, "pids.max", strconv.Itoa(l.Procs)); err != nil {
+			c.remove()
+			return nil, err
+		}
+	}
+	fd, err := unix.Open(dir, unix.O_DIRECTORY|unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		c.remove()
+		return nil, err
+	}
+	c.fd = fd
+	return c, nil
+}
+
+// attach makes cmd start inside the cgroup.
+func (c *cgroup) attach(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = c.fd
+}
+
+// exceeded reports which limit the cgroup enforced, if any, from its event
+// counters.
+func (c *cgroup) exceeded() string {
+	if eventCount(filepath.Join(c.path, "memory.events"), "oom_kill") > 0 {
+		return LimitMemory
+	}
+	if eventCount(filepath.Join(c.path, "pids.events"), "max") > 0 {
+		return LimitProcs
+	}
+	return ""
+}
+
+// remove deletes the cgroup once its processes have exited.
+func (c *cgroup) remove() {
+	if c.fd >= 0 {
+		unix.Close(c.fd)
+	}
+	os.Remove(c.path)
+}
+
+func eventCount(path, key string) int {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if k, v, ok := strings.Cut(s.Text(), " "); ok && k == key {
+			n, _ := strconv.Atoi(v)
+			return n
+		}
+	}
+	return 0
+}
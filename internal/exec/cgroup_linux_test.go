@@ -0,0 +1,38 @@
+package exec
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCgroupLimits(t *testing.T) {
+	l := Limits{Memory: 32 << 20, Procs: 64}
+	if _, err := commandCgroups(); err != nil {
+		// Without a delegated cgroup the limits fall back to rlimits and
+		// the result says so.
+		res := runWithLimits(t, "ulimit -v", l)
+		if res.Stdout != "32768\n" {
+			t.Fatalf("unexpected limit: %q %q", res.Stdout, res.Stderr)
+		}
+		if len(res.Warnings) != 1 || !strings.Contains(res.Warnings[0], "rlimits") {
+			t.Fatalf("warnings = %q", res.Warnings)
+		}
+		t.Skipf("cgroups not delegated: %v", err)
+	}
+
+	res := runWithLimits(t, "ulimit -v; cat /proc/self/cgroup", l)
+	if !strings.HasPrefix(res.Stdout, "unlimited\n0::/") || len(res.Warnings) != 0 {
+		t.Fatalf("unexpected result: %q %q %q", res.Stdout, res.Stderr, res.Warnings)
+	}
+	dir := filepath.Join("/sys/fs/cgroup", strings.TrimSpace(strings.TrimPrefix(strings.Split(res.Stdout, "\n")[1], "0::")))
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("cgroup %s left behind: %v", dir, err)
+	}
+
+	res = runWithLimits(t, `x=$(head -c 200000000 /dev/zero | tr '\0' x); echo ${#x}`, l)
+	if res.LimitExceeded != LimitMemory {
+		t.Fatalf("LimitExceeded = %q (%s)", res.LimitExceeded, res.Badge())
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+
+package exec
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// cgroup is unavailable outside Linux; limits fall back to rlimits.
+type cgroup struct{}
+
+func newCgroup(l Limits) (*cgroup, error) {
+	if l.Memory == 0 && l.Procs == 0 {
+		return nil, nil
+	}
+	return nil, errors.New("cgroups are only available on Linux")
+}
+
+func (c *cgroup) attach(cmd *exec.Cmd) {}
+
+func (c *cgroup) exceeded() string { return "" }
+
+func (c *cgroup) remove() {}
@@ -0,0 +1,176 @@
+package exec
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits bound the resources an approved command may use. Zero fields are
+// unlimited.
+type Limits struct {
+	// Timeout is the wall-clock time after which the command is killed.
+	Timeout time.Duration
+	// CPU is the CPU time the command may consume (RLIMIT_CPU).
+	CPU time.Duration
+	// Memory caps the memory of the whole command in bytes through a
+	// cgroup, or the address space of each process (RLIMIT_AS) where
+	// cgroups are not delegated to ai-shell.
+	Memory int64
+	// OpenFiles caps the number of open file descriptors (RLIMIT_NOFILE).
+	OpenFiles int
+	// Procs caps the number of processes of the command through a
+	// cgroup, or else through RLIMIT_NPROC, which counts every process of
+	// the user.
+	Procs int
+	// Output is the number of output bytes after which the command is
+	// killed.
+	Output int64
+}
+
+// Kinds of limit reported in Result.LimitExceeded.
+const (
+	LimitTimeout   = "timeout"
+	LimitCPU       = "cpu"
+	LimitMemory    = "memory"
+	LimitOpenFiles = "open_files"
+	LimitProcs     = "procs"
+	LimitOutput    = "output"
+)
+
+// ParseLimits parses a space separated list of key=value settings such as
+// "timeout=30s cpu=10s mem=512M files=256 procs=64 output=10M" on top of base.
+// A value of 0 removes the limit.
+func ParseLimits(spec string, base Limits) (Limits, error) {
+	l := base
+	for _, field := range strings.Fields(spec) {
+		k, v, ok := strings.Cut(field, "=")
+		if !ok {
+			return base, fmt.Errorf("limit %q: expected key=value", field)
+		}
+		var err error
+		switch k {
+		case "timeout":
+			l.Timeout, err = parseDuration(v)
+		case "cpu":
+			l.CPU, err = parseDuration(v)
+		case "mem", "memory":
+			l.Memory, err = parseSize(v)
+		case "files":
+			l.OpenFiles, err = strconv.Atoi(v)
+		case "procs":
+			l.Procs, err = strconv.Atoi(v)
+		case "output":
+			l.Output, err = parseSize(v)
+		default:
+			return base, fmt.Errorf("unknown limit %q", k)
+		}
+		if err != nil {
+			return base, fmt.Errorf("limit %s: %w", k, err)
+		}
+	}
+	return l, nil
+}
+
+// String formats the limits in the syntax accepted by ParseLimits.
+func (l Limits) String() string {
+	var parts []string
+	if l.Timeout > 0 {
+		parts = append(parts, "timeout="+formatLimitDuration(l.Timeout))
+	}
+	if l.CPU > 0 {
+		parts = append(parts, "cpu="+formatLimitDuration(l.CPU))
+	}
+	if l.Memory > 0 {
+		parts = append(parts, "mem="+formatSize(l.Memory))
+	}
+	if l.OpenFiles > 0 {
+		parts = append(parts, fmt.Sprintf("files=%d", l.OpenFiles))
+	}
+	if l.Procs > 0 {
+		parts = append(parts, fmt.Sprintf("procs=%d", l.Procs))
+	}
+	if l.Output > 0 {
+		parts = append(parts, "output="+formatSize(l.Output))
+	}
+	return strings.Join(parts, " ")
+}
+
+// ulimitPrologue returns shell commands that apply the rlimit-based limits,
+// or "" if there are none. cgroup is true when a cgroup already enforces
+// the memory and process limits.
+func (l Limits) ulimitPrologue(cgroup bool) string {
+	// One ulimit per setting: given -S and -H together, bash applies both
+	// to every limit of the call.
+	var cmds []string
+	if l.CPU > 0 {
+		secs := int64((l.CPU + time.Second - 1) / time.Second)
+		// The soft limit delivers SIGXCPU; the hard limit one second
+		// later kills commands that ignore it.
+		cmds = append(cmds, fmt.Sprintf("ulimit -St %d", secs), fmt.Sprintf("ulimit -Ht %d", secs+1))
+	}
+	if l.Memory > 0 && !cgroup {
+		cmds = append(cmds, fmt.Sprintf("ulimit -v %d", (l.Memory+1023)/1024))
+	}
+	if l.OpenFiles > 0 {
+		cmds = append(cmds, fmt.Sprintf("ulimit -n %d", l.OpenFiles))
+	}
+	if l.Procs > 0 && !cgroup {
+		cmds = append(cmds, fmt.Sprintf("ulimit -u %d", l.Procs))
+	}
+	if len(cmds) == 0 {
+		return ""
+	}
+	return "{ " + strings.Join(cmds, " && ") + `; } || exit 126`
+}
+
+func parseDuration(v string) (time.Duration, error) {
+	if n, err := strconv.Atoi(v); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	return time.ParseDuration(v)
+}
+
+func parseSize(v string) (int64, error) {
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(v, "K"):
+		mult = 1 << 10
+	case strings.HasSuffix(v, "M"):
+		mult = 1 << 20
+	case strings.HasSuffix(v, "G"):
+		mult = 1 << 30
+	}
+	if mult > 1 {
+		v = v[:len(v)-1]
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * mult, nil
+}
+
+func formatSize(n int64) string {
+	for _, u := range []struct {
+		suffix string
+		size   int64
+	}{{"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}} {
+		if n%u.size == 0 {
+			return fmt.Sprintf("%d%s", n/u.size, u.suffix)
+		}
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+func formatLimitDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
@@ -0,0 +1,70 @@
+package exec
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func runWithLimits(t *testing.T, command string, l Limits) Result {
+	t.Helper()
+	p, err := Start(context.Background(), command, Options{Limits: l})
+	if err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+	for range p.Output() {
+	}
+	return p.Result()
+}
+
+func TestParseLimits(t *testing.T) {
+	l, err := ParseLimits("timeout=30s cpu=10 mem=512M files=256 procs=64 output=10M", Limits{})
+	if err != nil {
+		t.Fatalf("ParseLimits error: %v", err)
+	}
+	want := Limits{
+		Timeout:   30 * time.Second,
+		CPU:       10 * time.Second,
+		Memory:    512 << 20,
+		OpenFiles: 256,
+		Procs:     64,
+		Output:    10 << 20,
+	}
+	if l != want {
+		t.Fatalf("ParseLimits = %+v", l)
+	}
+	if got := l.String(); got != "timeout=30s cpu=10s mem=512M files=256 procs=64 output=10M" {
+		t.Fatalf("String = %q", got)
+	}
+	if _, err := ParseLimits("disk=1G", Limits{}); err == nil {
+		t.Fatal("expected unknown limit to fail")
+	}
+}
+
+func TestTimeoutLimit(t *testing.T) {
+	res := runWithLimits(t, "sleep 10", Limits{Timeout: 100 * time.Millisecond})
+	if res.LimitExceeded != LimitTimeout || res.Success() {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if !strings.HasSuffix(res.Badge(), "(timeout limit)") {
+		t.Fatalf("unexpected badge: %q", res.Badge())
+	}
+}
+
+func TestOutputLimit(t *testing.T) {
+	res := runWithLimits(t, "yes", Limits{Output: 1 << 10})
+	if res.LimitExceeded != LimitOutput {
+		t.Fatalf("unexpected result: %+v", res.LimitExceeded)
+	}
+}
+
+func TestRlimitsApplied(t *testing.T) {
+	res := runWithLimits(t, "ulimit -n; ulimit -St; ulimit -Ht", Limits{OpenFiles: 64, CPU: 10 * time.Second})
+	if res.Stdout != "64\n10\n11\n" {
+		t.Fatalf("unexpected limits: %q %q", res.Stdout, res.Stderr)
+	}
+	if len(res.Warnings) != 0 {
+		t.Fatalf("unexpected warnings: %q", res.Warnings)
+	}
+}
@@ -0,0 +1,33 @@
+//go:build !unix
+
+package exec
+
+import (
+	"os"
+	"os/exec"
+)
+
+var (
+	sigInt  = os.Interrupt
+	sigKill = os.Kill
+)
+
+// setProcessGroup is a no-op on platforms without process groups.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// signalGroup delivers sig to the command. Platforms that cannot deliver an
+// interrupt fall back to killing the process.
+func signalGroup(cmd *exec.Cmd, sig os.Signal) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	if err := cmd.Process.Signal(sig); err != nil {
+		return cmd.Process.Kill()
+	}
+	return nil
+}
+
+// exitSignal always reports a normal exit on platforms without signals.
+func exitSignal(ps *os.ProcessState) (string, int) {
+	return "", 0
+}
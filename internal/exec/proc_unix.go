@@ -0,0 +1,43 @@
+//go:build unix
+
+package exec
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+var (
+	sigInt  os.Signal = syscall.SIGINT
+	sigKill os.Signal = syscall.SIGKILL
+)
+
+// setProcessGroup places the command in a new process group so that signals
+// reach every process it spawns.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// signalGroup delivers sig to the command's process group.
+func signalGroup(cmd *exec.Cmd, sig os.Signal) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return syscall.Kill(-cmd.Process.Pid, sig.(syscall.Signal))
+}
+
+// exitSignal returns the name and number of the signal that terminated the
+// process, or an empty name if it exited normally.
+func exitSignal(ps *os.ProcessState) (string, int) {
+	ws, ok := ps.Sys().(syscall.WaitStatus)
+	if !ok || !ws.Signaled() {
+		return "", 0
+	}
+	return unix.SignalName(ws.Signal()), int(ws.Signal())
+}
@@ -0,0 +1,343 @@
+package exec
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// maxCapture is the number of bytes retained per output stream. Output past
+// this point is still streamed but not kept in the Result.
+const maxCapture = 1 << 20
+
+// Stream identifies which output stream a line of command output came from.
+type Stream int
+
+const (
+	Stdout Stream = iota
+	Stderr
+)
+
+// Output is a single line of output produced by a running command.
+type Output struct {
+	Stream Stream
+	Line   string
+}
+
+// Process is a command started with Start. Its output is delivered line by
+// line on the channel returned by Output while it runs.
+type Process struct {
+	command string
+	dir     string
+	cmd     *exec.Cmd
+	start   time.Time
+	out     chan Output
+	done    chan struct{}
+	err     error
+	result  Result
+	// sandboxErrs is the read end of the sandbox helper's error pipe and
+	// sandboxErr what was read from it.
+	sandboxErrs *os.File
+	sandboxErr  error
+
+	limits Limits
+	cgroup *cgroup
+	// warnings are added to the result.
+	warnings []string
+
+	mu          sync.Mutex
+	streams     [2]capture
+	written     int64
+	interrupted bool
+	exceeded    string
+}
+
+// capture accumulates one output stream up to maxCapture bytes.
+type capture struct {
+	buf       strings.Builder
+	truncated bool
+}
+
+func (c *capture) write(s string) {
+	if room := maxCapture - c.buf.Len(); len(s) > room {
+		// Cut before a character that does not fit rather than through
+		// it, so that the capture stays valid UTF-8.
+		for i := room; i > max(room-utf8.UTFMax, 0); i-- {
+			if utf8.RuneStart(s[i]) {
+				room = i
+				break
+			}
+		}
+		s = s[:room]
+		c.truncated = true
+	}
+	c.buf.WriteString(s)
+}
+
+// Options control how Start runs a command.
+type Options struct {
+	// Sandbox isolates the command; the zero Profile disables isolation.
+	Sandbox Profile
+	// Limits bound the resources the command may use.
+	Limits Limits
+}
+
+// shellCommand builds the bash invocation for command. rlimits are applied
+// by a ulimit prologue in an outer shell that then execs the command. For a
+// sandboxed command it also returns the read end of the pipe the sandbox
+// helper reports setup errors on.
+func shellCommand(ctx context.Context, command string, opts Options, cg *cgroup) (*exec.Cmd, *os.File, error) {
+	argv := []string{"bash", "-c", command}
+	if prologue := opts.Limits.ulimitPrologue(cg != nil); prologue != "" {
+		argv = []string{"bash", "-c", prologue + `; exec bash -c "$1"`, "ai-shell", command}
+	}
+	if !opts.Sandbox.Enabled() {
+		return exec.CommandContext(ctx, argv[0], argv[1:]...), nil, nil
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	cmd, err := sandboxCommand(ctx, opts.Sandbox, w, argv...)
+	if err != nil {
+		r.Close()
+		w.Close()
+		return nil, nil, err
+	}
+	return cmd, r, nil
+}
+
+// Start runs command through the system shell in its own process group and
+// returns immediately. Callers must drain Output until it is closed. The
+// memory and process limits hold for the whole command in a cgroup of its
+// own; where ai-shell has no delegated cgroup they fall back to rlimits
+// and the result carries a warning.
+func Start(ctx context.Context, command string, opts Options) (*Process, error) {
+	var warnings []string
+	cg, err := newCgroup(opts.Limits)
+	if err != nil {
+		warnings = append(warnings, fmt.Sprintf("mem and procs are per-process rlimits, not limits of the whole command, and hitting them is not reported: %v", err))
+	}
+	cmd, sandboxErrs, err := shellCommand(ctx, command, opts, cg)
+	if err != nil {
+		if cg != nil {
+			cg.remove()
+		}
+		return nil, err
+	}
+	if cg != nil {
+		cg.attach(cmd)
+	}
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error { return signalGroup(cmd, sigKill) }
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	dir, _ := os.Getwd()
+	start := time.Now()
+	err = cmd.Start()
+	// The helper has its own copy of the write end now.
+	for _, f := range cmd.ExtraFiles {
+		f.Close()
+	}
+	if err != nil {
+		if cg != nil {
+			cg.remove()
+		}
+		if sandboxErrs != nil {
+			sandboxErrs.Close()
+		}
+		return nil, err
+	}
+
+	p := &Process{
+		command: command,
+		dir:     dir,
+		cmd:     cmd,
+		start:   start,
+		out:     make(chan Output, 64),
+		done:    make(chan struct{}),
+		limits:  opts.Limits,
+		cgroup:  cg,
+
+		warnings:    warnings,
+		sandboxErrs: sandboxErrs,
+	}
+	if t := opts.Limits.Timeout; t > 0 {
+		timer := time.AfterFunc(t, func() { p.exceed(LimitTimeout) })
+		go func() {
+			<-p.done
+			timer.Stop()
+		}()
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go p.pump(&wg, Stdout, stdout)
+	go p.pump(&wg, Stderr, stderr)
+	go func() {
+		wg.Wait()
+		close(p.out)
+		p.err = cmd.Wait()
+		p.result = p.buildResult()
+		if p.sandboxErrs != nil {
+			if msg, _ := io.ReadAll(p.sandboxErrs); len(msg) > 0 {
+				p.sandboxErr = fmt.Errorf("sandbox: %s", msg)
+			}
+			p.sandboxErrs.Close()
+		}
+		if cg != nil {
+			cg.remove()
+		}
+		close(p.done)
+	}()
+	return p, nil
+}
+
+// pump copies lines from r to the output channel and the stream's capture.
+func (p *Process) pump(wg *sync.WaitGroup, stream Stream, r io.Reader) {
+	defer wg.Done()
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			p.mu.Lock()
+			p.streams[stream].write(line)
+			p.written += int64(len(line))
+			over := p.limits.Output > 0 && p.written > p.limits.Output
+			p.mu.Unlock()
+			p.out <- Output{Stream: stream, Line: strings.TrimRight(line, "\r\n")}
+			if over {
+				p.exceed(LimitOutput)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Command returns the command line the process was started with.
+func (p *Process) Command() string {
+	return p.command
+}
+
+// Output returns the channel of output lines. It is closed once both stdout
+// and stderr have reached EOF.
+func (p *Process) Output() <-chan Output {
+	return p.out
+}
+
+// Done returns a channel that is closed when the process has exited.
+func (p *Process) Done() <-chan struct{} {
+	return p.done
+}
+
+// Wait blocks until the process exits and returns its exit error.
+func (p *Process) Wait() error {
+	<-p.done
+	return p.err
+}
+
+// SandboxErr blocks until the process exits and returns why its sandbox
+// could not be set up, in which case the command never ran. It is nil for
+// commands that ran, whatever their exit status.
+func (p *Process) SandboxErr() error {
+	<-p.done
+	return p.sandboxErr
+}
+
+// Result blocks until the process exits and describes how it finished.
+func (p *Process) Result() Result {
+	<-p.done
+	return p.result
+}
+
+func (p *Process) buildResult() Result {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r := Result{
+		Command:         p.command,
+		Dir:             p.dir,
+		Interrupted:     p.interrupted,
+		Wall:            time.Since(p.start),
+		Stdout:          p.streams[Stdout].buf.String(),
+		Stderr:          p.streams[Stderr].buf.String(),
+		StdoutTruncated: p.streams[Stdout].truncated,
+		StderrTruncated: p.streams[Stderr].truncated,
+		Warnings:        p.warnings,
+	}
+	if ps := p.cmd.ProcessState; ps != nil {
+		r.ExitCode = ps.ExitCode()
+		r.CPU = ps.UserTime() + ps.SystemTime()
+		if sig, num := exitSignal(ps); sig != "" {
+			r.Signal = sig
+			r.ExitCode = 128 + num
+		}
+	}
+	r.LimitExceeded = p.exceededLimit(r)
+	return r
+}
+
+// exceededLimit works out which limit, if any, ended the command.
+func (p *Process) exceededLimit(r Result) string {
+	if p.exceeded != "" {
+		return p.exceeded
+	}
+	if p.cgroup != nil {
+		if kind := p.cgroup.exceeded(); kind != "" {
+			return kind
+		}
+	}
+	if p.limits.CPU > 0 && (r.Signal == "SIGXCPU" || (r.Signal == "SIGKILL" && r.CPU >= p.limits.CPU)) {
+		return LimitCPU
+	}
+	return ""
+}
+
+// exceed records that the command ran into a limit and kills it.
+func (p *Process) exceed(kind string) {
+	p.mu.Lock()
+	if p.exceeded == "" {
+		p.exceeded = kind
+	}
+	p.mu.Unlock()
+	signalGroup(p.cmd, sigKill)
+}
+
+// Interrupt sends SIGINT to the whole process group and follows up with
+// SIGKILL if the process is still running after grace.
+func (p *Process) Interrupt(grace time.Duration) {
+	p.mu.Lock()
+	p.interrupted = true
+	p.mu.Unlock()
+
+	signalGroup(p.cmd, sigInt)
+	go func() {
+		select {
+		case <-p.done:
+		case <-time.After(grace):
+			signalGroup(p.cmd, sigKill)
+		}
+	}()
+}
+
+// Interrupted reports whether Interrupt was called on the process.
+func (p *Process) Interrupted() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.interrupted
+}
@@ -0,0 +1,69 @@
+package exec
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestStartStreamsOutput(t *testing.T) {
+	p, err := Start(context.Background(), "echo out; echo err >&2", Options{})
+	if err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+
+	got := map[Stream]string{}
+	for o := range p.Output() {
+		got[o.Stream] = o.Line
+	}
+	if err := p.Wait(); err != nil {
+		t.Fatalf("Wait error: %v", err)
+	}
+	if got[Stdout] != "out" || got[Stderr] != "err" {
+		t.Fatalf("unexpected output: %v", got)
+	}
+}
+
+func TestInterruptKillsProcessGroup(t *testing.T) {
+	p, err := Start(context.Background(), "trap '' INT; echo started; sleep 30 & wait", Options{})
+	if err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+	if o := <-p.Output(); o.Line != "started" {
+		t.Fatalf("unexpected first line: %q", o.Line)
+	}
+
+	p.Interrupt(100 * time.Millisecond)
+	go func() {
+		for range p.Output() {
+		}
+	}()
+
+	select {
+	case <-p.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("process was not killed after grace period")
+	}
+	if !p.Interrupted() {
+		t.Error("expected Interrupted to be true")
+	}
+	res := p.Result()
+	if res.Stdout != "started\n" {
+		t.Errorf("unexpected partial output: %q", res.Stdout)
+	}
+	if res.Signal != "SIGKILL" || !res.Interrupted {
+		t.Errorf("unexpected termination: signal=%q interrupted=%v", res.Signal, res.Interrupted)
+	}
+}
+
+func TestCaptureKeepsWholeCharacters(t *testing.T) {
+	var c capture
+	c.write(strings.Repeat("a", maxCapture-3))
+	c.write("ab€\n")
+	got := c.buf.String()
+	if !c.truncated || !utf8.ValidString(got) || !strings.HasSuffix(got, "aab") {
+		t.Errorf("truncated %v, valid %v, ends %q", c.truncated, utf8.ValidString(got), got[len(got)-4:])
+	}
+}
@@ -0,0 +1,67 @@
+package exec
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Result describes a finished command.
+type Result struct {
+	Command         string        `json:"command"`
+	Dir             string        `json:"cwd"`
+	ExitCode        int           `json:"exit_code"`
+	Signal          string        `json:"signal,omitempty"`
+	Interrupted     bool          `json:"interrupted,omitempty"`
+	LimitExceeded   string        `json:"limit_exceeded,omitempty"`
+	Wall            time.Duration `json:"-"`
+	CPU             time.Duration `json:"-"`
+	Stdout          string        `json:"stdout"`
+	Stderr          string        `json:"stderr"`
+	StdoutTruncated bool          `json:"stdout_truncated,omitempty"`
+	StderrTruncated bool          `json:"stderr_truncated,omitempty"`
+	// Warnings say where the command ran with weaker limits than asked.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Success reports whether the command exited with status zero.
+func (r Result) Success() bool {
+	return r.ExitCode == 0 && r.Signal == ""
+}
+
+// Badge returns a compact status line such as "✓ 0 in 1.2s" or "✗ 127 in 3ms".
+// A violated limit is appended, e.g. "✗ SIGKILL in 30.0s (timeout limit)".
+func (r Result) Badge() string {
+	status := fmt.Sprint(r.ExitCode)
+	if r.Signal != "" {
+		status = r.Signal
+	}
+	mark := "✓"
+	if !r.Success() {
+		mark = "✗"
+	}
+	badge := fmt.Sprintf("%s %s in %s", mark, status, formatDuration(r.Wall))
+	if r.LimitExceeded != "" {
+		badge += fmt.Sprintf(" (%s limit)", r.LimitExceeded)
+	}
+	return badge
+}
+
+// JSON encodes the result in the format sent back to the model. Durations are
+// reported in milliseconds.
+func (r Result) JSON() string {
+	type alias Result
+	b, _ := json.MarshalIndent(struct {
+		alias
+		WallMS int64 `json:"wall_ms"`
+		CPUMS  int64 `json:"cpu_ms"`
+	}{alias(r), r.Wall.Milliseconds(), r.CPU.Milliseconds()}, "", "  ")
+	return string(b)
+}
+
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	}
+	return fmt.Sprintf("%.1fs", d.Seconds())
+}
@@ -2,12 +2,20 @@ package exec
 
 import (
 	"context"
-	"os/exec"
 )
 
-// RunCommand executes a command using the system shell and returns combined stdout and stderr.
-func RunCommand(ctx context.Context, command string) (string, error) {
-	cmd := exec.CommandContext(ctx, "bash", "-c", command)
-	out, err := cmd.CombinedOutput()
-	return string(out), err
+// RunCommand executes a command using the system shell and waits for it to
+// finish. The returned error is only set if the command could not be started
+// or its sandbox not set up; a non-zero exit is reported through the Result.
+func RunCommand(ctx context.Context, command string) (Result, error) {
+	p, err := Start(ctx, command, Options{})
+	if err != nil {
+		return Result{}, err
+	}
+	for range p.Output() {
+	}
+	if err := p.SandboxErr(); err != nil {
+		return Result{}, err
+	}
+	return p.Result(), nil
 }
@@ -7,11 +7,33 @@ import (
 )
 
 func TestRunCommand(t *testing.T) {
-	out, err := RunCommand(context.Background(), "echo hello")
+	res, err := RunCommand(context.Background(), "echo hello")
 	if err != nil {
 		t.Fatalf("RunCommand error: %v", err)
 	}
-	if strings.TrimSpace(out) != "hello" {
-		t.Fatalf("unexpected output: %q", out)
+	if strings.TrimSpace(res.Stdout) != "hello" {
+		t.Fatalf("unexpected output: %q", res.Stdout)
+	}
+	if !strings.HasPrefix(res.Badge(), "✓ 0 in ") {
+		t.Fatalf("unexpected badge: %q", res.Badge())
+	}
+}
+
+func TestRunCommandFailure(t *testing.T) {
+	res, err := RunCommand(context.Background(), "echo oops >&2; exit 127")
+	if err != nil {
+		t.Fatalf("RunCommand error: %v", err)
+	}
+	if res.ExitCode != 127 || res.Success() {
+		t.Fatalf("unexpected exit code: %d", res.ExitCode)
+	}
+	if res.Stdout != "" || strings.TrimSpace(res.Stderr) != "oops" {
+		t.Fatalf("streams not separated: stdout=%q stderr=%q", res.Stdout, res.Stderr)
+	}
+	if !strings.HasPrefix(res.Badge(), "✗ 127 in ") {
+		t.Fatalf("unexpected badge: %q", res.Badge())
+	}
+	if !strings.Contains(res.JSON(), `"exit_code": 127`) {
+		t.Fatalf("unexpected JSON: %s", res.JSON())
 	}
 }
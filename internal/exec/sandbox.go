@@ -0,0 +1,140 @@
+package exec
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Profile describes how an approved command is isolated from the host. The
+// zero Profile runs the command with the user's full privileges.
+type Profile struct {
+	Name        string
+	Description string
+	// ReadOnly makes the whole filesystem read-only except Writable.
+	ReadOnly bool
+	// Writable lists paths that stay writable when ReadOnly is set.
+	// Relative paths are resolved against the working directory.
+	Writable []string
+	// NoNetwork runs the command in an empty network namespace.
+	NoNetwork bool
+	// Hide lists files and directories that are masked from the command.
+	// A leading "~" is expanded to $HOME.
+	Hide []string
+	// Seccomp installs a filter that denies mount, ptrace, module loading
+	// and similar system calls.
+	Seccomp bool
+}
+
+// DefaultSecrets are the paths under $HOME that sandbox profiles hide.
+var DefaultSecrets = []string{
+	"~/.ssh", "~/.gnupg", "~/.aws", "~/.azure", "~/.config/gcloud",
+	"~/.kube", "~/.docker", "~/.password-store", "~/.netrc",
+	"~/.git-credentials", "~/.npmrc", "~/.pypirc",
+}
+
+// Profiles are the built-in sandbox profiles, in the order the approval
+// dialog cycles through them.
+var Profiles = []Profile{
+	{Name: "none", Description: "no sandbox, full user privileges"},
+	{
+		Name:        "project",
+		Description: "read-only except project dir and /tmp, no network, secrets hidden",
+		ReadOnly:    true,
+		Writable:    []string{".", "/tmp"},
+		NoNetwork:   true,
+		Hide:        DefaultSecrets,
+		Seccomp:     true,
+	},
+	{
+		Name:        "offline",
+		Description: "no network, secrets hidden",
+		NoNetwork:   true,
+		Hide:        DefaultSecrets,
+	},
+	{
+		Name:        "readonly",
+		Description: "read-only filesystem, no network, secrets hidden",
+		ReadOnly:    true,
+		NoNetwork:   true,
+		Hide:        DefaultSecrets,
+		Seccomp:     true,
+	},
+}
+
+// LookupProfile returns the built-in profile with the given name.
+func LookupProfile(name string) (Profile, bool) {
+	for _, p := range Profiles {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Profile{}, false
+}
+
+// Enabled reports whether the profile isolates the command at all.
+func (p Profile) Enabled() bool {
+	return p.ReadOnly || p.NoNetwork || len(p.Hide) > 0 || p.Seccomp
+}
+
+// resolve returns a copy of p with Writable and Hide turned into absolute
+// paths. Hidden paths that do not exist are dropped.
+func (p Profile) resolve() (Profile, error) {
+	home, _ := os.UserHomeDir()
+	abs := func(path string) (string, error) {
+		if path == "~" || strings.HasPrefix(path, "~/") {
+			if home == "" {
+				return "", fmt.Errorf("cannot expand %q: no home directory", path)
+			}
+			path = filepath.Join(home, path[1:])
+		}
+		return filepath.Abs(path)
+	}
+
+	r := p
+	r.Writable = nil
+	for _, w := range p.Writable {
+		path, err := abs(w)
+		if err != nil {
+			return Profile{}, err
+		}
+		r.Writable = append(r.Writable, path)
+	}
+	r.Hide = nil
+	for _, h := range p.Hide {
+		path, err := abs(h)
+		if err != nil {
+			continue
+		}
+		if _, err := os.Lstat(path); err == nil {
+			r.Hide = append(r.Hide, path)
+		}
+	}
+	return r, nil
+}
+
+// sandboxInitArg marks a re-execution of the ai-shell binary as the sandbox
+// helper that sets up namespaces before running the command.
+const sandboxInitArg = "__ai-shell-sandbox-init"
+
+// sandboxErrFD is the descriptor the helper reports a failed setup on, so
+// that it is not mistaken for the command's own exit status.
+const sandboxErrFD = 3
+
+// SandboxInit must be called at the start of main. When the process was
+// started as the sandbox helper it sets up the sandbox, runs the command and
+// exits with its status; otherwise it returns immediately.
+func SandboxInit() {
+	if len(os.Args) < 2 || os.Args[1] != sandboxInitArg {
+		return
+	}
+	code, err := runSandboxed(os.Args[2:])
+	if err != nil {
+		if _, werr := fmt.Fprint(os.NewFile(sandboxErrFD, "sandbox errors"), err); werr != nil {
+			fmt.Fprintf(os.Stderr, "ai-shell sandbox: %v\n", err)
+		}
+		os.Exit(126)
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,170 @@
+package exec
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// sandboxEnv carries the sandboxSpec from ai-shell to the helper.
+const sandboxEnv = "AI_SHELL_SANDBOX"
+
+// sandboxSpec is what the helper needs to rebuild the caller's view.
+type sandboxSpec struct {
+	Profile Profile
+	UID     int
+	GID     int
+}
+
+// sandboxCommand returns a command that runs argv inside profile. The
+// ai-shell binary is re-executed in fresh user, mount and (optionally)
+// network namespaces, where it applies the profile and then runs argv. If
+// that fails, the helper writes why to the write end of errs, which is
+// passed as its sandboxErrFD.
+func sandboxCommand(ctx context.Context, profile Profile, errs *os.File, argv ...string) (*exec.Cmd, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("sandbox: locate helper: %w", err)
+	}
+	resolved, err := profile.resolve()
+	if err != nil {
+		return nil, fmt.Errorf("sandbox: %w", err)
+	}
+	spec, err := json.Marshal(sandboxSpec{Profile: resolved, UID: os.Getuid(), GID: os.Getgid()})
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, self, append([]string{sandboxInitArg}, argv...)...)
+	cmd.Env = append(os.Environ(), sandboxEnv+"="+string(spec))
+	cmd.ExtraFiles = []*os.File{errs}
+
+	flags := uintptr(syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS)
+	if profile.NoNetwork {
+		flags |= syscall.CLONE_NEWNET
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  flags,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+	}
+	return cmd, nil
+}
+
+// runSandboxed runs in the helper process. It is root in its own user
+// namespace, so it can rearrange mounts before starting argv as the
+// original user.
+func runSandboxed(argv []string) (int, error) {
+	if len(argv) == 0 {
+		return 0, errors.New("no command")
+	}
+	var spec sandboxSpec
+	if err := json.Unmarshal([]byte(os.Getenv(sandboxEnv)), &spec); err != nil {
+		return 0, fmt.Errorf("read spec: %w", err)
+	}
+	os.Unsetenv(sandboxEnv)
+	p := spec.Profile
+	// Only the helper reports on the error descriptor.
+	unix.CloseOnExec(sandboxErrFD)
+
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return 0, fmt.Errorf("make mounts private: %w", err)
+	}
+	if p.ReadOnly {
+		if err := mountReadOnly(p.Writable); err != nil {
+			return 0, err
+		}
+	}
+	for _, path := range p.Hide {
+		if err := hidePath(path); err != nil {
+			return 0, fmt.Errorf("hide %s: %w", path, err)
+		}
+	}
+	if p.Seccomp {
+		if err := installSeccomp(); err != nil {
+			return 0, fmt.Errorf("seccomp: %w", err)
+		}
+	}
+
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if spec.UID != 0 || spec.GID != 0 {
+		// Map the caller back to their own uid so files they create
+		// are not owned by root inside the sandbox.
+		cmd.SysProcAttr = &syscall.SysProcAttr{
+			Cloneflags:  syscall.CLONE_NEWUSER,
+			UidMappings: []syscall.SysProcIDMap{{ContainerID: spec.UID, HostID: 0, Size: 1}},
+			GidMappings: []syscall.SysProcIDMap{{ContainerID: spec.GID, HostID: 0, Size: 1}},
+		}
+	}
+
+	// The command shares our process group, so interrupts reach it
+	// directly; the helper just has to outlive it.
+	signal.Notify(make(chan os.Signal, 1), syscall.SIGINT, syscall.SIGTERM)
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return 0, err
+		}
+		if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			signal.Reset(ws.Signal())
+			syscall.Kill(os.Getpid(), ws.Signal())
+			return 128 + int(ws.Signal()), nil
+		}
+		return exitErr.ExitCode(), nil
+	}
+	return 0, nil
+}
+
+// mountReadOnly makes every mount read-only and then puts writable copies
+// of the given paths back on top.
+func mountReadOnly(writable []string) error {
+	var trees []int
+	for _, path := range writable {
+		fd, err := unix.OpenTree(unix.AT_FDCWD, path, unix.OPEN_TREE_CLONE|unix.AT_RECURSIVE)
+		if err != nil {
+			return fmt.Errorf("clone %s: %w", path, err)
+		}
+		trees = append(trees, fd)
+	}
+
+	attr := &unix.MountAttr{Attr_set: unix.MOUNT_ATTR_RDONLY}
+	if err := unix.MountSetattr(unix.AT_FDCWD, "/", unix.AT_RECURSIVE, attr); err != nil {
+		return fmt.Errorf("remount read-only: %w", err)
+	}
+	// /proc must stay writable to set up the uid mapping of the command,
+	// and device nodes such as /dev/null are expected to accept writes.
+	// Either may not be a separate mount, so failures are ignored.
+	for _, path := range []string{"/proc", "/dev"} {
+		unix.MountSetattr(unix.AT_FDCWD, path, unix.AT_RECURSIVE, &unix.MountAttr{Attr_clr: unix.MOUNT_ATTR_RDONLY})
+	}
+
+	for i, fd := range trees {
+		err := unix.MoveMount(fd, "", unix.AT_FDCWD, writable[i], unix.MOVE_MOUNT_F_EMPTY_PATH)
+		unix.Close(fd)
+		if err != nil {
+			return fmt.Errorf("restore writable %s: %w", writable[i], err)
+		}
+	}
+	return nil
+}
+
+// hidePath masks a directory with an empty read-only tmpfs, or a file
+// with /dev/null.
+func hidePath(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	if fi.IsDir() {
+		return unix.Mount("tmpfs", path, "tmpfs", unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV, "size=4k,mode=700")
+	}
+	return unix.Mount("/dev/null", path, "", unix.MS_BIND, "")
+}
@@ -0,0 +1,89 @@
+package exec
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	SandboxInit()
+	os.Exit(m.Run())
+}
+
+// runSandboxed runs command under profile and skips the test if the host
+// does not allow unprivileged namespaces.
+func runInSandbox(t *testing.T, command string, profile Profile) Result {
+	t.Helper()
+	p, err := Start(context.Background(), command, Options{Sandbox: profile})
+	if err != nil {
+		t.Skipf("namespaces unavailable: %v", err)
+	}
+	for range p.Output() {
+	}
+	if err := p.SandboxErr(); err != nil {
+		t.Skipf("sandbox setup failed: %v", err)
+	}
+	return p.Result()
+}
+
+func TestSandboxSetupError(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+	p, err := Start(context.Background(), "echo ran", Options{Sandbox: Profile{ReadOnly: true, Writable: []string{missing}}})
+	if err != nil {
+		t.Skipf("namespaces unavailable: %v", err)
+	}
+	var out []string
+	for o := range p.Output() {
+		out = append(out, o.Line)
+	}
+	if err := p.SandboxErr(); err == nil || !strings.HasPrefix(err.Error(), "sandbox: ") {
+		t.Errorf("SandboxErr = %v, output %q", err, out)
+	}
+	if len(out) != 0 {
+		t.Errorf("the command ran or the error went to its output: %q", out)
+	}
+
+	if _, err := RunCommand(context.Background(), "true"); err != nil {
+		t.Errorf("unsandboxed command: %v", err)
+	}
+}
+
+func TestSandboxReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	profile := Profile{ReadOnly: true, Writable: []string{dir}}
+
+	res := runInSandbox(t, "touch "+filepath.Join(dir, "ok")+" && touch "+filepath.Join(outside, "denied"), profile)
+	if res.Success() {
+		t.Fatal("expected write outside the allow-list to fail")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ok")); err != nil {
+		t.Errorf("write inside the allow-list failed: %s", res.Stderr)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "denied")); err == nil {
+		t.Error("file was created outside the allow-list")
+	}
+}
+
+func TestSandboxHidesSecretsAndNetwork(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := os.MkdirAll(filepath.Join(home, ".ssh"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".ssh", "id_rsa"), []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	profile := Profile{NoNetwork: true, Hide: []string{"~/.ssh"}, Seccomp: true}
+
+	res := runInSandbox(t, "cat ~/.ssh/id_rsa; grep -c : /proc/net/dev", profile)
+	if strings.Contains(res.Stdout, "secret") {
+		t.Error("hidden file was readable")
+	}
+	if strings.TrimSpace(res.Stdout) != "1" {
+		t.Errorf("expected only loopback in network namespace, got %q", res.Stdout)
+	}
+}
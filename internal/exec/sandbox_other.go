@@ -0,0 +1,20 @@
+//go:build !linux
+
+package exec
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+)
+
+var errNoSandbox = errors.New("sandbox profiles require Linux namespaces")
+
+func sandboxCommand(ctx context.Context, profile Profile, errs *os.File, argv ...string) (*exec.Cmd, error) {
+	return nil, errNoSandbox
+}
+
+func runSandboxed(argv []string) (int, error) {
+	return 0, errNoSandbox
+}
@@ -48,11 +48,13 @@ func (s *Shell) Write(p []byte) (n int, err error) {
 	return s.ptmx.Write(p)
 }
 
-// Read reads data from the shell
+// Read reads data from the shell. It does not hold the lock while waiting
+// for output, so that Write, Resize and Close are not blocked meanwhile.
 func (s *Shell) Read(p []byte) (n int, err error) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-	if s.closed {
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
 		return 0, io.EOF
 	}
 	return s.ptmx.Read(p)
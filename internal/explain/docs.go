@@ -0,0 +1,205 @@
+package explain
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jrcrittenden/ai-shell/internal/risk"
+)
+
+// Limits on the documentation gathered for one command.
+const (
+	docTimeout   = 3 * time.Second
+	maxDocOutput = 512 << 10
+	maxSnippet   = 40
+)
+
+// ansiOrOverstrike removes colour codes and the backspace overstrike man
+// uses for bold and underline.
+var ansiOrOverstrike = regexp.MustCompile("\x1b\\[[0-9;]*m|.\b")
+
+// Doc is the local documentation found for one program.
+type Doc struct {
+	Name string
+	// Source is where the text came from: "man" or "help".
+	Source string
+	// Text holds the lines relevant to the flags used.
+	Text string
+}
+
+// Docs collects documentation snippets for the programs in cmds from man
+// pages and bash's help builtin. The programs themselves are never run,
+// not even with "--help": the command is only being explained and has not
+// been approved.
+func Docs(ctx context.Context, cmds []risk.Command) []Doc {
+	flags := map[string][]string{}
+	var names []string
+	for _, c := range cmds {
+		if _, seen := flags[c.Name]; !seen {
+			names = append(names, c.Name)
+			flags[c.Name] = nil
+		}
+		for _, a := range c.Args {
+			if strings.HasPrefix(a, "-") && a != "-" && a != "--" {
+				flags[c.Name] = append(flags[c.Name], a)
+			}
+		}
+	}
+
+	var docs []Doc
+	for _, name := range names {
+		if !plainName(name) {
+			continue
+		}
+		source, text := lookup(ctx, name)
+		if text == "" {
+			continue
+		}
+		docs = append(docs, Doc{Name: name, Source: source, Text: Snippet(text, flags[name])})
+	}
+	return docs
+}
+
+// plainName reports whether name is a bare program name that is safe to
+// look up.
+func plainName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, "/$`\"' ") && !strings.HasPrefix(name, "-")
+}
+
+func lookup(ctx context.Context, name string) (source, text string) {
+	if text := run(ctx, []string{"MANPAGER=cat", "MANWIDTH=100"}, "man", name); text != "" {
+		return "man", text
+	}
+	if text := run(ctx, nil, "bash", "-c", `help -m "$1" 2>/dev/null`, "bash", name); text != "" {
+		return "help", text
+	}
+	return "", ""
+}
+
+// run returns the output of a documentation command, or "" if it failed.
+func run(ctx context.Context, env []string, name string, args ...string) string {
+	ctx, cancel := context.WithTimeout(ctx, docTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), env...)
+	var out bytes.Buffer
+	cmd.Stdout = &limitedBuffer{buf: &out, max: maxDocOutput}
+	cmd.Stderr = cmd.Stdout
+	// man and help may exit non-zero after printing something useful.
+	err := cmd.Run()
+	if ctx.Err() != nil || (err != nil && out.Len() < 80) {
+		return ""
+	}
+	return ansiOrOverstrike.ReplaceAllString(out.String(), "")
+}
+
+// limitedBuffer drops output past max bytes.
+type limitedBuffer struct {
+	buf *bytes.Buffer
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+// Snippet picks the parts of a help text that matter for flags: the first
+// lines (name and synopsis) and each option's description.
+func Snippet(text string, flags []string) string {
+	lines := strings.Split(text, "\n")
+	keep := make([]bool, len(lines))
+
+	// The name and synopsis, up to the first option.
+	head := 0
+	for i := 0; i < len(lines) && head < 4; i++ {
+		if strings.HasPrefix(strings.TrimSpace(lines[i]), "-") {
+			break
+		}
+		if strings.TrimSpace(lines[i]) != "" {
+			keep[i] = true
+			head++
+		}
+	}
+	for _, flag := range expandFlags(flags) {
+		for i, line := range lines {
+			if !definesFlag(line, flag) {
+				continue
+			}
+			// The definition and its indented description.
+			keep[i] = true
+			indent := indentOf(line)
+			for j := i + 1; j < len(lines) && j <= i+4; j++ {
+				if strings.TrimSpace(lines[j]) == "" || indentOf(lines[j]) <= indent {
+					break
+				}
+				keep[j] = true
+			}
+			break
+		}
+	}
+
+	var out []string
+	for i, line := range lines {
+		if !keep[i] {
+			continue
+		}
+		if i > 0 && !keep[i-1] && len(out) > 0 {
+			out = append(out, "  ...")
+		}
+		out = append(out, strings.TrimRight(line, " \t"))
+		if len(out) >= maxSnippet {
+			break
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// shortFlags matches combined short options such as -rf.
+var shortFlags = regexp.MustCompile(`^-[a-zA-Z0-9]{2,}$`)
+
+// expandFlags drops values attached with "=" and adds the single letters
+// of combined short options. The whole word is kept first for find-style
+// options such as -name.
+func expandFlags(flags []string) []string {
+	var out []string
+	for _, f := range flags {
+		f, _, _ = strings.Cut(f, "=")
+		out = append(out, f)
+		if shortFlags.MatchString(f) {
+			for _, c := range f[1:] {
+				out = append(out, "-"+string(c))
+			}
+		}
+	}
+	return out
+}
+
+// definesFlag reports whether line starts the description of flag, as in
+// "  -r, --recursive" or "       -name pattern".
+func definesFlag(line, flag string) bool {
+	trimmed := strings.TrimSpace(line)
+	if !strings.HasPrefix(trimmed, "-") {
+		return false
+	}
+	for _, field := range strings.FieldsFunc(trimmed, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '[' || r == '=' }) {
+		if field == flag {
+			return true
+		}
+		if !strings.HasPrefix(field, "-") {
+			break
+		}
+	}
+	return false
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
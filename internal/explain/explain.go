@@ -0,0 +1,101 @@
+// Package explain asks the model for a piece-by-piece explanation of a
+// proposed command, grounded in the local documentation of the programs it
+// runs. Explanations are separate requests and never enter the chat
+// history.
+package explain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jrcrittenden/ai-shell/internal/risk"
+	"github.com/jrcrittenden/ai-shell/llm"
+)
+
+const prompt = `Explain the following shell command to a user who must decide whether
+to run it. Break it into segments: every pipeline stage, every flag or
+option, every redirection and every substitution gets its own segment, in
+the order they appear. Use the documentation excerpts from this machine
+when they apply; they are more reliable than your memory, since options
+differ between GNU and BSD tools.
+
+Answer with JSON only, in this form:
+{"segments": [{"segment": "<exact text from the command>", "explanation": "<one sentence>"}],
+ "summary": "<what the whole command does, including side effects>"}
+
+Command:
+%s
+%s`
+
+// Segment explains one part of a command.
+type Segment struct {
+	Segment     string `json:"segment"`
+	Explanation string `json:"explanation"`
+}
+
+// Explanation is the model's breakdown of a command.
+type Explanation struct {
+	Segments []Segment `json:"segments"`
+	Summary  string    `json:"summary"`
+	// Docs lists the programs whose local documentation was supplied.
+	Docs []string `json:"-"`
+}
+
+// String renders the explanation as indented plain text.
+func (e Explanation) String() string {
+	var sb strings.Builder
+	for _, s := range e.Segments {
+		fmt.Fprintf(&sb, "%s\n    %s\n", s.Segment, s.Explanation)
+	}
+	if e.Summary != "" {
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(e.Summary + "\n")
+	}
+	if len(e.Docs) > 0 {
+		fmt.Fprintf(&sb, "\n(local docs: %s)\n", strings.Join(e.Docs, ", "))
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// Explain asks client to explain command. Tool calls in the answer are
+// ignored. If the answer is not the requested JSON it is returned as the
+// summary.
+func Explain(ctx context.Context, client llm.Client, command string) (Explanation, error) {
+	cmds, _ := risk.Commands(command)
+	docs := Docs(ctx, cmds)
+
+	var sb strings.Builder
+	var names []string
+	for _, d := range docs {
+		fmt.Fprintf(&sb, "\nDocumentation for %s (%s):\n%s\n", d.Name, d.Source, d.Text)
+		names = append(names, d.Name)
+	}
+
+	hist := []llm.Message{{Role: "user", Content: fmt.Sprintf(prompt, command, sb.String())}}
+	var answer strings.Builder
+	for chunk := range client.Stream(ctx, hist) {
+		if chunk.Err != nil {
+			return Explanation{}, chunk.Err
+		}
+		answer.WriteString(chunk.Text)
+	}
+
+	e := parse(answer.String())
+	e.Docs = names
+	return e, nil
+}
+
+// parse extracts the JSON object from answer, tolerating code fences and
+// text around it.
+func parse(answer string) Explanation {
+	var e Explanation
+	start, end := strings.Index(answer, "{"), strings.LastIndex(answer, "}")
+	if start >= 0 && end > start && json.Unmarshal([]byte(answer[start:end+1]), &e) == nil && (len(e.Segments) > 0 || e.Summary != "") {
+		return e
+	}
+	return Explanation{Summary: strings.TrimSpace(answer)}
+}
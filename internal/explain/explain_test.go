@@ -0,0 +1,80 @@
+package explain
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jrcrittenden/ai-shell/llm"
+)
+
+const rmHelp = `Usage: rm [OPTION]... [FILE]...
+Remove (unlink) the FILE(s).
+
+  -f, --force           ignore nonexistent files and arguments, never prompt
+  -i                    prompt before every removal
+  -r, -R, --recursive   remove directories and their contents recursively
+  -v, --verbose         explain what is being done
+      --help        display this help and exit
+`
+
+func TestSnippet(t *testing.T) {
+	got := Snippet(rmHelp, []string{"-rf"})
+	for _, want := range []string{"Usage: rm", "--force", "--recursive"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("snippet lacks %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "--verbose") || strings.Contains(got, "prompt before every removal") {
+		t.Errorf("snippet has unrelated options:\n%s", got)
+	}
+}
+
+// answerClient answers every request with a fixed text and records the
+// prompt it was sent.
+type answerClient struct {
+	answer string
+	prompt *string
+}
+
+func (c answerClient) Stream(ctx context.Context, hist []llm.Message) <-chan llm.Chunk {
+	*c.prompt = hist[len(hist)-1].Content
+	out := make(chan llm.Chunk, 3)
+	out <- llm.Chunk{Text: c.answer}
+	out <- llm.Chunk{ToolCall: &llm.ToolCall{Command: "rm -rf /"}}
+	out <- llm.Chunk{Done: true}
+	close(out)
+	return out
+}
+
+func TestExplain(t *testing.T) {
+	var prompt string
+	client := answerClient{
+		answer: "```json\n" + `{"segments": [{"segment": "ls -l", "explanation": "long listing"}, {"segment": "| wc -l", "explanation": "counts lines"}], "summary": "Counts entries."}` + "\n```",
+		prompt: &prompt,
+	}
+	e, err := Explain(context.Background(), client, "ls -l | wc -l")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(prompt, "ls -l | wc -l") {
+		t.Errorf("command missing from prompt:\n%s", prompt)
+	}
+	if len(e.Segments) != 2 || e.Segments[1].Segment != "| wc -l" || e.Summary != "Counts entries." {
+		t.Fatalf("unexpected explanation: %+v", e)
+	}
+	if s := e.String(); !strings.Contains(s, "ls -l\n    long listing") {
+		t.Errorf("unexpected rendering:\n%s", s)
+	}
+}
+
+func TestExplainFallsBackToText(t *testing.T) {
+	var prompt string
+	e, err := Explain(context.Background(), answerClient{answer: "It lists files.", prompt: &prompt}, "ls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Segments) != 0 || e.Summary != "It lists files." {
+		t.Fatalf("unexpected explanation: %+v", e)
+	}
+}
@@ -0,0 +1,340 @@
+// Package export writes saved sessions in formats meant for reading and
+// sharing outside ai-shell: Markdown, a versioned JSON document and, for
+// the Bash mode terminal, an asciicast v2 recording.
+package export
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jrcrittenden/ai-shell/internal/audit"
+	executil "github.com/jrcrittenden/ai-shell/internal/exec"
+	"github.com/jrcrittenden/ai-shell/internal/sessions"
+)
+
+// Formats lists the names accepted by Write.
+var Formats = []string{"markdown", "json", "asciicast"}
+
+// ErrNoRecording is returned when an asciicast is asked of a session in
+// which Bash mode was never used.
+var ErrNoRecording = errors.New("the session has no Bash mode recording")
+
+// Write writes s to w in format, one of Formats. "md" and "cast" are
+// accepted as short names.
+func Write(w io.Writer, s *sessions.Session, format string) error {
+	switch format {
+	case "markdown", "md":
+		_, err := io.WriteString(w, Markdown(s))
+		return err
+	case "json":
+		return JSON(w, s)
+	case "asciicast", "cast":
+		return Asciicast(w, s)
+	}
+	return fmt.Errorf("unknown export format %q (want %s)", format, strings.Join(Formats, ", "))
+}
+
+/* --------------------------------------------------------------------- */
+/*  JSON                                                                 */
+/* --------------------------------------------------------------------- */
+
+// Version is the version of the JSON document. It changes when a field is
+// removed or changes meaning; fields may be added without changing it.
+const Version = 1
+
+// Document is a session as exported to JSON.
+type Document struct {
+	Version int       `json:"version"`
+	ID      string    `json:"id"`
+	Title   string    `json:"title"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+	Backend string    `json:"backend"`
+	Model   string    `json:"model,omitempty"`
+	Dir     string    `json:"cwd,omitempty"`
+	Entries []Entry   `json:"entries"`
+}
+
+// Entry is a prompt, an answer, a proposed command, a decision on one, an
+// edit, a command's result or an undo. Type is "prompt", "answer" or one
+// of the audit log's event types.
+type Entry struct {
+	Time       time.Time `json:"time"`
+	Type       string    `json:"type"`
+	Text       string    `json:"text,omitempty"`
+	Command    string    `json:"command,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	Decision   string    `json:"decision,omitempty"`
+	DenyReason string    `json:"deny_reason,omitempty"`
+	Original   string    `json:"original,omitempty"`
+	// Details are notes such as the risk of a proposal or the sandbox of
+	// an approval.
+	Details map[string]string `json:"details,omitempty"`
+	// Result is set for executions.
+	Result *Result `json:"result,omitempty"`
+}
+
+// Result is how an executed command ended and what it printed.
+type Result struct {
+	Dir             string `json:"cwd,omitempty"`
+	ExitCode        int    `json:"exit_code"`
+	Signal          string `json:"signal,omitempty"`
+	Interrupted     bool   `json:"interrupted,omitempty"`
+	LimitExceeded   string `json:"limit_exceeded,omitempty"`
+	WallMS          int64  `json:"wall_ms"`
+	Stdout          string `json:"stdout"`
+	Stderr          string `json:"stderr"`
+	StdoutTruncated bool   `json:"stdout_truncated,omitempty"`
+	StderrTruncated bool   `json:"stderr_truncated,omitempty"`
+}
+
+// badge returns the status line the TUI showed for r.
+func (r Result) badge() string {
+	return executil.Result{
+		ExitCode:      r.ExitCode,
+		Signal:        r.Signal,
+		LimitExceeded: r.LimitExceeded,
+		Wall:          time.Duration(r.WallMS) * time.Millisecond,
+	}.Badge()
+}
+
+// NewDocument converts s to the exported form.
+func NewDocument(s *sessions.Session) Document {
+	d := Document{
+		Version: Version,
+		ID:      s.ID,
+		Title:   s.Title,
+		Created: s.Created,
+		Updated: s.Updated,
+		Backend: s.Backend,
+		Model:   s.Model,
+		Dir:     s.Dir,
+		Entries: []Entry{},
+	}
+	for _, e := range s.Events {
+		d.Entries = append(d.Entries, entry(e))
+	}
+	return d
+}
+
+func entry(e sessions.Event) Entry {
+	out := Entry{
+		Time:       e.Time,
+		Type:       e.Event,
+		Text:       e.Text,
+		Command:    e.Command,
+		Reason:     e.Reason,
+		Decision:   e.Decision,
+		DenyReason: e.DenyReason,
+		Original:   e.Original,
+	}
+	if e.Details == nil {
+		return out
+	}
+	// Details are json.RawMessage or maps while recording and generic
+	// JSON values after a load; going through JSON handles both.
+	raw, err := json.Marshal(e.Details)
+	if err != nil {
+		return out
+	}
+	if e.Event == audit.EventExecution {
+		var r Result
+		if json.Unmarshal(raw, &r) == nil {
+			out.Result = &r
+		}
+		return out
+	}
+	var details map[string]any
+	if json.Unmarshal(raw, &details) != nil {
+		return out
+	}
+	out.Details = map[string]string{}
+	for k, v := range details {
+		switch v := v.(type) {
+		case string:
+			out.Details[k] = v
+		case []any:
+			var parts []string
+			for _, p := range v {
+				parts = append(parts, fmt.Sprint(p))
+			}
+			out.Details[k] = strings.Join(parts, ", ")
+		default:
+			out.Details[k] = fmt.Sprint(v)
+		}
+	}
+	return out
+}
+
+// JSON writes s as an indented Document.
+func JSON(w io.Writer, s *sessions.Session) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(NewDocument(s))
+}
+
+/* --------------------------------------------------------------------- */
+/*  Markdown                                                             */
+/* --------------------------------------------------------------------- */
+
+// Markdown renders s for reading: prompts, answers, proposed commands in
+// fenced blocks, the decisions on them and their output.
+func Markdown(s *sessions.Session) string {
+	d := NewDocument(s)
+	var b strings.Builder
+	title := d.Title
+	if title == "" {
+		title = "Session " + d.ID
+	}
+	fmt.Fprintf(&b, "# %s\n\n", oneLine(title))
+	fmt.Fprintf(&b, "- Session: `%s`\n", d.ID)
+	fmt.Fprintf(&b, "- Started: %s\n", d.Created.Format("2006-01-02 15:04:05 MST"))
+	backend := d.Backend
+	if d.Model != "" {
+		backend += " (" + d.Model + ")"
+	}
+	fmt.Fprintf(&b, "- Backend: %s\n", backend)
+	if d.Dir != "" {
+		fmt.Fprintf(&b, "- Directory: `%s`\n", d.Dir)
+	}
+
+	for _, e := range d.Entries {
+		b.WriteString("\n")
+		switch e.Type {
+		case sessions.EventPrompt:
+			b.WriteString("## Prompt\n\n")
+			for _, line := range strings.Split(strings.TrimRight(e.Text, "\n"), "\n") {
+				b.WriteString(strings.TrimRight("> "+line, " ") + "\n")
+			}
+		case sessions.EventAnswer:
+			b.WriteString("### Answer\n\n")
+			b.WriteString(strings.TrimRight(e.Text, "\n") + "\n")
+		case audit.EventProposal:
+			b.WriteString("**Proposed command**")
+			if e.Reason != "" {
+				b.WriteString(": " + oneLine(e.Reason))
+			}
+			b.WriteString("\n\n" + fence("sh", e.Command))
+			if notes := detailList(e.Details); notes != "" {
+				b.WriteString("\n" + notes)
+			}
+		case audit.EventEdit:
+			b.WriteString("**Edited** to:\n\n" + fence("sh", e.Command))
+		case audit.EventDecision:
+			fmt.Fprintf(&b, "**Decision:** %s", e.Decision)
+			if e.DenyReason != "" {
+				b.WriteString(": " + oneLine(e.DenyReason))
+			}
+			b.WriteString("\n")
+			if e.Original != "" && e.Original != e.Command {
+				b.WriteString("\n" + fence("sh", e.Command))
+			}
+			if notes := detailList(e.Details); notes != "" {
+				b.WriteString("\n" + notes)
+			}
+		case audit.EventExecution:
+			if e.Result == nil {
+				fmt.Fprintf(&b, "**Ran** `%s`\n", e.Command)
+				break
+			}
+			fmt.Fprintf(&b, "**Output** (%s)\n", e.Result.badge())
+			if out := strings.TrimRight(e.Result.Stdout, "\n"); out != "" {
+				b.WriteString("\n" + fence("text", out))
+			}
+			if out := strings.TrimRight(e.Result.Stderr, "\n"); out != "" {
+				b.WriteString("\nstderr:\n\n" + fence("text", out))
+			}
+		case audit.EventUndo:
+			fmt.Fprintf(&b, "**Undone:** `%s`", e.Command)
+			if files := e.Details["files"]; files != "" {
+				b.WriteString(" (" + files + ")")
+			}
+			b.WriteString("\n")
+		default:
+			fmt.Fprintf(&b, "**%s** `%s`\n", e.Type, e.Command)
+		}
+	}
+
+	if out := strings.TrimRight(s.BashOutput, "\n"); out != "" {
+		b.WriteString("\n## Bash mode\n\n" + fence("text", out))
+	}
+	return b.String()
+}
+
+// fence puts text in a fenced code block longer than any run of
+// backticks inside it.
+func fence(lang, text string) string {
+	longest, run := 0, 0
+	for _, r := range text {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	marks := strings.Repeat("`", max(3, longest+1))
+	return marks + lang + "\n" + strings.TrimRight(text, "\n") + "\n" + marks + "\n"
+}
+
+// detailList renders details as one line of sorted "key: value" pairs.
+func detailList(details map[string]string) string {
+	var keys []string
+	for k, v := range details {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		parts = append(parts, k+": "+oneLine(details[k]))
+	}
+	return "_" + strings.Join(parts, ", ") + "_\n"
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+/* --------------------------------------------------------------------- */
+/*  Asciicast                                                            */
+/* --------------------------------------------------------------------- */
+
+// Asciicast writes the Bash mode recording of s as an asciicast v2 file:
+// a header line, then one [seconds, "o", data] line per piece of output.
+func Asciicast(w io.Writer, s *sessions.Session) error {
+	r := s.Recording
+	if r == nil || len(r.Frames) == 0 {
+		return ErrNoRecording
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	header := map[string]any{
+		"version":   2,
+		"width":     max(r.Width, 1),
+		"height":    max(r.Height, 1),
+		"timestamp": r.Start.Unix(),
+	}
+	if s.Title != "" {
+		header["title"] = s.Title
+	}
+	if err := enc.Encode(header); err != nil {
+		return err
+	}
+	for _, f := range r.Frames {
+		if err := enc.Encode([]any{f.At.Seconds(), "o", f.Data}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
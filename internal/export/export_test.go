@@ -0,0 +1,119 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jrcrittenden/ai-shell/internal/audit"
+	executil "github.com/jrcrittenden/ai-shell/internal/exec"
+	"github.com/jrcrittenden/ai-shell/internal/sessions"
+)
+
+// testSession returns a session with one of each event, saved and loaded
+// again so that its details are generic JSON values as after a resume.
+func testSession(t *testing.T) *sessions.Session {
+	at := time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC)
+	s := &sessions.Session{ID: "20261018-093000-abcdef", Title: "find large files", Created: at, Updated: at, Backend: "openai", Model: "gpt-4", Dir: "/work"}
+	s.Say(sessions.EventPrompt, "find large files\nin here")
+	s.Say(sessions.EventAnswer, "Let me check the sizes.")
+	s.Record(audit.Entry{Event: audit.EventProposal, Command: "du -sh * | sort -h", Reason: "list sizes", Details: map[string]string{"risk": "low", "policy": "ask"}})
+	s.Record(audit.Entry{Event: audit.EventDecision, Command: "du -sh * | sort -h", Decision: audit.Approved, Details: map[string]string{"sandbox": "none"}})
+	r := executil.Result{Command: "du -sh * | sort -h", Stdout: "4.0K\ta\n```\n", Wall: 12 * time.Millisecond}
+	s.Record(audit.Entry{Event: audit.EventExecution, Command: r.Command, Details: json.RawMessage(r.JSON())})
+	s.Record(audit.Entry{Event: audit.EventDecision, Command: "rm -rf big", Decision: audit.Denied, DenyReason: "keep it"})
+	s.Record(audit.Entry{Event: audit.EventUndo, Command: "touch x", Details: map[string]any{"checkpoint": "c1", "files": []string{"x", "y"}}})
+	s.BashOutput = "$ ls\na"
+	s.Recording = &sessions.Recording{Start: at, Width: 80, Height: 24}
+	s.Recording.Add(at.Add(100*time.Millisecond), "$ ")
+	s.Recording.Add(at.Add(1500*time.Millisecond), "ls\r\na\r\n")
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded sessions.Session
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	return &loaded
+}
+
+func TestMarkdown(t *testing.T) {
+	md := Markdown(testSession(t))
+	for _, want := range []string{
+		"# find large files\n",
+		"- Backend: openai (gpt-4)\n",
+		"## Prompt\n\n> find large files\n> in here\n",
+		"### Answer\n\nLet me check the sizes.\n",
+		"**Proposed command**: list sizes\n\n```sh\ndu -sh * | sort -h\n```\n\n_policy: ask, risk: low_\n",
+		"**Decision:** approved\n\n_sandbox: none_\n",
+		"**Output** (✓ 0 in 12ms)\n\n````text\n4.0K\ta\n```\n````\n",
+		"**Decision:** denied: keep it\n",
+		"**Undone:** `touch x` (x, y)\n",
+		"## Bash mode\n\n```text\n$ ls\na\n```\n",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("Markdown lacks %q:\n%s", want, md)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, testSession(t), "json"); err != nil {
+		t.Fatal(err)
+	}
+	var d Document
+	if err := json.Unmarshal(buf.Bytes(), &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Version != Version || d.ID != "20261018-093000-abcdef" || len(d.Entries) != 7 {
+		t.Fatalf("document = %+v", d)
+	}
+	if e := d.Entries[0]; e.Type != "prompt" || e.Text != "find large files\nin here" {
+		t.Errorf("prompt = %+v", e)
+	}
+	if r := d.Entries[4].Result; r == nil || r.WallMS != 12 || r.Stdout != "4.0K\ta\n```\n" {
+		t.Errorf("result = %+v", r)
+	}
+	if got := d.Entries[6].Details["files"]; got != "x, y" {
+		t.Errorf("undo files = %q", got)
+	}
+}
+
+func TestAsciicast(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, testSession(t), "cast"); err != nil {
+		t.Fatal(err)
+	}
+	sc := bufio.NewScanner(&buf)
+	var lines []string
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	if len(lines) != 3 {
+		t.Fatalf("%d lines:\n%s", len(lines), strings.Join(lines, "\n"))
+	}
+	var header struct {
+		Version, Width, Height int
+		Timestamp              int64
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &header); err != nil || header.Version != 2 || header.Width != 80 || header.Height != 24 || header.Timestamp == 0 {
+		t.Errorf("header = %s (%v)", lines[0], err)
+	}
+	if lines[2] != `[1.5,"o","ls\r\na\r\n"]` {
+		t.Errorf("event = %s", lines[2])
+	}
+
+	if err := Asciicast(&buf, &sessions.Session{}); !errors.Is(err, ErrNoRecording) {
+		t.Errorf("without a recording: %v", err)
+	}
+	if err := Write(&buf, &sessions.Session{}, "html"); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
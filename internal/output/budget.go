@@ -0,0 +1,153 @@
+// Package output shrinks command output before it is sent to a language
+// model while keeping the full text available on request.
+package output
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Budget limits how much command output is forwarded to the model.
+type Budget struct {
+	// MaxLines is the number of lines kept, split between head and tail.
+	MaxLines int
+	// MaxBytes caps the size of the clipped text.
+	MaxBytes int
+	// SummarizeAbove is the size in bytes above which output is summarized
+	// by a secondary model, if one is configured. Zero disables summaries.
+	SummarizeAbove int
+}
+
+// DefaultBudget returns the budget used when none is configured.
+func DefaultBudget() Budget {
+	return Budget{MaxLines: 200, MaxBytes: 16 << 10}
+}
+
+// Fits reports whether text is within the budget without clipping.
+func (b Budget) Fits(text string) bool {
+	return (b.MaxBytes <= 0 || len(text) <= b.MaxBytes) &&
+		(b.MaxLines <= 0 || strings.Count(text, "\n") <= b.MaxLines)
+}
+
+// Clip collapses repeated lines and keeps the head and tail of text within
+// the budget. elided is called with the first and last elided line numbers
+// (1-based) and returns the marker inserted in their place.
+func (b Budget) Clip(text string, elided func(from, to int) string) string {
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	collapsed := Collapse(lines)
+
+	maxLines := b.MaxLines
+	if maxLines <= 0 {
+		maxLines = len(collapsed.Lines)
+	}
+	head, tail := maxLines/2, maxLines-maxLines/2
+	if len(collapsed.Lines) <= maxLines {
+		head, tail = len(collapsed.Lines), 0
+	}
+	// Split the byte budget evenly as well so a few huge lines cannot push
+	// the result past MaxBytes.
+	headLines := takeBytes(collapsed.Lines[:head], b.MaxBytes/2, false)
+	tailLines := takeBytes(collapsed.Lines[len(collapsed.Lines)-tail:], b.MaxBytes/2, true)
+
+	var sb strings.Builder
+	for _, l := range headLines {
+		sb.WriteString(l)
+		sb.WriteByte('\n')
+	}
+	if skipped := len(collapsed.Lines) - len(headLines) - len(tailLines); skipped > 0 {
+		// A repeat marker stands for many lines, so the elided range ends
+		// just before the first line kept in the tail.
+		first, last := collapsed.Source[len(headLines)], len(lines)
+		if len(tailLines) > 0 {
+			last = collapsed.Source[len(collapsed.Lines)-len(tailLines)] - 1
+		}
+		sb.WriteString(elided(first, last))
+		sb.WriteByte('\n')
+	}
+	for _, l := range tailLines {
+		sb.WriteString(l)
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// takeBytes returns as many lines as fit in limit bytes, counting from the
+// end when fromEnd is set. The first line that does not fit is cut to the
+// room left with a marker, unless not even the marker fits, so that a
+// single huge line still shows its start. A non-positive limit keeps every
+// line.
+func takeBytes(lines []string, limit int, fromEnd bool) []string {
+	if limit <= 0 {
+		return lines
+	}
+	var out []string
+	size := 0
+	for n := 0; n < len(lines); n++ {
+		l := lines[n]
+		if fromEnd {
+			l = lines[len(lines)-1-n]
+		}
+		if size+len(l)+1 > limit {
+			if cut, ok := cutLine(l, limit-size-1); ok {
+				out = append(out, cut)
+			}
+			break
+		}
+		size += len(l) + 1
+		out = append(out, l)
+	}
+	if fromEnd {
+		slices.Reverse(out)
+	}
+	return out
+}
+
+// cutLine shortens l to at most room bytes, ending in a marker that gives
+// the line's full length. It reports false if the marker does not fit.
+func cutLine(l string, room int) (string, bool) {
+	marker := fmt.Sprintf("… [rest of a %d-byte line cut]", len(l))
+	keep := room - len(marker)
+	if keep < 1 {
+		return "", false
+	}
+	// Cut before a character rather than through it.
+	for keep > 0 && !utf8.RuneStart(l[keep]) {
+		keep--
+	}
+	return l[:keep] + marker, true
+}
+
+// Collapsed is the result of Collapse.
+type Collapsed struct {
+	// Lines holds the output with runs of identical lines folded.
+	Lines []string
+	// Source maps each entry in Lines to its 1-based line number in the
+	// original output.
+	Source []int
+}
+
+// Collapse folds runs of three or more identical lines into the line itself
+// followed by a repeat marker.
+func Collapse(lines []string) Collapsed {
+	var c Collapsed
+	for i := 0; i < len(lines); {
+		j := i + 1
+		for j < len(lines) && lines[j] == lines[i] {
+			j++
+		}
+		c.Lines = append(c.Lines, lines[i])
+		c.Source = append(c.Source, i+1)
+		switch n := j - i - 1; {
+		case n == 1:
+			c.Lines = append(c.Lines, lines[i])
+			c.Source = append(c.Source, i+2)
+		case n > 1:
+			c.Lines = append(c.Lines, fmt.Sprintf("[previous line repeated %d more times]", n))
+			c.Source = append(c.Source, i+2)
+		}
+		i = j
+	}
+	return c
+}
@@ -0,0 +1,135 @@
+package output
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/jrcrittenden/ai-shell/llm"
+)
+
+func numbered(n int) string {
+	var sb strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&sb, "line %d\n", i)
+	}
+	return sb.String()
+}
+
+func TestClipKeepsHeadAndTail(t *testing.T) {
+	var s Store
+	out, clipped := s.Clip(numbered(100), Budget{MaxLines: 10})
+	if !clipped {
+		t.Fatal("expected output to be clipped")
+	}
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) != 11 {
+		t.Fatalf("expected 11 lines, got %d:\n%s", len(lines), out)
+	}
+	if lines[0] != "line 1" || lines[4] != "line 5" || lines[6] != "line 96" || lines[10] != "line 100" {
+		t.Fatalf("unexpected head/tail:\n%s", out)
+	}
+	if !strings.Contains(lines[5], "`@output 1 6-95`") {
+		t.Fatalf("unexpected marker: %q", lines[5])
+	}
+
+	got, err := s.Range(1, 6, 7)
+	if err != nil || got != "line 6\nline 7\n" {
+		t.Fatalf("Range = %q, %v", got, err)
+	}
+}
+
+func TestClipElidedRepeats(t *testing.T) {
+	text := "h1\nh2\n" + strings.Repeat("b\n", 20) + "t1\nt2\n"
+	var from, to int
+	out := Budget{MaxLines: 4}.Clip(text, func(f, l int) string {
+		from, to = f, l
+		return "[elided]"
+	})
+	if from != 3 || to != 22 || out != "h1\nh2\n[elided]\nt1\nt2\n" {
+		t.Fatalf("elided %d-%d:\n%s", from, to, out)
+	}
+
+	// Without a tail the elided range runs to the last line.
+	text = strings.TrimSuffix(text, "t2\n") + "a line too long for the tail\n"
+	Budget{MaxLines: 4, MaxBytes: 8}.Clip(text, func(f, l int) string {
+		from, to = f, l
+		return ""
+	})
+	if from != 2 || to != 24 {
+		t.Fatalf("elided %d-%d without a tail", from, to)
+	}
+}
+
+func TestClipFits(t *testing.T) {
+	var s Store
+	if out, clipped := s.Clip("a\nb\n", DefaultBudget()); clipped || out != "a\nb\n" {
+		t.Fatalf("unexpected clip: %q %v", out, clipped)
+	}
+}
+
+func TestCollapse(t *testing.T) {
+	c := Collapse([]string{"a", "b", "b", "b", "b", "c", "c"})
+	want := []string{"a", "b", "[previous line repeated 3 more times]", "c", "c"}
+	if strings.Join(c.Lines, "|") != strings.Join(want, "|") {
+		t.Fatalf("Collapse = %q", c.Lines)
+	}
+	if fmt.Sprint(c.Source) != "[1 2 3 6 7]" {
+		t.Fatalf("unexpected sources %v", c.Source)
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	id, from, to, ok := ParseRange("@output 2 10-20")
+	if !ok || id != 2 || from != 10 || to != 20 {
+		t.Fatalf("ParseRange = %d %d %d %v", id, from, to, ok)
+	}
+	if _, _, _, ok := ParseRange("ls -la"); ok {
+		t.Fatal("expected ordinary command not to parse")
+	}
+}
+
+type summaryClient struct{}
+
+func (summaryClient) Stream(ctx context.Context, hist []llm.Message) <-chan llm.Chunk {
+	out := make(chan llm.Chunk, 2)
+	out <- llm.Chunk{Text: "100 numbered lines"}
+	out <- llm.Chunk{Done: true}
+	close(out)
+	return out
+}
+
+func TestShrinkSummarizes(t *testing.T) {
+	var s Store
+	b := Budget{MaxLines: 10, SummarizeAbove: 100}
+	out, clipped := s.Shrink(context.Background(), summaryClient{}, "seq", numbered(100), b)
+	if !clipped || !strings.Contains(out, "100 numbered lines") || !strings.Contains(out, "`@output 1 1-100`") {
+		t.Fatalf("unexpected summary: %q", out)
+	}
+}
+
+func TestClipCutsHugeLines(t *testing.T) {
+	huge := strings.Repeat("é", 50000)
+	out := Budget{MaxLines: 10, MaxBytes: 1000}.Clip("start\n"+huge+"\nend\n", func(from, to int) string {
+		return fmt.Sprintf("[elided %d-%d]", from, to)
+	})
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) != 3 || lines[0] != "start" || lines[2] != "[elided 3-3]" {
+		t.Fatalf("unexpected lines:\n%s", out)
+	}
+	if !strings.HasPrefix(lines[1], "éé") || !strings.HasSuffix(lines[1], "… [rest of a 100000-byte line cut]") {
+		t.Fatalf("huge line not cut: %.80q…", lines[1])
+	}
+	if len(out) > 1000 || !utf8.ValidString(out) {
+		t.Fatalf("clipped to %d bytes, valid UTF-8 %v", len(out), utf8.ValidString(out))
+	}
+
+	// A single line longer than the budget is cut rather than elided.
+	var s Store
+	out, clipped := s.Clip(huge, Budget{MaxLines: 10, MaxBytes: 1000})
+	if !clipped || !strings.HasPrefix(out, "éé") || !strings.Contains(out, "line cut") {
+		t.Fatalf("Clip = %.80q…, %v", out, clipped)
+	}
+}
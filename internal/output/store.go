@@ -0,0 +1,79 @@
+package output
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RangeCommand is the pseudo-command the model proposes to read part of a
+// stored output, e.g. "@output 3 120-180".
+const RangeCommand = "@output"
+
+var rangeRe = regexp.MustCompile(`^@output\s+(\d+)\s+(\d+)(?:-(\d+))?\s*$`)
+
+// Store keeps full command outputs so clipped parts can be requested later.
+type Store struct {
+	mu      sync.Mutex
+	outputs []string
+}
+
+// Add stores text and returns its id.
+func (s *Store) Add(text string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.outputs = append(s.outputs, text)
+	return len(s.outputs)
+}
+
+// Clip returns text unchanged if it fits the budget. Otherwise the full text
+// is stored and a clipped copy is returned whose elision marker tells the
+// model how to fetch the missing lines. The bool reports whether text was
+// clipped.
+func (s *Store) Clip(text string, b Budget) (string, bool) {
+	if b.Fits(text) {
+		return text, false
+	}
+	id := s.Add(text)
+	return b.Clip(text, func(from, to int) string {
+		return fmt.Sprintf("[... lines %d-%d elided; propose `%s %d %d-%d` to read them ...]",
+			from, to, RangeCommand, id, from, to)
+	}), true
+}
+
+// Range returns lines from through to (1-based, inclusive) of output id.
+func (s *Store) Range(id, from, to int) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id < 1 || id > len(s.outputs) {
+		return "", fmt.Errorf("no stored output %d", id)
+	}
+	lines := strings.Split(strings.TrimSuffix(s.outputs[id-1], "\n"), "\n")
+	if from < 1 {
+		from = 1
+	}
+	if to == 0 || to > len(lines) {
+		to = len(lines)
+	}
+	if from > to {
+		return "", fmt.Errorf("output %d has %d lines", id, len(lines))
+	}
+	return strings.Join(lines[from-1:to], "\n") + "\n", nil
+}
+
+// ParseRange recognises a RangeCommand. ok is false if command is not one.
+func ParseRange(command string) (id, from, to int, ok bool) {
+	m := rangeRe.FindStringSubmatch(strings.TrimSpace(command))
+	if m == nil {
+		return 0, 0, 0, false
+	}
+	id, _ = strconv.Atoi(m[1])
+	from, _ = strconv.Atoi(m[2])
+	to = from
+	if m[3] != "" {
+		to, _ = strconv.Atoi(m[3])
+	}
+	return id, from, to, true
+}
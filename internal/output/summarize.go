@@ -0,0 +1,56 @@
+package output
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jrcrittenden/ai-shell/llm"
+)
+
+const summaryPrompt = `Summarize the following command output for another assistant that
+needs to act on it. Keep error messages, file names, counts and anything
+unusual verbatim. Answer with the summary only.
+
+Command: %s
+
+Output:
+%s`
+
+// Summarize asks client for a condensed version of a command's output.
+func Summarize(ctx context.Context, client llm.Client, command, text string) (string, error) {
+	hist := []llm.Message{{Role: "user", Content: fmt.Sprintf(summaryPrompt, command, text)}}
+	var sb strings.Builder
+	for chunk := range client.Stream(ctx, hist) {
+		if chunk.Err != nil {
+			return "", chunk.Err
+		}
+		sb.WriteString(chunk.Text)
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
+
+// summaryInput bounds how much text is handed to the summarizing model.
+var summaryInput = Budget{MaxLines: 2000, MaxBytes: 64 << 10}
+
+// Shrink prepares one output stream of command for the model. Output within
+// the budget is returned unchanged; output above b.SummarizeAbove is replaced
+// by a summary from summarizer when one is given; anything else is clipped.
+// The bool reports whether the model received less than the full text.
+func (s *Store) Shrink(ctx context.Context, summarizer llm.Client, command, text string, b Budget) (string, bool) {
+	if b.Fits(text) {
+		return text, false
+	}
+	if summarizer != nil && b.SummarizeAbove > 0 && len(text) > b.SummarizeAbove {
+		id := s.Add(text)
+		input := summaryInput.Clip(text, func(from, to int) string {
+			return fmt.Sprintf("[... lines %d-%d elided ...]", from, to)
+		})
+		if summary, err := Summarize(ctx, summarizer, command, input); err == nil && summary != "" {
+			n := strings.Count(strings.TrimSuffix(text, "\n"), "\n") + 1
+			return fmt.Sprintf("[summary of %d lines; propose `%s %d 1-%d` to read the original]\n%s\n",
+				n, RangeCommand, id, n, summary), true
+		}
+	}
+	return s.Clip(text, b)
+}
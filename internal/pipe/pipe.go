@@ -0,0 +1,84 @@
+// Package pipe turns input piped into ai-shell, such as the output of
+// `kubectl get pods`, into context for the first prompt.
+package pipe
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+
+	"github.com/jrcrittenden/ai-shell/internal/injection"
+	"github.com/jrcrittenden/ai-shell/internal/output"
+)
+
+// DefaultMaxBytes is how much piped input is read when no limit is given.
+const DefaultMaxBytes = 4 << 20
+
+// Input is what was read from a pipe.
+type Input struct {
+	Text string
+	// Truncated is set when the input went on past the read limit; Text
+	// then ends at the last complete line before it.
+	Truncated bool
+}
+
+// Piped reports whether f is a pipe or a file rather than a terminal.
+func Piped(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice == 0
+}
+
+// Read reads r up to max bytes.
+func Read(r io.Reader, max int) (Input, error) {
+	if max <= 0 {
+		max = DefaultMaxBytes
+	}
+	data, err := io.ReadAll(io.LimitReader(r, int64(max)+1))
+	if err != nil {
+		return Input{}, err
+	}
+	if len(data) <= max {
+		return Input{Text: string(data)}, nil
+	}
+	data = data[:max]
+	if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+		data = data[:i+1]
+	}
+	for len(data) > 0 && !utf8.Valid(data) {
+		data = data[:len(data)-1]
+	}
+	return Input{Text: string(data), Truncated: true}, nil
+}
+
+// Lines returns the number of lines of the input.
+func (in Input) Lines() int {
+	if in.Text == "" {
+		return 0
+	}
+	n := bytes.Count([]byte(in.Text), []byte("\n"))
+	if in.Text[len(in.Text)-1] != '\n' {
+		n++
+	}
+	return n
+}
+
+// Block returns the input as a context block for the model: clipped to b,
+// with the full text kept in store so that the model can ask for the
+// missing lines, and marked as untrusted data.
+func (in Input) Block(store *output.Store, b output.Budget) string {
+	text, _ := store.Clip(in.Text, b)
+	if in.Truncated {
+		text += fmt.Sprintf("\n[... input truncated after %d bytes ...]", len(in.Text))
+	}
+	return "Input piped to ai-shell on stdin:\n" + injection.Wrap("input piped to ai-shell on stdin", text)
+}
+
+// Attach puts block before the first prompt.
+func Attach(block, prompt string) string {
+	if block == "" {
+		return prompt
+	}
+	return block + "\n\n" + prompt
+}
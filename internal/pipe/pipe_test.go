@@ -0,0 +1,52 @@
+package pipe
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jrcrittenden/ai-shell/internal/output"
+)
+
+func TestRead(t *testing.T) {
+	in, err := Read(strings.NewReader("a\nb\n"), 10)
+	if err != nil || in.Text != "a\nb\n" || in.Truncated || in.Lines() != 2 {
+		t.Errorf("Read = %+v, %v", in, err)
+	}
+
+	// Input past the limit ends at the last complete line.
+	in, _ = Read(strings.NewReader("first\nsecond\nthird\n"), 10)
+	if in.Text != "first\n" || !in.Truncated {
+		t.Errorf("truncated Read = %+v", in)
+	}
+
+	// A line longer than the limit is cut without splitting a rune.
+	in, _ = Read(strings.NewReader("ééééé"), 5)
+	if in.Text != "éé" || !in.Truncated {
+		t.Errorf("Read of one long line = %q", in.Text)
+	}
+}
+
+func TestBlock(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 100; i++ {
+		lines = append(lines, "pod-"+strings.Repeat("x", i%7))
+	}
+	in := Input{Text: strings.Join(lines, "\n") + "\n", Truncated: true}
+	store := &output.Store{}
+	block := in.Block(store, output.Budget{MaxLines: 10})
+	for _, want := range []string{"Input piped to ai-shell on stdin:", "untrusted-data", "`@output 1 ", "input truncated after"} {
+		if !strings.Contains(block, want) {
+			t.Errorf("block lacks %q:\n%s", want, block)
+		}
+	}
+	if full, err := store.Range(1, 1, 100); err != nil || full != in.Text {
+		t.Errorf("stored input = %q, %v", full, err)
+	}
+
+	if got := Attach("", "why?"); got != "why?" {
+		t.Errorf("Attach without input = %q", got)
+	}
+	if got := Attach("ctx", "why?"); got != "ctx\n\nwhy?" {
+		t.Errorf("Attach = %q", got)
+	}
+}
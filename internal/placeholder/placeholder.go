@@ -0,0 +1,191 @@
+// Package placeholder finds <name>-style parameters that models leave in
+// suggested commands, such as `kubectl logs <pod-name>`, fills them in with
+// safely quoted values and offers completions for them.
+package placeholder
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// Placeholder is one occurrence of a parameter in a command.
+type Placeholder struct {
+	Name string
+	// Start and End are byte offsets of "<name>" in the command.
+	Start, End int
+}
+
+// pattern matches "<name>". Spaces are not allowed so that redirections
+// such as "sort <in >out" are not mistaken for parameters.
+var pattern = regexp.MustCompile(`<([A-Za-z][A-Za-z0-9_.:/-]*)>`)
+
+// Find returns the placeholders in command outside quotes, in order.
+func Find(command string) []Placeholder {
+	quoted := quotedRegions(command)
+	var out []Placeholder
+	for _, m := range pattern.FindAllStringSubmatchIndex(command, -1) {
+		if quoted[m[0]] {
+			continue
+		}
+		// "<<EOF>" and "<<<word>" are here-documents and here-strings.
+		if m[0] > 0 && command[m[0]-1] == '<' {
+			continue
+		}
+		out = append(out, Placeholder{Name: command[m[2]:m[3]], Start: m[0], End: m[1]})
+	}
+	return out
+}
+
+// Names returns the distinct placeholder names in command, in order.
+func Names(command string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, p := range Find(command) {
+		if !seen[p.Name] {
+			seen[p.Name] = true
+			names = append(names, p.Name)
+		}
+	}
+	return names
+}
+
+// Mask turns each "<name>" into "_name_" so that the command parses for
+// analysis while byte offsets stay the same.
+func Mask(command string) string {
+	b := []byte(command)
+	for _, p := range Find(command) {
+		b[p.Start], b[p.End-1] = '_', '_'
+	}
+	return string(b)
+}
+
+// quotedRegions marks the bytes of command inside single or double quotes.
+func quotedRegions(command string) []bool {
+	quoted := make([]bool, len(command)+1)
+	var quote byte
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case quote == 0 && c == '\\':
+			i++
+		case quote == 0 && (c == '\'' || c == '"'):
+			quote = c
+		case quote == '"' && c == '\\':
+			quoted[i] = true
+			i++
+			if i < len(command) {
+				quoted[i] = true
+			}
+		case quote != 0 && c == quote:
+			quote = 0
+		}
+		if quote != 0 && i < len(command) {
+			quoted[i] = true
+		}
+	}
+	return quoted
+}
+
+// Fill replaces every placeholder with its value from values, quoted for
+// bash where necessary. Placeholders without a value are left as they are.
+func Fill(command string, values map[string]string) (string, error) {
+	found := Find(command)
+	var sb strings.Builder
+	last := 0
+	for _, p := range found {
+		value, ok := values[p.Name]
+		if !ok {
+			continue
+		}
+		quoted, err := syntax.Quote(value, syntax.LangBash)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(command[last:p.Start])
+		sb.WriteString(quoted)
+		last = p.End
+	}
+	sb.WriteString(command[last:])
+	return sb.String(), nil
+}
+
+// maxCompletions bounds the suggestions returned for one placeholder.
+const maxCompletions = 200
+
+// completeTimeout bounds each command used to list completions.
+const completeTimeout = 2 * time.Second
+
+// sources map words in a placeholder name to the shell command that lists
+// candidate values. The first matching word wins.
+var sources = []struct {
+	words   []string
+	command string
+}{
+	{[]string{"branch"}, `git for-each-ref --format='%(refname:short)' refs/heads refs/remotes`},
+	{[]string{"tag"}, `git tag --list`},
+	{[]string{"commit", "sha", "rev"}, `git log --format=%h -50`},
+	{[]string{"remote"}, `git remote`},
+	{[]string{"pod"}, `kubectl get pods -o name | sed 's|^pod/||'`},
+	{[]string{"namespace", "ns"}, `kubectl get namespaces -o name | sed 's|^namespace/||'`},
+	{[]string{"deployment", "deploy"}, `kubectl get deployments -o name | sed 's|^deployment.apps/||'`},
+	{[]string{"context"}, `kubectl config get-contexts -o name`},
+	{[]string{"container"}, `docker ps --format '{{.Names}}'`},
+	{[]string{"image"}, `docker images --format '{{.Repository}}:{{.Tag}}'`},
+	{[]string{"service", "unit"}, `systemctl list-units --type=service --no-legend --plain | cut -d' ' -f1`},
+	{[]string{"user", "username"}, `compgen -u`},
+	{[]string{"group"}, `compgen -g`},
+	{[]string{"host", "hostname"}, `compgen -A hostname`},
+	{[]string{"pid", "process"}, `ps -eo pid= | tr -d ' '`},
+	{[]string{"dir", "directory", "folder"}, `compgen -d`},
+	{[]string{"command", "cmd", "program"}, `compgen -c`},
+}
+
+// Complete lists candidate values for the placeholder name, chosen from
+// its words ("pod-name" completes pods). Names that match nothing
+// complete files in dir.
+func Complete(ctx context.Context, name, dir string) []string {
+	command := `compgen -f`
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return r == '-' || r == '_' || r == '.' || r == ':' || r == '/'
+	})
+find:
+	for _, s := range sources {
+		for _, w := range s.words {
+			if slices.Contains(words, w) {
+				command = s.command
+				break find
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, completeTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "bash", "-c", command)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil && len(out) == 0 {
+		return nil
+	}
+	seen := map[string]bool{}
+	var values []string
+	for _, line := range strings.Split(string(bytes.TrimSpace(out)), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !seen[line] {
+			seen[line] = true
+			values = append(values, line)
+		}
+	}
+	sort.Strings(values)
+	if len(values) > maxCompletions {
+		values = values[:maxCompletions]
+	}
+	return values
+}
@@ -0,0 +1,80 @@
+package placeholder
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNames(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{"kubectl logs <pod-name> -n <namespace>", []string{"pod-name", "namespace"}},
+		{"git checkout <branch> && git pull origin <branch>", []string{"branch"}},
+		{"sort <in >out", nil},
+		{"echo '<html>' \"<b>\"", nil},
+		{"cat <<EOF>", nil},
+		{"grep foo < file.txt", nil},
+	}
+	for _, tt := range tests {
+		if got := Names(tt.command); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Names(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestMask(t *testing.T) {
+	if got := Mask("kubectl logs <pod> > '<x>'"); got != "kubectl logs _pod_ > '<x>'" {
+		t.Fatalf("Mask = %q", got)
+	}
+}
+
+func TestFillQuotes(t *testing.T) {
+	got, err := Fill("git checkout <branch> && git log <branch> -- <path>", map[string]string{
+		"branch": "feature/x",
+		"path":   "my file; rm -rf ~",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `git checkout feature/x && git log feature/x -- 'my file; rm -rf ~'`
+	if got != want {
+		t.Fatalf("Fill = %q, want %q", got, want)
+	}
+
+	got, _ = Fill("cp <src> <dst>", map[string]string{"src": "a"})
+	if got != "cp a <dst>" {
+		t.Fatalf("unfilled placeholder should remain, got %q", got)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "alpha.txt"), nil, 0o644)
+	os.Mkdir(filepath.Join(dir, "beta"), 0o755)
+
+	if got := Complete(context.Background(), "file", dir); !reflect.DeepEqual(got, []string{"alpha.txt", "beta"}) {
+		t.Errorf("file completions = %q", got)
+	}
+	if got := Complete(context.Background(), "target-dir", dir); !reflect.DeepEqual(got, []string{"beta"}) {
+		t.Errorf("dir completions = %q", got)
+	}
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	for _, args := range [][]string{{"init", "-q", "-b", "main"}, {"checkout", "-q", "-b", "topic"}} {
+		if err := exec.Command("git", append([]string{"-C", dir}, args...)...).Run(); err != nil {
+			t.Skip("git unusable:", err)
+		}
+	}
+	exec.Command("git", "-C", dir, "-c", "user.name=t", "-c", "user.email=t@t", "commit", "-q", "--allow-empty", "-m", "x").Run()
+	if got := Complete(context.Background(), "branch-name", dir); !reflect.DeepEqual(got, []string{"topic"}) {
+		t.Errorf("branch completions = %q", got)
+	}
+}
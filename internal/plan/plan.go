@@ -0,0 +1,239 @@
+// Package plan lets the model lay out a bigger task as a list of steps,
+// each with the command it intends to run, which the user reviews before
+// the steps run one by one.
+package plan
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jrcrittenden/ai-shell/llm"
+)
+
+// maxSteps is the longest plan the model is asked for.
+const maxSteps = 12
+
+// Status is the progress of a step.
+type Status int
+
+const (
+	Pending Status = iota
+	Running
+	Done
+	Failed
+	// Skipped steps were dropped when the plan stopped.
+	Skipped
+)
+
+// Mark returns the checklist mark for s.
+func (s Status) Mark() string {
+	switch s {
+	case Running:
+		return "[…]"
+	case Done:
+		return "[✓]"
+	case Failed:
+		return "[✗]"
+	case Skipped:
+		return "[-]"
+	}
+	return "[ ]"
+}
+
+// Step is one command of a plan.
+type Step struct {
+	Title   string `json:"title"`
+	Command string `json:"command"`
+	Status  Status `json:"-"`
+	// Result says how the step ended, e.g. "exit 1" or why it was not run.
+	Result string `json:"-"`
+}
+
+// Plan is a list of steps towards a goal.
+type Plan struct {
+	Goal  string
+	Steps []Step
+	// Stopped gives the reason the plan ended; it is empty while the plan
+	// is active.
+	Stopped string
+}
+
+// New starts a plan for goal without any steps yet.
+func New(goal string) *Plan {
+	return &Plan{Goal: goal}
+}
+
+// Active reports whether the plan has not stopped.
+func (p *Plan) Active() bool {
+	return p != nil && p.Stopped == ""
+}
+
+// Stop ends the plan for reason unless it has already ended. Steps that
+// did not run are marked skipped.
+func (p *Plan) Stop(reason string) {
+	if p.Stopped != "" {
+		return
+	}
+	p.Stopped = reason
+	for i := range p.Steps {
+		if p.Steps[i].Status == Pending || p.Steps[i].Status == Running {
+			p.Steps[i].Status = Skipped
+		}
+	}
+}
+
+// Next returns the index of the first pending step, or -1 if there is
+// none.
+func (p *Plan) Next() int {
+	return p.find(Pending)
+}
+
+// Current returns the index of the running step, or -1 if there is none.
+func (p *Plan) Current() int {
+	return p.find(Running)
+}
+
+func (p *Plan) find(s Status) int {
+	for i, st := range p.Steps {
+		if st.Status == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// Replace swaps the steps that have not run yet for steps, as after the
+// model revised the plan. Steps that ran are kept.
+func (p *Plan) Replace(steps []Step) {
+	var kept []Step
+	for _, st := range p.Steps {
+		if st.Status != Pending {
+			kept = append(kept, st)
+		}
+	}
+	for _, st := range steps {
+		st.Status, st.Result = Pending, ""
+		kept = append(kept, st)
+	}
+	p.Steps = kept
+}
+
+// Progress counts the steps that are done out of all steps.
+func (p *Plan) Progress() string {
+	done := 0
+	for _, st := range p.Steps {
+		if st.Status == Done {
+			done++
+		}
+	}
+	return fmt.Sprintf("%d/%d", done, len(p.Steps))
+}
+
+const prompt = `Make a plan for the following task before running anything. Break it
+into a short sequence of shell commands, one per step, in the order they
+should run. The user reviews and edits the plan, then each step runs once
+the previous one has succeeded, so later steps may rely on earlier ones.
+Use at most %d steps and prefer commands that are safe to run again.
+
+Answer with JSON only, in this form:
+{"steps": [{"title": "<what the step does>", "command": "<shell command>"}]}
+
+Task: %s`
+
+// Prompt returns the request for a plan towards goal.
+func Prompt(goal string) string {
+	return fmt.Sprintf(prompt, maxSteps, goal)
+}
+
+// ReplanPrompt asks for new steps after the step at index failed for
+// reason.
+func ReplanPrompt(p *Plan, failed int, reason string) string {
+	var b strings.Builder
+	st := p.Steps[failed]
+	fmt.Fprintf(&b, "Step %d of the plan (%s: `%s`) failed: %s.\n", failed+1, st.Title, st.Command, reason)
+	var done []string
+	for _, s := range p.Steps {
+		if s.Status == Done {
+			done = append(done, fmt.Sprintf("- %s: `%s`", s.Title, s.Command))
+		}
+	}
+	if len(done) > 0 {
+		fmt.Fprintf(&b, "These steps succeeded and must not be repeated:\n%s\n", strings.Join(done, "\n"))
+	}
+	fmt.Fprintf(&b, `Make a new plan for the rest of the task (%s), taking the failure into account. Answer with JSON only, in the same form as before.`, p.Goal)
+	return b.String()
+}
+
+// Approved tells the model which steps the user approved, which may differ
+// from the ones it proposed.
+func Approved(p *Plan) string {
+	var b strings.Builder
+	b.WriteString("I reviewed the plan and approved these steps. They run one after another and you get each result; do not propose commands until asked.")
+	for i, st := range p.Steps {
+		if st.Status == Pending {
+			fmt.Fprintf(&b, "\n%d. %s: `%s`", i+1, st.Title, st.Command)
+		}
+	}
+	return b.String()
+}
+
+// Request sends history, which should end with a Prompt or ReplanPrompt, to
+// client and returns the steps of its answer along with the answer's text.
+// A model that proposes commands with tool calls instead of answering with
+// JSON gets one step per call.
+func Request(ctx context.Context, client llm.Client, history []llm.Message) ([]Step, string, error) {
+	var answer strings.Builder
+	var calls []Step
+	for chunk := range client.Stream(ctx, history) {
+		if chunk.Err != nil {
+			return nil, answer.String(), chunk.Err
+		}
+		answer.WriteString(chunk.Text)
+		if c := chunk.ToolCall; c != nil {
+			title := c.Reason
+			if title == "" {
+				title = c.Command
+			}
+			calls = append(calls, Step{Title: title, Command: c.Command})
+		}
+	}
+	steps, err := Parse(answer.String())
+	if err != nil && len(calls) > 0 {
+		return calls, answer.String(), nil
+	}
+	return steps, answer.String(), err
+}
+
+// Parse extracts the steps from the JSON object in answer, tolerating code
+// fences and text around it. Steps without a command are dropped.
+func Parse(answer string) ([]Step, error) {
+	var p struct {
+		Steps []Step `json:"steps"`
+	}
+	start, end := strings.Index(answer, "{"), strings.LastIndex(answer, "}")
+	if start < 0 || end < start {
+		return nil, errors.New("the answer contains no plan")
+	}
+	if err := json.Unmarshal([]byte(answer[start:end+1]), &p); err != nil {
+		return nil, fmt.Errorf("the answer contains no valid plan: %w", err)
+	}
+	var steps []Step
+	for _, st := range p.Steps {
+		st.Command = strings.TrimSpace(st.Command)
+		st.Title = strings.TrimSpace(st.Title)
+		if st.Command == "" {
+			continue
+		}
+		if st.Title == "" {
+			st.Title = st.Command
+		}
+		steps = append(steps, st)
+	}
+	if len(steps) == 0 {
+		return nil, errors.New("the plan has no steps")
+	}
+	return steps, nil
+}
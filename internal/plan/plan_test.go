@@ -0,0 +1,105 @@
+package plan
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jrcrittenden/ai-shell/llm"
+)
+
+func TestParse(t *testing.T) {
+	answer := "Here is the plan:\n```json\n" + `{"steps": [
+  {"title": "Install Go", "command": "brew install go"},
+  {"title": "", "command": "go version"},
+  {"title": "Nothing to run", "command": "  "}
+]}` + "\n```"
+	steps, err := Parse(answer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Step{
+		{Title: "Install Go", Command: "brew install go"},
+		{Title: "go version", Command: "go version"},
+	}
+	if !reflect.DeepEqual(steps, want) {
+		t.Errorf("Parse = %+v\nwant %+v", steps, want)
+	}
+
+	for _, bad := range []string{"I would start by installing Go.", `{"steps": []}`, `{"steps": [`} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("Parse(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestProgress(t *testing.T) {
+	p := New("set up the project")
+	p.Replace([]Step{{Title: "a", Command: "true"}, {Title: "b", Command: "false"}, {Title: "c", Command: "make"}})
+	if p.Next() != 0 || p.Current() != -1 {
+		t.Fatalf("Next = %d, Current = %d", p.Next(), p.Current())
+	}
+	p.Steps[0].Status = Done
+	if got := Approved(p); !strings.HasSuffix(got, "\n2. b: `false`\n3. c: `make`") {
+		t.Errorf("Approved lists the wrong steps:\n%s", got)
+	}
+	p.Steps[1].Status = Failed
+	p.Steps[1].Result = "exit 1"
+
+	prompt := ReplanPrompt(p, 1, "exit 1")
+	for _, want := range []string{"Step 2 of the plan (b: `false`) failed: exit 1.", "- a: `true`", "set up the project"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("ReplanPrompt lacks %q:\n%s", want, prompt)
+		}
+	}
+
+	// A new plan replaces only the steps that have not run.
+	p.Replace([]Step{{Title: "d", Command: "make fix", Status: Done, Result: "stale"}})
+	var got []string
+	for _, st := range p.Steps {
+		got = append(got, st.Title+" "+st.Status.Mark())
+	}
+	if want := []string{"a [✓]", "b [✗]", "d [ ]"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("steps after Replace = %q, want %q", got, want)
+	}
+	if p.Progress() != "1/3" {
+		t.Errorf("Progress = %q", p.Progress())
+	}
+
+	p.Steps[2].Status = Running
+	p.Stop("interrupted")
+	p.Stop("later")
+	if p.Active() || p.Stopped != "interrupted" || p.Steps[2].Status != Skipped {
+		t.Errorf("after Stop: %q, %+v", p.Stopped, p.Steps[2])
+	}
+	var none *Plan
+	if none.Active() {
+		t.Error("nil plan is active")
+	}
+}
+
+// callClient answers with tool calls instead of a JSON plan.
+type callClient struct{}
+
+func (callClient) Stream(ctx context.Context, hist []llm.Message) <-chan llm.Chunk {
+	out := make(chan llm.Chunk, 3)
+	out <- llm.Chunk{Text: "First check the version."}
+	out <- llm.Chunk{ToolCall: &llm.ToolCall{Command: "go version", Reason: "Check Go"}}
+	out <- llm.Chunk{Done: true}
+	close(out)
+	return out
+}
+
+func TestRequestToolCalls(t *testing.T) {
+	steps, text, err := Request(context.Background(), callClient{}, []llm.Message{{Role: "user", Content: Prompt("check go")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Step{{Title: "Check Go", Command: "go version"}}; !reflect.DeepEqual(steps, want) {
+		t.Errorf("steps = %+v", steps)
+	}
+	if text != "First check the version." {
+		t.Errorf("text = %q", text)
+	}
+}
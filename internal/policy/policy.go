@@ -0,0 +1,351 @@
+// Package policy decides what happens to a proposed command before the
+// approval dialog is shown: run it straight away, ask, ask for the command
+// name to be typed, or refuse it outright.
+//
+// Policies are JSON files:
+//
+//	{
+//	  "default": "confirm",
+//	  "rules": [
+//	    {"name": "git status", "command": "git", "args": "^status( -s| --short)*$", "action": "allow"},
+//	    {"risk": "critical", "action": "deny", "message": "Find a safer way."},
+//	    {"classes": ["destructive"], "action": "type"}
+//	  ]
+//	}
+//
+// Rules are tried in order and the first match decides. command and args
+// are checked against every simple command of the line: an allow rule only
+// matches if all of them match, any other rule if one of them does. An
+// allow rule never matches a command above low risk, one that deletes or
+// writes outside the project, or one that redirects output to a file.
+//
+// Commands the user chose to always allow are kept apart from the policy,
+// in a file of ai-shell's own (see AllowedPath), so that the policy file is
+// never rewritten.
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/jrcrittenden/ai-shell/internal/risk"
+)
+
+// Action is the outcome of a rule.
+type Action string
+
+const (
+	// Allow runs the command without asking.
+	Allow Action = "allow"
+	// Confirm shows the approval dialog.
+	Confirm Action = "confirm"
+	// Type shows the dialog and additionally requires the user to type
+	// the command name to approve.
+	Type Action = "type"
+	// Deny refuses the command and sends the message back to the model.
+	Deny Action = "deny"
+)
+
+func (a Action) valid() bool {
+	switch a {
+	case Allow, Confirm, Type, Deny:
+		return true
+	}
+	return false
+}
+
+// Rule matches proposed commands. Empty fields match anything.
+type Rule struct {
+	Name string `json:"name,omitempty"`
+	// Command is a glob matched against the name of each simple command.
+	Command string `json:"command,omitempty"`
+	// Args is a regular expression matched against the space separated
+	// arguments of each simple command.
+	Args string `json:"args,omitempty"`
+	// Pattern is a regular expression matched against the full command.
+	Pattern string `json:"pattern,omitempty"`
+	// Cwd is a glob matched against the working directory. A trailing
+	// "/**" also matches every directory below.
+	Cwd string `json:"cwd,omitempty"`
+	// Risk matches commands at or above this level.
+	Risk string `json:"risk,omitempty"`
+	// Classes matches commands with a finding in any of these classes.
+	Classes []string `json:"classes,omitempty"`
+
+	Action  Action `json:"action"`
+	Message string `json:"message,omitempty"`
+
+	args    *regexp.Regexp
+	pattern *regexp.Regexp
+	risk    risk.Level
+}
+
+// Policy is an ordered list of rules.
+type Policy struct {
+	Default Action `json:"default,omitempty"`
+	Rules   []Rule `json:"rules"`
+	// AllowHosts lists the hosts commands may send data to without extra
+	// confirmation, e.g. "*.github.com".
+	AllowHosts []string `json:"allow_hosts,omitempty"`
+}
+
+// Input is a proposed command together with what is known about it.
+type Input struct {
+	Command string
+	Dir     string
+	Risk    risk.Report
+}
+
+// Decision is the result of evaluating a policy.
+type Decision struct {
+	Action Action
+	// Rule names the rule that matched; it is empty for the default.
+	Rule    string
+	Message string
+}
+
+// Default returns the policy used when no file is configured: every
+// command goes through the approval dialog.
+func Default() *Policy {
+	return &Policy{Default: Confirm}
+}
+
+// Load reads and validates a policy file.
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("policy %s: %w", path, err)
+	}
+	if err := p.compile(); err != nil {
+		return nil, fmt.Errorf("policy %s: %w", path, err)
+	}
+	return &p, nil
+}
+
+// DefaultPath returns the policy file looked up when --policy is not given.
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ai-shell", "policy.json")
+}
+
+func (p *Policy) compile() error {
+	if p.Default == "" {
+		p.Default = Confirm
+	}
+	if !p.Default.valid() {
+		return fmt.Errorf("unknown default action %q", p.Default)
+	}
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if !r.Action.valid() {
+			return fmt.Errorf("%s: unknown action %q", r.Name, r.Action)
+		}
+		var err error
+		if r.Args != "" {
+			if r.args, err = regexp.Compile(r.Args); err != nil {
+				return fmt.Errorf("%s: args: %w", r.Name, err)
+			}
+		}
+		if r.Pattern != "" {
+			if r.pattern, err = regexp.Compile(r.Pattern); err != nil {
+				return fmt.Errorf("%s: pattern: %w", r.Name, err)
+			}
+		}
+		if r.Risk != "" {
+			if r.risk, err = risk.ParseLevel(r.Risk); err != nil {
+				return fmt.Errorf("%s: %w", r.Name, err)
+			}
+		}
+		if r.Command != "" {
+			if _, err := filepath.Match(r.Command, ""); err != nil {
+				return fmt.Errorf("%s: command: %w", r.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// AllowCommand adds a rule in front of the others that allows exactly
+// command from now on.
+func (p *Policy) AllowCommand(command string) {
+	r := Rule{
+		Name:    "always allow " + command,
+		Pattern: "^" + regexp.QuoteMeta(command) + "$",
+		Action:  Allow,
+	}
+	r.pattern = regexp.MustCompile(r.Pattern)
+	p.Rules = append([]Rule{r}, p.Rules...)
+}
+
+// AllowedPath returns the file the commands allowed with "always allow" are
+// saved to.
+func AllowedPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ai-shell", "allowed.json")
+}
+
+// allowedFile is the format of the AllowedPath file.
+type allowedFile struct {
+	Commands []string `json:"commands"`
+}
+
+func readAllowed(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f allowedFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("allowed commands %s: %w", path, err)
+	}
+	return f.Commands, nil
+}
+
+// LoadAllowed allows the commands saved to path by SaveAllowed, as
+// AllowCommand does. A missing file allows nothing.
+func (p *Policy) LoadAllowed(path string) error {
+	commands, err := readAllowed(path)
+	if err != nil {
+		return err
+	}
+	for _, c := range commands {
+		p.AllowCommand(c)
+	}
+	return nil
+}
+
+// SaveAllowed adds command to the commands saved in path, creating the
+// file and its directory if necessary.
+func SaveAllowed(path, command string) error {
+	commands, err := readAllowed(path)
+	if err != nil || slices.Contains(commands, command) {
+		return err
+	}
+	data, err := json.MarshalIndent(allowedFile{Commands: append(commands, command)}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+// Evaluate returns the decision of the first matching rule, or the default.
+func (p *Policy) Evaluate(in Input) Decision {
+	cmds, err := risk.Commands(in.Command)
+	for _, r := range p.Rules {
+		if r.matches(in, cmds, err == nil) {
+			return Decision{Action: r.Action, Rule: r.Name, Message: r.Message}
+		}
+	}
+	return Decision{Action: p.Default}
+}
+
+func (r *Rule) matches(in Input, cmds []risk.Command, parsed bool) bool {
+	if r.Action == Allow && !Allowable(in) {
+		return false
+	}
+	if r.pattern != nil && !r.pattern.MatchString(in.Command) {
+		return false
+	}
+	if r.Cwd != "" && !matchDir(r.Cwd, in.Dir) {
+		return false
+	}
+	if r.Risk != "" && in.Risk.Level < r.risk {
+		return false
+	}
+	if len(r.Classes) > 0 {
+		found := false
+		for _, c := range r.Classes {
+			found = found || in.Risk.Has(c)
+		}
+		if !found {
+			return false
+		}
+	}
+	if r.Command == "" && r.args == nil {
+		return true
+	}
+	if !parsed || len(cmds) == 0 {
+		return false
+	}
+	// Allowing must hold for every part of the line; anything else only
+	// needs one part to match.
+	all := r.Action == Allow
+	for _, c := range cmds {
+		ok := r.matchCommand(c)
+		if ok && !all {
+			return true
+		}
+		if !ok && all {
+			return false
+		}
+	}
+	return all
+}
+
+// Allowable reports whether in may be run without asking at all: allow
+// rules, including those of always-allowed commands, only apply to low-risk
+// commands that write nothing but /dev/null.
+func Allowable(in Input) bool {
+	if in.Risk.Level > risk.Low || in.Risk.Has(risk.ClassDestructive) || in.Risk.Has(risk.ClassOutsideProject) {
+		return false
+	}
+	targets, err := risk.Redirects(in.Command)
+	if err != nil {
+		return false
+	}
+	for _, t := range targets {
+		if t != "/dev/null" {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Rule) matchCommand(c risk.Command) bool {
+	if r.Command != "" {
+		if ok, _ := filepath.Match(r.Command, c.Name); !ok {
+			return false
+		}
+	}
+	return r.args == nil || r.args.MatchString(strings.Join(c.Args, " "))
+}
+
+func matchDir(pattern, dir string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+		if ok, _ := filepath.Match(prefix, dir); ok {
+			return true
+		}
+		for d := dir; d != filepath.Dir(d); d = filepath.Dir(d) {
+			if ok, _ := filepath.Match(prefix, d); ok {
+				return true
+			}
+		}
+		return false
+	}
+	ok, _ := filepath.Match(pattern, dir)
+	return ok
+}
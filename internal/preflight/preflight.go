@@ -0,0 +1,340 @@
+// Package preflight catches proposed commands that cannot work before the
+// user is asked about them: syntax errors, programs that do not exist and
+// files that are not there.
+//
+// The checks err on the side of passing. A command is only rejected for a
+// missing path when nothing earlier in it could have created the path or
+// changed directory.
+package preflight
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jrcrittenden/ai-shell/internal/risk"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// Problem kinds.
+const (
+	Syntax  = "syntax"
+	Command = "command"
+	Path    = "path"
+)
+
+// Problem is one reason a command would fail.
+type Problem struct {
+	Kind    string
+	Message string
+}
+
+func (p Problem) String() string {
+	return p.Kind + ": " + p.Message
+}
+
+// Options describe the environment the command would run in.
+type Options struct {
+	Dir  string
+	Home string
+	// Aliases are names defined in the user's interactive shell.
+	Aliases map[string]bool
+}
+
+// checkTimeout bounds each shell invoked by the checks.
+const checkTimeout = 2 * time.Second
+
+// creators may legitimately be given paths that do not exist yet.
+var creators = map[string]bool{
+	"mkdir": true, "touch": true, "cp": true, "mv": true, "ln": true, "install": true,
+	"tee": true, "git": true, "rsync": true, "scp": true, "curl": true, "wget": true,
+	"tar": true, "unzip": true, "dd": true, "truncate": true, "mktemp": true, "mkfifo": true,
+	"docker": true, "go": true, "npm": true, "pip": true, "cargo": true, "make": true,
+}
+
+// Check runs all checks on command and returns the problems found.
+func Check(ctx context.Context, command string, opts Options) []Problem {
+	if msg := syntaxError(ctx, command); msg != "" {
+		return []Problem{{Kind: Syntax, Message: msg}}
+	}
+	f, err := syntax.NewParser().Parse(strings.NewReader(command), "")
+	if err != nil {
+		return []Problem{{Kind: Syntax, Message: err.Error()}}
+	}
+	cmds, err := risk.Commands(command)
+	if err != nil {
+		return nil
+	}
+	problems := missingCommands(ctx, f, cmds, opts)
+	return append(problems, missingPaths(f, cmds, opts)...)
+}
+
+// syntaxError returns bash's complaint about command, if any.
+func syntaxError(ctx context.Context, command string) string {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "bash", "-n", "-c", command)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err == nil || ctx.Err() != nil {
+		return ""
+	}
+	msg := strings.TrimSpace(stderr.String())
+	msg = strings.TrimPrefix(msg, "bash: -c: ")
+	if msg == "" {
+		msg = "bash -n rejected the command"
+	}
+	return msg
+}
+
+// missingCommands reports programs that are neither on PATH, a builtin,
+// keyword or function, an alias, nor defined by command itself.
+func missingCommands(ctx context.Context, f *syntax.File, cmds []risk.Command, opts Options) []Problem {
+	defined := map[string]bool{}
+	syntax.Walk(f, func(node syntax.Node) bool {
+		if fn, ok := node.(*syntax.FuncDecl); ok {
+			defined[fn.Name.Value] = true
+		}
+		return true
+	})
+
+	var unknown []string
+	seen := map[string]bool{}
+	for _, c := range cmds {
+		name := c.Name
+		if seen[name] || defined[name] || opts.Aliases[name] || !literalWord(name) {
+			continue
+		}
+		seen[name] = true
+		if strings.Contains(c.Program, "/") {
+			continue
+		}
+		if _, err := exec.LookPath(name); err == nil {
+			continue
+		}
+		unknown = append(unknown, name)
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	// Builtins and keywords are known to bash but not on PATH.
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "bash", append([]string{"-c", `for n; do type -t -- "$n" >/dev/null 2>&1 || echo "$n"; done`, "bash"}, unknown...)...).Output()
+	if err != nil {
+		return nil
+	}
+	var problems []Problem
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		problems = append(problems, Problem{Kind: Command, Message: fmt.Sprintf("%s: command not found", s.Text())})
+	}
+	return problems
+}
+
+// readers are programs whose operands are files that must exist.
+var readers = map[string]bool{
+	"cat": true, "less": true, "more": true, "head": true, "tail": true, "source": true, ".": true,
+	"ls": true, "cd": true, "pushd": true, "stat": true, "wc": true, "diff": true, "sort": true,
+	"uniq": true, "file": true, "chmod": true, "chown": true, "chgrp": true, "du": true,
+	"bash": true, "sh": true, "zsh": true, "python": true, "python3": true, "node": true, "ruby": true, "perl": true,
+}
+
+// interpreters take a script followed by the script's own arguments. The
+// value lists the short options after which the arguments are code or a
+// module rather than a script, as in python3 -m or node -e.
+var interpreters = map[string]string{
+	"bash": "c", "sh": "c", "zsh": "c", "python": "cm", "python3": "cm", "node": "epr", "ruby": "er", "perl": "eE",
+}
+
+// codeOptions are the long forms of the interpreter options that take code
+// or a module.
+var codeOptions = map[string]bool{"--eval": true, "--print": true, "--require": true}
+
+// patterns are programs whose arguments are often patterns or text that
+// only look like paths.
+var patterns = map[string]bool{
+	"grep": true, "egrep": true, "fgrep": true, "rg": true, "ag": true, "sed": true, "awk": true,
+	"gawk": true, "echo": true, "printf": true, "jq": true, "yq": true, "test": true, "[": true,
+	"[[": true, "find": true, "git": true, "curl": true, "wget": true, "ssh": true,
+}
+
+// missingPaths reports program paths, reader operands and redirection
+// sources that do not exist, and other path arguments whose directory does
+// not exist. Checking stops at the first command that changes directory
+// or may create files.
+func missingPaths(f *syntax.File, cmds []risk.Command, opts Options) []Problem {
+	stop := int(f.End().Offset()) + 1
+	for _, c := range cmds {
+		switch {
+		case c.Name == "cd" || c.Name == "pushd":
+			stop = min(stop, c.Span.End)
+		case creators[c.Name]:
+			stop = min(stop, c.Span.Start)
+		}
+	}
+	var redirs []*syntax.Redirect
+	syntax.Walk(f, func(node syntax.Node) bool {
+		if r, ok := node.(*syntax.Redirect); ok {
+			redirs = append(redirs, r)
+			if r.Op == syntax.RdrOut || r.Op == syntax.AppOut || r.Op == syntax.RdrAll || r.Op == syntax.AppAll || r.Op == syntax.ClbOut {
+				stop = min(stop, int(r.End().Offset()))
+			}
+		}
+		return true
+	})
+
+	var problems []Problem
+	report := func(format string, args ...any) {
+		problems = append(problems, Problem{Kind: Path, Message: fmt.Sprintf(format, args...)})
+	}
+	for _, c := range cmds {
+		if c.Span.Start >= stop {
+			break
+		}
+		if strings.Contains(c.Program, "/") && literalWord(c.Program) {
+			info, err := os.Stat(resolve(c.Program, opts))
+			switch {
+			case err != nil:
+				report("%s: no such file", c.Program)
+			case info.IsDir() || info.Mode()&0o111 == 0:
+				report("%s: not executable", c.Program)
+			}
+		}
+		if patterns[c.Name] {
+			continue
+		}
+		for _, arg := range c.Args {
+			if short, ok := interpreters[c.Name]; ok && runsCode(arg, short) {
+				// The rest is code, a module or its arguments.
+				break
+			}
+			if strings.HasPrefix(arg, "-") || !literalWord(arg) {
+				continue
+			}
+			switch {
+			case readers[c.Name] && (strings.ContainsAny(arg, "/.") || c.Name == "cd"):
+				if !exists(resolve(arg, opts)) {
+					report("%s: no such file or directory", arg)
+				}
+			case pathLike(arg):
+				if dir := filepath.Dir(resolve(arg, opts)); !exists(dir) {
+					report("%s: directory %s does not exist", arg, dir)
+				}
+			}
+			if _, ok := interpreters[c.Name]; ok {
+				// Only the script is a file; the rest are its arguments.
+				break
+			}
+		}
+	}
+	for _, r := range redirs {
+		if int(r.Pos().Offset()) >= stop || r.Word == nil {
+			continue
+		}
+		target, ok := wordValue(r.Word)
+		if !ok || target == "/dev/null" || r.Op == syntax.DplIn || r.Op == syntax.DplOut {
+			continue
+		}
+		switch r.Op {
+		case syntax.RdrIn:
+			if !exists(resolve(target, opts)) {
+				report("< %s: no such file", target)
+			}
+		case syntax.RdrOut, syntax.AppOut, syntax.RdrAll, syntax.AppAll, syntax.ClbOut:
+			if dir := filepath.Dir(resolve(target, opts)); !exists(dir) {
+				report("> %s: directory %s does not exist", target, dir)
+			}
+		}
+	}
+	return problems
+}
+
+// runsCode reports whether arg is an interpreter option that takes code or
+// a module, given the interpreter's short options for them.
+func runsCode(arg, short string) bool {
+	name, _, _ := strings.Cut(arg, "=")
+	switch {
+	case strings.HasPrefix(arg, "--"):
+		return codeOptions[name]
+	case strings.HasPrefix(arg, "-") && len(arg) > 1:
+		return strings.ContainsAny(arg[1:], short)
+	}
+	return false
+}
+
+// literalWord reports whether s, as returned by risk.Commands, is plain
+// text without expansions, globs or quotes.
+func literalWord(s string) bool {
+	return s != "" && !strings.ContainsAny(s, "$`*?[]{}'\"\\ \t\n")
+}
+
+// pathLike reports whether arg is written as a path.
+func pathLike(arg string) bool {
+	if strings.Contains(arg, "://") {
+		return false
+	}
+	for _, prefix := range []string{"/", "./", "../", "~/"} {
+		if strings.HasPrefix(arg, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// wordValue returns the literal value of w.
+func wordValue(w *syntax.Word) (string, bool) {
+	if lit := w.Lit(); lit != "" {
+		return lit, literalWord(lit)
+	}
+	return "", false
+}
+
+// resolve makes path absolute relative to the options' directories.
+func resolve(path string, opts Options) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		path = filepath.Join(opts.Home, path[1:])
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(opts.Dir, path)
+	}
+	return path
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Aliases returns the names of the aliases defined in the user's
+// interactive shell, or nil if they cannot be determined quickly.
+func Aliases(ctx context.Context) map[string]bool {
+	shell := filepath.Base(os.Getenv("SHELL"))
+	if shell != "bash" && shell != "zsh" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, os.Getenv("SHELL"), "-ic", "alias")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil
+	}
+	aliases := map[string]bool{}
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		// bash prints "alias ll='ls -l'", zsh "ll='ls -l'".
+		name, _, ok := strings.Cut(strings.TrimPrefix(s.Text(), "alias "), "=")
+		if ok {
+			aliases[name] = true
+		}
+	}
+	return aliases
+}
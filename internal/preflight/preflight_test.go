@@ -0,0 +1,71 @@
+package preflight
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hi\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "run.sh"), []byte("#!/bin/sh\n"), 0o755)
+	os.WriteFile(filepath.Join(dir, "data.csv"), []byte("a,b\n"), 0o644)
+	opts := Options{Dir: dir, Home: dir, Aliases: map[string]bool{"ll": true}}
+
+	tests := []struct {
+		command string
+		kind    string // empty when the command should pass
+		message string
+	}{
+		{"cat notes.txt | wc -l", "", ""},
+		{"ll && cd / && pwd", "", ""},
+		{"f() { echo hi; }; f", "", ""},
+		{"./run.sh --fast", "", ""},
+		{"sed -i 's/a/b/' notes.txt", "", ""},
+		{"grep -r /api/v1 .", "", ""},
+		{"sort < data.csv > ./sorted.csv", "", ""},
+		{"mkdir -p build/out && cd build/out && cat ../../notes.txt", "", ""},
+		{"echo hi > /tmp/x && cat /tmp/x", "", ""},
+		{"python3 -c 'print(1)'", "", ""},
+		{"python3 -m http.server 8000", "", ""},
+		{"python3 -m json.tool data.json", "", ""},
+		{"python3 -m json.tool missing.json", "", ""},
+		{"node -e 'console.log(1)'", "", ""},
+		{"node --eval 'console.log(1)' missing.js", "", ""},
+		{"perl -pe 's/a/b/' notes.txt", "", ""},
+		{"bash -ec 'cat notes.txt'", "", ""},
+		{"python3 -u missing.py", Path, "missing.py: no such file"},
+		{"bash -e missing.sh", Path, "missing.sh: no such file"},
+		{"echo 'unterminated", Syntax, "unexpected EOF"},
+		{"if true; then echo; fi fi", Syntax, ""},
+		{"gsed -i s/a/b/ notes.txt", Command, "gsed: command not found"},
+		{"cat missing.txt", Path, "missing.txt: no such file"},
+		{"cd nowhere && ls", Path, "nowhere: no such file"},
+		{"./missing.sh", Path, "./missing.sh: no such file"},
+		{"./notes.txt", Path, "not executable"},
+		{"wc -l < nothing.csv", Path, "< nothing.csv"},
+		{"echo hi > ./no/such/dir/out.txt", Path, "does not exist"},
+		{"gcc -o ./bin/prog main.c", Path, "does not exist"},
+	}
+	for _, tt := range tests {
+		problems := Check(context.Background(), tt.command, opts)
+		if tt.kind == "" {
+			if len(problems) > 0 {
+				t.Errorf("%q: unexpected problems %v", tt.command, problems)
+			}
+			continue
+		}
+		found := false
+		for _, p := range problems {
+			if p.Kind == tt.kind && strings.Contains(p.Message, tt.message) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%q: want %s problem containing %q, got %v", tt.command, tt.kind, tt.message, problems)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package redact
+
+import (
+	"context"
+
+	"github.com/jrcrittenden/ai-shell/llm"
+)
+
+// client redacts the history before handing it to another client.
+type client struct {
+	next llm.Client
+	r    *Redactor
+}
+
+// Client wraps next so that every message it sends has its secrets
+// replaced by r. The model's replies are passed through unchanged; they
+// refer to secrets by placeholder.
+func Client(next llm.Client, r *Redactor) llm.Client {
+	return &client{next: next, r: r}
+}
+
+func (c *client) Stream(ctx context.Context, history []llm.Message) <-chan llm.Chunk {
+	redacted := make([]llm.Message, len(history))
+	for i, m := range history {
+		redacted[i] = llm.Message{Role: m.Role, Content: c.r.Redact(m.Content)}
+	}
+	return c.next.Stream(ctx, redacted)
+}
@@ -0,0 +1,226 @@
+// Package redact keeps secrets from leaving the machine in the
+// conversation sent to a language model.
+//
+// A Redactor replaces API keys, tokens, private keys, passwords and other
+// secrets with stable placeholders such as REDACTED_GITHUB_TOKEN_1_3fa9c2.
+// The same secret always gets the same placeholder, so the model can refer
+// to it in a command, and Restore puts the secret back before the command
+// runs. The last part of a placeholder is random for each Redactor: the
+// secrets are only kept in memory, and a history saved by an earlier run
+// must not have its placeholders restored to whatever this run numbered
+// the same way.
+package redact
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// prefix starts every placeholder.
+const prefix = "REDACTED_"
+
+// placeholderRef matches anything that looks like a placeholder.
+var placeholderRef = regexp.MustCompile(`\b` + prefix + `[A-Za-z0-9_]+`)
+
+// minSecret is the length below which a value is not treated as a secret;
+// shorter values are too likely to be ordinary words.
+const minSecret = 4
+
+// rule detects one kind of secret. group is the submatch holding the
+// secret, or 0 for the whole match.
+type rule struct {
+	kind  string
+	re    *regexp.Regexp
+	group int
+}
+
+var rules = []rule{
+	{"private_key", regexp.MustCompile(`-----BEGIN ([A-Z0-9]+ )*PRIVATE KEY( BLOCK)?-----[\s\S]*?-----END ([A-Z0-9]+ )*PRIVATE KEY( BLOCK)?-----`), 0},
+	{"aws_key", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`), 0},
+	{"aws_secret", regexp.MustCompile(`(?i)aws_secret_access_key["']?\s*[=:]\s*["']?([A-Za-z0-9/+=]{40})`), 1},
+	{"github_token", regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`), 0},
+	{"api_key", regexp.MustCompile(`\bsk-(ant-|proj-)?[A-Za-z0-9_-]{20,}`), 0},
+	{"slack_token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`), 0},
+	{"google_api_key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`), 0},
+	{"stripe_key", regexp.MustCompile(`\b[rs]k_(live|test)_[0-9A-Za-z]{16,}\b`), 0},
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`), 0},
+	{"url_password", regexp.MustCompile(`\b[a-zA-Z][a-zA-Z0-9+.-]*://[^:/\s@]+:([^@\s/]+)@`), 1},
+	{"bearer_token", regexp.MustCompile(`(?i)\b(?:bearer|token)\s+([A-Za-z0-9._~+/-]{16,}=*)`), 1},
+	// KEY=value lines of .env files and env dumps.
+	{"env_secret", regexp.MustCompile(`\b[A-Z0-9_]*(PASSWORD|PASSWD|SECRET|TOKEN|API_?KEY|ACCESS_?KEY|PRIVATE_?KEY|CREDENTIALS?)[A-Z0-9_]*\s*=\s*["']?([^\s"'#]+)`), 2},
+	// "password: value" and similar in configuration files. pwd only
+	// counts in lower case, so that PWD=/home/... in env dumps is left
+	// alone.
+	{"password", regexp.MustCompile(`\b((?i:password|passwd|secret|client_secret|api[_-]?key|access[_-]?token|auth[_-]?token|token)|pwd)["']?\s*[:=]\s*["']?([^\s"',;#]+)`), 2},
+}
+
+// Redaction describes one secret that was replaced, without revealing it.
+type Redaction struct {
+	Placeholder string
+	Kind        string
+	// Hint is the first characters of the secret and its length.
+	Hint string
+}
+
+// Redactor replaces secrets with placeholders. It is safe for concurrent
+// use; one Redactor should be shared by all clients of a session so that
+// placeholders stay stable.
+type Redactor struct {
+	rules []rule
+	// tag ends the placeholders of this Redactor.
+	tag string
+
+	mu      sync.Mutex
+	seen    []*Redaction
+	byValue map[string]*Redaction
+	byName  map[string]string
+	kinds   map[string]int
+}
+
+// New returns a Redactor for the built-in kinds of secrets and the custom
+// regular expressions in patterns. A pattern with a capture group redacts
+// only the first group.
+func New(patterns []string) (*Redactor, error) {
+	tag := make([]byte, 3)
+	if _, err := rand.Read(tag); err != nil {
+		return nil, fmt.Errorf("redact: %w", err)
+	}
+	r := &Redactor{
+		rules:   append([]rule(nil), rules...),
+		tag:     hex.EncodeToString(tag),
+		byValue: map[string]*Redaction{},
+		byName:  map[string]string{},
+		kinds:   map[string]int{},
+	}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("redact pattern %q: %w", p, err)
+		}
+		group := 0
+		if re.NumSubexp() > 0 {
+			group = 1
+		}
+		r.rules = append(r.rules, rule{kind: "custom", re: re, group: group})
+	}
+	return r, nil
+}
+
+// Redact returns text with every secret replaced by its placeholder.
+func (r *Redactor) Redact(text string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, rule := range r.rules {
+		text = r.apply(rule, text)
+	}
+	return text
+}
+
+// apply replaces the secrets rule finds in text.
+func (r *Redactor) apply(rule rule, text string) string {
+	matches := rule.re.FindAllStringSubmatchIndex(text, -1)
+	if matches == nil {
+		return text
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[2*rule.group], m[2*rule.group+1]
+		if start < 0 {
+			continue
+		}
+		value := text[start:end]
+		if len(value) < minSecret || strings.HasPrefix(value, prefix) || strings.HasPrefix(value, "$") {
+			continue
+		}
+		b.WriteString(text[last:start])
+		b.WriteString(r.placeholder(rule.kind, value))
+		last = end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// placeholder returns the placeholder for value, allocating one the first
+// time value is seen.
+func (r *Redactor) placeholder(kind, value string) string {
+	if red, ok := r.byValue[value]; ok {
+		return red.Placeholder
+	}
+	r.kinds[kind]++
+	name := fmt.Sprintf("%s%s_%d_%s", prefix, strings.ToUpper(kind), r.kinds[kind], r.tag)
+	red := &Redaction{Placeholder: name, Kind: kind, Hint: hint(value)}
+	r.seen = append(r.seen, red)
+	r.byValue[value] = red
+	r.byName[name] = value
+	return name
+}
+
+// hint shows enough of a secret to recognize it.
+func hint(value string) string {
+	shown := 4
+	if strings.HasPrefix(value, "-----BEGIN") {
+		shown = strings.Index(value, "\n")
+		if shown < 0 {
+			shown = len(value)
+		}
+	} else if len(value) <= 8 {
+		shown = 0
+	}
+	return fmt.Sprintf("%s… (%d chars)", value[:shown], len(value))
+}
+
+// Restore replaces the placeholders in text with the secrets they stand
+// for.
+func (r *Redactor) Restore(text string) string {
+	if !strings.Contains(text, prefix) {
+		return text
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Longer names first, so _1 does not replace the start of _10.
+	names := make([]string, 0, len(r.byName))
+	for name := range r.byName {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+	for _, name := range names {
+		text = strings.ReplaceAll(text, name, r.byName[name])
+	}
+	return text
+}
+
+// Unknown returns the placeholders in text that this Redactor did not
+// hand out, such as those in a history saved by an earlier run. Restore
+// leaves them as they are.
+func (r *Redactor) Unknown(text string) []string {
+	if !strings.Contains(text, prefix) {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var unknown []string
+	for _, name := range placeholderRef.FindAllString(text, -1) {
+		if _, ok := r.byName[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	return unknown
+}
+
+// Redactions lists the secrets replaced so far in the order they were
+// first seen.
+func (r *Redactor) Redactions() []Redaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]Redaction, len(r.seen))
+	for i, red := range r.seen {
+		list[i] = *red
+	}
+	return list
+}
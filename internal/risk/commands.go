@@ -0,0 +1,139 @@
+package risk
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/jrcrittenden/ai-shell/internal/shell"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// Command is one simple command found in a command line, such as a single
+// stage of a pipeline or the body of a command substitution.
+type Command struct {
+	// Name is the base name of the executable after wrappers such as
+	// sudo or env have been removed.
+	Name string
+	// Program is the program as written, e.g. "./build.sh".
+	Program string
+	// Args holds the remaining arguments. Words that are not plain
+	// literals are given as their source text.
+	Args []string
+	// Span covers the whole simple command, wrappers included. Commands
+	// in the script of sh -c or eval are given the span of that script.
+	Span Span
+}
+
+// Commands parses command and returns its simple commands in source order,
+// including those in the literal scripts of sh -c and eval.
+func Commands(command string) ([]Command, error) {
+	f, err := syntax.NewParser().Parse(strings.NewReader(command), "")
+	if err != nil {
+		return nil, err
+	}
+	a := &analyzer{src: command}
+	var out []Command
+	syntax.Walk(f, func(node syntax.Node) bool {
+		call, ok := node.(*syntax.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+		words := a.words(call)
+		start, _ := shell.Unwrap(values(words))
+		words = words[start:]
+		if len(words) == 0 {
+			return true
+		}
+		c := Command{Name: filepath.Base(words[0].value), Program: words[0].value, Span: spanOf(call)}
+		for _, w := range words[1:] {
+			c.Args = append(c.Args, w.value)
+		}
+		out = append(out, c)
+		if code, at, ok := script(words); ok {
+			inner, _ := Commands(code)
+			for _, c := range inner {
+				c.Span = at
+				out = append(out, c)
+			}
+		}
+		return true
+	})
+	return out, nil
+}
+
+// Redirects returns the targets of the output redirections in command, in
+// source order, including those in the literal scripts of sh -c and eval.
+// Duplications of a descriptor such as 2>&1 are left out. Targets that are
+// not plain literals are given as their source text.
+func Redirects(command string) ([]string, error) {
+	f, err := syntax.NewParser().Parse(strings.NewReader(command), "")
+	if err != nil {
+		return nil, err
+	}
+	a := &analyzer{src: command}
+	var out []string
+	syntax.Walk(f, func(node syntax.Node) bool {
+		switch n := node.(type) {
+		case *syntax.Stmt:
+			for _, r := range n.Redirs {
+				switch r.Op {
+				case syntax.RdrOut, syntax.AppOut, syntax.ClbOut, syntax.RdrAll, syntax.AppAll, syntax.RdrInOut:
+					v, ok := shell.Literal(r.Word)
+					if !ok {
+						v = a.text(r.Word)
+					}
+					out = append(out, v)
+				}
+			}
+		case *syntax.CallExpr:
+			words := a.words(n)
+			start, _ := shell.Unwrap(values(words))
+			if code, _, ok := script(words[start:]); ok {
+				inner, err := Redirects(code)
+				if err != nil {
+					// Unknown targets keep the command from being allowed.
+					inner = []string{code}
+				}
+				out = append(out, inner...)
+			}
+		}
+		return true
+	})
+	return out, nil
+}
+
+// words returns the arguments of call, giving words that are not plain
+// literals as their source text.
+func (a *analyzer) words(call *syntax.CallExpr) []word {
+	words := make([]word, len(call.Args))
+	for i, w := range call.Args {
+		v, ok := shell.Literal(w)
+		if !ok {
+			v = a.text(w)
+		}
+		words[i] = word{node: w, value: v, lit: ok}
+	}
+	return words
+}
+
+// script returns the literal code run by the command words, if it is
+// sh -c or eval, and the span of the words holding it.
+func script(words []word) (string, Span, bool) {
+	if len(words) == 0 {
+		return "", Span{}, false
+	}
+	args := words[1:]
+	i, j, ok := shell.Script(filepath.Base(words[0].value), values(args))
+	if !ok {
+		return "", Span{}, false
+	}
+	parts := make([]string, 0, j-i)
+	for _, w := range args[i:j] {
+		if !w.lit {
+			return "", Span{}, false
+		}
+		parts = append(parts, w.value)
+	}
+	at := Span{spanOf(args[i].node).Start, spanOf(args[j-1].node).End}
+	return strings.Join(parts, " "), at, true
+}
@@ -0,0 +1,183 @@
+// Package risk classifies proposed shell commands. Commands are parsed into
+// a syntax tree so that pipelines, redirections, subshells and command
+// substitutions are all inspected, and each simple command is matched
+// against a rule set.
+package risk
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// Level orders how dangerous a command is.
+type Level int
+
+const (
+	Low Level = iota
+	Medium
+	High
+	Critical
+)
+
+var levelNames = [...]string{"low", "medium", "high", "critical"}
+
+func (l Level) String() string {
+	if l < Low || l > Critical {
+		return fmt.Sprintf("Level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel converts a level name such as "high" back into a Level.
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	return Low, fmt.Errorf("unknown risk level %q", s)
+}
+
+// Classes of risk reported in findings.
+const (
+	ClassDestructive    = "destructive"
+	ClassDisk           = "disk"
+	ClassPermissions    = "permissions"
+	ClassPackages       = "package-install"
+	ClassRemoteExec     = "remote-exec"
+	ClassPrivilege      = "privilege"
+	ClassEval           = "eval"
+	ClassOutsideProject = "write-outside-project"
+	ClassNetwork        = "network"
+	ClassSystem         = "system"
+	ClassSyntax         = "syntax"
+)
+
+// Span is a byte range of the analyzed command.
+type Span struct {
+	Start int
+	End   int
+}
+
+// Finding is one reason a command is considered risky.
+type Finding struct {
+	Class  string
+	Level  Level
+	Reason string
+	Span   Span
+}
+
+// Report is the outcome of Analyze.
+type Report struct {
+	// Level is the highest level of any finding, or Low if there are none.
+	Level    Level
+	Findings []Finding
+}
+
+// Has reports whether any finding belongs to class.
+func (r Report) Has(class string) bool {
+	for _, f := range r.Findings {
+		if f.Class == class {
+			return true
+		}
+	}
+	return false
+}
+
+// Classes returns the distinct classes of the findings in sorted order.
+func (r Report) Classes() []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, f := range r.Findings {
+		if !seen[f.Class] {
+			seen[f.Class] = true
+			out = append(out, f.Class)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Summary lists the reasons on one line, e.g. "high: recursively deletes
+// files; runs with elevated privileges".
+func (r Report) Summary() string {
+	if len(r.Findings) == 0 {
+		return r.Level.String()
+	}
+	reasons := make([]string, len(r.Findings))
+	for i, f := range r.Findings {
+		reasons[i] = f.Reason
+	}
+	return r.Level.String() + ": " + strings.Join(reasons, "; ")
+}
+
+// Options tune the analysis.
+type Options struct {
+	// Dir is the project directory. Writes outside it are reported.
+	Dir string
+	// Home is used to expand "~" and $HOME in paths.
+	Home string
+}
+
+// Analyze parses command and classifies it. A command that cannot be parsed
+// is reported as high risk.
+func Analyze(command string, opts Options) Report {
+	a := &analyzer{src: command, opts: opts, seen: map[Finding]bool{}}
+	f, err := syntax.NewParser().Parse(strings.NewReader(command), "")
+	if err != nil {
+		a.add(ClassSyntax, High, Span{0, len(command)}, "command could not be parsed: %v", err)
+		return a.report
+	}
+	a.walk(f)
+	return a.report
+}
+
+// walk applies the rules to every statement, pipeline and simple command
+// of f.
+func (a *analyzer) walk(f *syntax.File) {
+	syntax.Walk(f, func(node syntax.Node) bool {
+		switch n := node.(type) {
+		case *syntax.Stmt:
+			a.redirects(n)
+		case *syntax.BinaryCmd:
+			if n.Op == syntax.Pipe || n.Op == syntax.PipeAll {
+				a.pipeline(n)
+			}
+		case *syntax.CallExpr:
+			a.call(n)
+		}
+		return true
+	})
+}
+
+type analyzer struct {
+	src    string
+	opts   Options
+	report Report
+	seen   map[Finding]bool
+}
+
+func (a *analyzer) add(class string, level Level, span Span, format string, args ...any) {
+	f := Finding{Class: class, Level: level, Reason: fmt.Sprintf(format, args...), Span: span}
+	if a.seen[f] {
+		return
+	}
+	a.seen[f] = true
+	a.report.Findings = append(a.report.Findings, f)
+	if level > a.report.Level {
+		a.report.Level = level
+	}
+}
+
+func spanOf(n syntax.Node) Span {
+	return Span{int(n.Pos().Offset()), int(n.End().Offset())}
+}
+
+// text returns the source text of n.
+func (a *analyzer) text(n syntax.Node) string {
+	s := spanOf(n)
+	return a.src[s.Start:s.End]
+}
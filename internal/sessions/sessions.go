@@ -0,0 +1,351 @@
+// Package sessions saves conversations to disk so that they can be listed,
+// searched, resumed and deleted later.
+//
+// Each session is a JSON file named after its id in the store's directory,
+// rewritten as a whole on every save.
+package sessions
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jrcrittenden/ai-shell/internal/audit"
+	"github.com/jrcrittenden/ai-shell/llm"
+)
+
+// ErrNotFound is returned when no session matches an id.
+var ErrNotFound = errors.New("no such session")
+
+// Session is a saved conversation.
+type Session struct {
+	ID      string    `json:"id"`
+	Title   string    `json:"title"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+	Backend string    `json:"backend"`
+	Model   string    `json:"model,omitempty"`
+	Dir     string    `json:"cwd"`
+	// Messages is the history sent to the model.
+	Messages []llm.Message `json:"messages"`
+	// Events is what happened, in order: prompts, answers and the
+	// proposals, decisions and results recorded in the audit log.
+	Events []Event `json:"events,omitempty"`
+	// Transcript and BashOutput are what the AI and Bash panes showed.
+	Transcript string `json:"transcript,omitempty"`
+	BashOutput string `json:"bash_output,omitempty"`
+	// Recording is the raw output of the Bash mode terminal.
+	Recording *Recording `json:"recording,omitempty"`
+	// Suspect lists what looked like prompt injection in Messages. It
+	// stays with the session since the flagged output stays in its
+	// history.
+	Suspect []string `json:"suspect,omitempty"`
+}
+
+// Event types besides those of the audit log.
+const (
+	EventPrompt = "prompt"
+	EventAnswer = "answer"
+)
+
+// Event is a prompt, an answer or an audit log entry without its hash
+// chain. The fields share their names with audit.Entry.
+type Event struct {
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"`
+	// Text is the prompt or the answer.
+	Text       string `json:"text,omitempty"`
+	Command    string `json:"command,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	Decision   string `json:"decision,omitempty"`
+	DenyReason string `json:"deny_reason,omitempty"`
+	Original   string `json:"original,omitempty"`
+	Details    any    `json:"details,omitempty"`
+}
+
+// Recording is a terminal's output with the time each piece arrived, as
+// needed for an asciicast.
+type Recording struct {
+	Start  time.Time `json:"start"`
+	Width  int       `json:"width"`
+	Height int       `json:"height"`
+	Frames []Frame   `json:"frames"`
+
+	// from and base place the output added after Continue.
+	from time.Time
+	base time.Duration
+}
+
+// Frame is output that arrived At after the start of a recording.
+type Frame struct {
+	At   time.Duration `json:"at"`
+	Data string        `json:"data"`
+}
+
+// Add appends data received at t.
+func (r *Recording) Add(t time.Time, data string) {
+	at := t.Sub(r.Start)
+	if !r.from.IsZero() {
+		at = r.base + t.Sub(r.from)
+	}
+	r.Frames = append(r.Frames, Frame{At: at, Data: data})
+}
+
+// Continue makes the output added from t on follow the last frame after a
+// second, so that a recording resumed later does not replay the time in
+// between as a pause.
+func (r *Recording) Continue(t time.Time) {
+	r.from, r.base = t, time.Second
+	if n := len(r.Frames); n > 0 {
+		r.base += r.Frames[n-1].At
+	}
+}
+
+// New returns an empty session started now in dir.
+func New(backend, model, dir string) *Session {
+	now := time.Now()
+	var b [3]byte
+	rand.Read(b[:])
+	return &Session{
+		ID:      now.Format("20060102-150405-") + hex.EncodeToString(b[:]),
+		Created: now,
+		Updated: now,
+		Backend: backend,
+		Model:   model,
+		Dir:     dir,
+	}
+}
+
+// Empty reports whether nothing was said in s, or done in its Bash mode
+// terminal, yet.
+func (s *Session) Empty() bool {
+	return len(s.Messages) == 0 && (s.Recording == nil || len(s.Recording.Frames) == 0)
+}
+
+// Record adds the audit entry e to the events of s.
+func (s *Session) Record(e audit.Entry) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	s.Events = append(s.Events, Event{
+		Time:       e.Time,
+		Event:      e.Event,
+		Command:    e.Command,
+		Reason:     e.Reason,
+		Decision:   e.Decision,
+		DenyReason: e.DenyReason,
+		Original:   e.Original,
+		Details:    e.Details,
+	})
+}
+
+// Say adds a prompt or an answer to the events of s.
+func (s *Session) Say(event, text string) {
+	s.Events = append(s.Events, Event{Time: time.Now(), Event: event, Text: text})
+}
+
+// Matches reports whether query occurs, ignoring case, in the title,
+// messages or commands of s.
+func (s *Session) Matches(query string) bool {
+	query = strings.ToLower(query)
+	if strings.Contains(strings.ToLower(s.Title), query) {
+		return true
+	}
+	for _, m := range s.Messages {
+		if strings.Contains(strings.ToLower(m.Content), query) {
+			return true
+		}
+	}
+	for _, e := range s.Events {
+		if strings.Contains(strings.ToLower(e.Command), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// Summary returns a one-line description of s for listings.
+func (s *Session) Summary() string {
+	title := s.Title
+	if title == "" {
+		title = "(untitled)"
+	}
+	if r := []rune(title); len(r) > 60 {
+		title = string(r[:59]) + "…"
+	}
+	return fmt.Sprintf("%s  %s  %-8s %3d msgs  %s", s.ID, s.Updated.Format("2006-01-02 15:04"), s.Backend, len(s.Messages), title)
+}
+
+// Store keeps sessions in a directory.
+type Store struct {
+	dir string
+}
+
+// DefaultDir returns $HOME/.cache/ai-shell/sessions.
+func DefaultDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ai-shell", "sessions")
+}
+
+// Open creates dir if needed and returns a store for it.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Dir returns the directory of the store.
+func (st *Store) Dir() string {
+	return st.dir
+}
+
+func (st *Store) path(id string) string {
+	return filepath.Join(st.dir, id+".json")
+}
+
+// Save writes s, replacing any earlier save, and updates its time.
+func (st *Store) Save(s *Session) error {
+	s.Updated = time.Now()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write then rename so that a crash never leaves half a session.
+	tmp, err := os.CreateTemp(st.dir, s.ID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), st.path(s.ID))
+}
+
+// Load reads the session id, which may be given as a unique prefix.
+func (st *Store) Load(id string) (*Session, error) {
+	id, err := st.resolve(id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(st.path(id))
+	if err != nil {
+		return nil, err
+	}
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("session %s: %w", id, err)
+	}
+	return &s, nil
+}
+
+// Latest returns the most recently updated session.
+func (st *Store) Latest() (*Session, error) {
+	list, err := st.List()
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, ErrNotFound
+	}
+	return list[0], nil
+}
+
+// List returns every session, most recently updated first. Files that
+// cannot be read are skipped.
+func (st *Store) List() ([]*Session, error) {
+	ids, err := st.ids()
+	if err != nil {
+		return nil, err
+	}
+	var list []*Session
+	for _, id := range ids {
+		if s, err := st.Load(id); err == nil {
+			list = append(list, s)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Updated.After(list[j].Updated) })
+	return list, nil
+}
+
+// Search returns the sessions matching query, most recent first.
+func (st *Store) Search(query string) ([]*Session, error) {
+	list, err := st.List()
+	if err != nil {
+		return nil, err
+	}
+	var found []*Session
+	for _, s := range list {
+		if s.Matches(query) {
+			found = append(found, s)
+		}
+	}
+	return found, nil
+}
+
+// Delete removes the session id, which may be given as a unique prefix,
+// and returns its full id.
+func (st *Store) Delete(id string) (string, error) {
+	id, err := st.resolve(id)
+	if err != nil {
+		return "", err
+	}
+	return id, os.Remove(st.path(id))
+}
+
+func (st *Store) ids() ([]string, error) {
+	entries, err := os.ReadDir(st.dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, e := range entries {
+		if name, ok := strings.CutSuffix(e.Name(), ".json"); ok && !e.IsDir() {
+			ids = append(ids, name)
+		}
+	}
+	return ids, nil
+}
+
+// resolve expands a unique prefix to a full id.
+func (st *Store) resolve(prefix string) (string, error) {
+	if prefix == "" || strings.ContainsAny(prefix, `/\`) {
+		return "", fmt.Errorf("%w: %q", ErrNotFound, prefix)
+	}
+	ids, err := st.ids()
+	if err != nil {
+		return "", err
+	}
+	var match []string
+	for _, id := range ids {
+		if id == prefix {
+			return id, nil
+		}
+		if strings.HasPrefix(id, prefix) {
+			match = append(match, id)
+		}
+	}
+	switch len(match) {
+	case 0:
+		return "", fmt.Errorf("%w: %q", ErrNotFound, prefix)
+	case 1:
+		return match[0], nil
+	}
+	return "", fmt.Errorf("session id %q is ambiguous: %s", prefix, strings.Join(match, ", "))
+}
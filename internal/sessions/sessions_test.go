@@ -0,0 +1,75 @@
+package sessions
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jrcrittenden/ai-shell/internal/audit"
+	"github.com/jrcrittenden/ai-shell/llm"
+)
+
+func TestStore(t *testing.T) {
+	st, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := New("openai", "gpt-4", "/work")
+	a.ID = "20261018-100000-aaaaaa"
+	a.Title = "find large files"
+	a.Messages = []llm.Message{{Role: "user", Content: "find large files"}}
+	a.Record(audit.Entry{Seq: 7, Hash: "x", Event: audit.EventProposal, Command: "du -sh *"})
+	b := New("claude", "", "/home")
+	b.ID = "20261018-110000-bbbbbb"
+	b.Title = "restart nginx"
+	for _, s := range []*Session{a, b} {
+		if err := st.Save(s); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	got, err := st.Load("20261018-10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != a.Title || got.Dir != "/work" || len(got.Messages) != 1 || got.Events[0].Command != "du -sh *" {
+		t.Errorf("Load = %+v", got)
+	}
+	if _, err := st.Load("2026"); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Errorf("ambiguous prefix: %v", err)
+	}
+	if _, err := st.Load("../secret"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("path in id: %v", err)
+	}
+
+	if latest, _ := st.Latest(); latest.ID != b.ID {
+		t.Errorf("Latest = %s", latest.ID)
+	}
+	found, _ := st.Search("DU -SH")
+	if len(found) != 1 || found[0].ID != a.ID {
+		t.Errorf("Search by command = %v", found)
+	}
+
+	if id, err := st.Delete("20261018-11"); err != nil || id != b.ID {
+		t.Errorf("Delete = %s, %v", id, err)
+	}
+	if list, _ := st.List(); len(list) != 1 || list[0].ID != a.ID {
+		t.Errorf("List after Delete = %v", list)
+	}
+	if _, err := st.Latest(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRecordingContinue(t *testing.T) {
+	start := time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC)
+	r := &Recording{Start: start}
+	r.Add(start.Add(2*time.Second), "$ ")
+	r.Continue(start.Add(time.Hour))
+	r.Add(start.Add(time.Hour+500*time.Millisecond), "ls")
+	if got := r.Frames[1].At; got != 3500*time.Millisecond {
+		t.Errorf("resumed frame at %v", got)
+	}
+}
@@ -0,0 +1,175 @@
+// Package shell holds the shell syntax helpers shared by the risk and
+// egress analyzers: the values of literal words, the stages of pipelines,
+// wrapper commands such as sudo, and the inline scripts of sh -c and eval.
+// Keeping them in one place makes both analyzers see the same command.
+package shell
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// Set returns a set of the given items.
+func Set(items ...string) map[string]bool {
+	m := make(map[string]bool, len(items))
+	for _, it := range items {
+		m[it] = true
+	}
+	return m
+}
+
+// Shells run the script given with -c.
+var Shells = Set("sh", "bash", "zsh", "dash", "ksh", "mksh", "ash")
+
+// Wrappers run their arguments as a command. The value is the set of
+// options that take a separate argument.
+var Wrappers = map[string]map[string]bool{
+	"sudo":        Set("-u", "-g", "-C", "-h", "-p", "-U", "-r", "-t"),
+	"doas":        Set("-u", "-C"),
+	"env":         Set("-u", "-C", "-S"),
+	"nice":        Set("-n"),
+	"nohup":       {},
+	"time":        Set("-f", "-o"),
+	"command":     {},
+	"exec":        Set("-a"),
+	"builtin":     {},
+	"stdbuf":      Set("-i", "-o", "-e"),
+	"timeout":     Set("-s", "-k", "--signal", "--kill-after"),
+	"watch":       Set("-n", "-d"),
+	"torsocks":    {},
+	"proxychains": Set("-f"),
+	"xargs":       Set("-I", "-n", "-P", "-d", "-a", "-E", "-L", "-s", "--max-args", "--max-procs", "--delimiter", "--arg-file", "--max-lines"),
+}
+
+// assignment matches a variable assignment passed to env or sudo.
+var assignment = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+// Unwrap skips the wrappers at the start of args, with their options and
+// variable assignments, and returns the index of the wrapped command and
+// the indexes of the wrappers. The index is len(args) if nothing is
+// wrapped.
+func Unwrap(args []string) (int, []int) {
+	var wrappers []int
+	i := 0
+	for i < len(args) {
+		name := filepath.Base(args[i])
+		opts, ok := Wrappers[name]
+		if !ok {
+			break
+		}
+		wrappers = append(wrappers, i)
+		i = skipOptions(args, i+1, opts)
+		if name == "timeout" && i < len(args) {
+			i++ // duration
+		}
+	}
+	return i, wrappers
+}
+
+// skipOptions returns the index of the first argument from i on that is
+// not an option, an option's value or an assignment.
+func skipOptions(args []string, i int, withValue map[string]bool) int {
+	for i < len(args) {
+		v := args[i]
+		switch {
+		case v == "--":
+			return i + 1
+		case withValue[v]:
+			i += 2
+		case strings.HasPrefix(v, "-") && len(v) > 1, assignment.MatchString(v):
+			i++
+		default:
+			return i
+		}
+	}
+	return len(args)
+}
+
+// Script returns the arguments args[i:j] that hold the shell code name
+// runs: all of them for eval and the script of sh -c. Joined by spaces
+// they are the code. It reports false if name runs no inline script.
+func Script(name string, args []string) (i, j int, ok bool) {
+	if name == "eval" {
+		return 0, len(args), len(args) > 0
+	}
+	if !Shells[name] {
+		return 0, 0, false
+	}
+	command := false
+	for i, w := range args {
+		switch {
+		case w == "-o" || w == "+o":
+			// The value is taken by the next iteration's check.
+		case i > 0 && (args[i-1] == "-o" || args[i-1] == "+o"):
+		case strings.HasPrefix(w, "-") && !strings.HasPrefix(w, "--") && len(w) > 1:
+			command = command || strings.Contains(w, "c")
+		case strings.HasPrefix(w, "--"):
+		default:
+			return i, i + 1, command
+		}
+	}
+	return 0, 0, false
+}
+
+// Literal returns the value of a word made only of literal and quoted
+// text, with quotes and backslash escapes removed: \rm and 'rm' are both
+// rm.
+func Literal(w *syntax.Word) (string, bool) {
+	var sb strings.Builder
+	for _, part := range w.Parts {
+		switch p := part.(type) {
+		case *syntax.Lit:
+			sb.WriteString(Unescape(p.Value, false))
+		case *syntax.SglQuoted:
+			sb.WriteString(p.Value)
+		case *syntax.DblQuoted:
+			for _, q := range p.Parts {
+				lit, ok := q.(*syntax.Lit)
+				if !ok {
+					return "", false
+				}
+				sb.WriteString(Unescape(lit.Value, true))
+			}
+		default:
+			return "", false
+		}
+	}
+	return sb.String(), true
+}
+
+// Unescape removes the backslashes the shell removes from literal text.
+// Inside double quotes only \$, \`, \", \\ and line continuations are
+// escapes.
+func Unescape(s string, quoted bool) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && (!quoted || strings.IndexByte("$`\"\\\n", s[i+1]) >= 0) {
+			i++
+			if s[i] != '\n' {
+				sb.WriteByte(s[i])
+			}
+			continue
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// FlattenPipe returns the stages of a pipeline in order.
+func FlattenPipe(b *syntax.BinaryCmd) []*syntax.Stmt {
+	var out []*syntax.Stmt
+	for _, st := range []*syntax.Stmt{b.X, b.Y} {
+		if inner, ok := st.Cmd.(*syntax.BinaryCmd); ok && (inner.Op == syntax.Pipe || inner.Op == syntax.PipeAll) {
+			out = append(out, FlattenPipe(inner)...)
+		} else {
+			out = append(out, st)
+		}
+	}
+	return out
+}
@@ -0,0 +1,86 @@
+package shell
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+func TestLiteral(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+		ok   bool
+	}{
+		{`rm`, "rm", true},
+		{`\rm`, "rm", true},
+		{`r\m`, "rm", true},
+		{`'r'"m"`, "rm", true},
+		{`"a\$b\c"`, `a$b\c`, true},
+		{`'\rm'`, `\rm`, true},
+		{`a\ b`, "a b", true},
+		{`"$HOME"`, "", false},
+		{`$(cmd)`, "", false},
+	}
+	for _, tt := range tests {
+		f, err := syntax.NewParser().Parse(strings.NewReader(tt.word), "")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.word, err)
+		}
+		w := f.Stmts[0].Cmd.(*syntax.CallExpr).Args[0]
+		got, ok := Literal(w)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Literal(%s) = %q, %v, want %q, %v", tt.word, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestUnwrap(t *testing.T) {
+	tests := []struct {
+		args     string
+		start    int
+		wrappers []int
+	}{
+		{"ls -la", 0, nil},
+		{"sudo -u root env -i A=1 B=2 rm x", 7, []int{0, 3}},
+		{"timeout -s KILL 5 nice -n 10 make", 7, []int{0, 4}},
+		{"xargs -I{} curl x", 2, []int{0}},
+		{"sudo -- rm", 2, []int{0}},
+		{"env", 1, []int{0}},
+	}
+	for _, tt := range tests {
+		start, wrappers := Unwrap(strings.Fields(tt.args))
+		if start != tt.start || !reflect.DeepEqual(wrappers, tt.wrappers) {
+			t.Errorf("Unwrap(%s) = %d, %v, want %d, %v", tt.args, start, wrappers, tt.start, tt.wrappers)
+		}
+	}
+}
+
+func TestScript(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+		ok   bool
+	}{
+		{"bash", []string{"-c", "rm -rf ~"}, "rm -rf ~", true},
+		{"sh", []string{"-ec", "ls", "arg0"}, "ls", true},
+		{"bash", []string{"-o", "pipefail", "-c", "a | b"}, "a | b", true},
+		{"bash", []string{"script.sh"}, "", false},
+		{"eval", []string{"echo", "hi"}, "echo hi", true},
+		{"eval", nil, "", false},
+		{"python3", []string{"-c", "print(1)"}, "", false},
+	}
+	for _, tt := range tests {
+		i, j, ok := Script(tt.name, tt.args)
+		got := ""
+		if ok {
+			got = strings.Join(tt.args[i:j], " ")
+		}
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Script(%s %q) = %q, %v, want %q, %v", tt.name, tt.args, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/jrcrittenden/ai-shell/internal/plan"
+	"github.com/jrcrittenden/ai-shell/internal/risk"
+)
+
+// Decisions emitted by ChecklistModel. The parent closes the checklist on
+// either.
+type (
+	// PlanApprovedMsg runs the plan's Steps as reviewed by the user.
+	PlanApprovedMsg struct {
+		Steps []plan.Step
+	}
+	// PlanCanceledMsg discards the plan.
+	PlanCanceledMsg struct{}
+)
+
+type ChecklistKeyMap struct {
+	Up       key.Binding
+	Down     key.Binding
+	MoveUp   key.Binding
+	MoveDown key.Binding
+	Edit     key.Binding
+	Delete   key.Binding
+	Approve  key.Binding
+	Cancel   key.Binding
+}
+
+func DefaultChecklistKeyMap() ChecklistKeyMap {
+	return ChecklistKeyMap{
+		Up: key.NewBinding(
+			key.WithKeys("up", "k"),
+			key.WithHelp("↑/↓", "select"),
+		),
+		Down: key.NewBinding(
+			key.WithKeys("down", "j"),
+			key.WithHelp("↓", "next"),
+		),
+		MoveUp: key.NewBinding(
+			key.WithKeys("shift+up", "K"),
+			key.WithHelp("shift+↑/↓", "move"),
+		),
+		MoveDown: key.NewBinding(
+			key.WithKeys("shift+down", "J"),
+			key.WithHelp("shift+↓", "move down"),
+		),
+		Edit: key.NewBinding(
+			key.WithKeys("e", "E"),
+			key.WithHelp("e", "edit"),
+		),
+		Delete: key.NewBinding(
+			key.WithKeys("d", "D", "delete"),
+			key.WithHelp("d", "delete"),
+		),
+		Approve: key.NewBinding(
+			key.WithKeys("y", "Y", "enter"),
+			key.WithHelp("enter", "run plan"),
+		),
+		Cancel: key.NewBinding(
+			key.WithKeys("esc", "n", "N"),
+			key.WithHelp("esc", "discard"),
+		),
+	}
+}
+
+var (
+	checklistSelected = lipgloss.NewStyle().Foreground(lipgloss.Color("#874BFD")).Bold(true)
+	checklistCommand  = lipgloss.NewStyle().Foreground(lipgloss.Color("#87ceeb"))
+	markStyles        = map[plan.Status]lipgloss.Style{
+		plan.Running: lipgloss.NewStyle().Foreground(lipgloss.Color("#87ceeb")),
+		plan.Done:    lipgloss.NewStyle().Foreground(lipgloss.Color("#50fa7b")),
+		plan.Failed:  lipgloss.NewStyle().Foreground(lipgloss.Color("#ff5555")),
+		plan.Skipped: lipgloss.NewStyle().Foreground(lipgloss.Color("#626262")),
+	}
+)
+
+// ChecklistModel shows a plan for review. The user can reorder, delete and
+// edit the steps that have not run yet before approving the plan.
+type ChecklistModel struct {
+	Goal  string
+	Steps []plan.Step
+
+	analyze  func(command string) risk.Report
+	selected int
+	editing  bool
+	editor   Editor
+	err      string
+	width    int
+	height   int
+	keymap   ChecklistKeyMap
+}
+
+// NewChecklist returns a checklist of steps towards goal with the first
+// step that has not run selected. Each step is shown with the risk level
+// analyze finds in its command, if analyze is not nil.
+func NewChecklist(goal string, steps []plan.Step, analyze func(command string) risk.Report) *ChecklistModel {
+	m := &ChecklistModel{
+		Goal:    goal,
+		Steps:   append([]plan.Step(nil), steps...),
+		analyze: analyze,
+		keymap:  DefaultChecklistKeyMap(),
+	}
+	for i, st := range m.Steps {
+		if st.Status == plan.Pending {
+			m.selected = i
+			break
+		}
+	}
+	m.SetSize(80, 24)
+	return m
+}
+
+// SetSize fits the checklist into a terminal of the given size.
+func (m *ChecklistModel) SetSize(width, height int) {
+	m.width = max(min(width-4, 100), 20)
+	m.height = max(height-2, 10)
+	if m.editing {
+		m.editor.SetWidth(m.innerWidth())
+	}
+}
+
+func (m *ChecklistModel) innerWidth() int {
+	return m.width - dialogBorder.GetHorizontalFrameSize()
+}
+
+func (m ChecklistModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m ChecklistModel) Update(msg tea.Msg) (ChecklistModel, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.SetSize(msg.Width, msg.Height)
+		return m, nil
+
+	case EditedMsg:
+		if !m.editing {
+			return m, nil
+		}
+		if msg.Err != nil {
+			m.editor.SetError(msg.Err.Error())
+			return m, nil
+		}
+		if msg.Command != "" {
+			m.Steps[m.selected].Command = msg.Command
+		}
+		m.editing = false
+		return m, nil
+
+	case EditCanceledMsg:
+		m.editing = false
+		return m, nil
+
+	case tea.KeyMsg:
+		if m.editing {
+			var cmd tea.Cmd
+			m.editor, cmd = m.editor.Update(msg)
+			return m, cmd
+		}
+		return m.key(msg)
+	}
+
+	if m.editing {
+		var cmd tea.Cmd
+		m.editor, cmd = m.editor.Update(msg)
+		return m, cmd
+	}
+	return m, nil
+}
+
+// key handles keys while the list is shown.
+func (m ChecklistModel) key(msg tea.KeyMsg) (ChecklistModel, tea.Cmd) {
+	m.err = ""
+	switch {
+	case key.Matches(msg, m.keymap.Up):
+		m.selected = max(m.selected-1, 0)
+	case key.Matches(msg, m.keymap.Down):
+		m.selected = min(m.selected+1, len(m.Steps)-1)
+	case key.Matches(msg, m.keymap.MoveUp):
+		m.move(-1)
+	case key.Matches(msg, m.keymap.MoveDown):
+		m.move(1)
+	case key.Matches(msg, m.keymap.Edit):
+		if m.changeable(m.selected) {
+			m.editing = true
+			m.editor = NewEditor(m.Steps[m.selected].Command, m.innerWidth())
+		}
+	case key.Matches(msg, m.keymap.Delete):
+		if m.changeable(m.selected) {
+			m.Steps = append(m.Steps[:m.selected:m.selected], m.Steps[m.selected+1:]...)
+			m.selected = max(min(m.selected, len(m.Steps)-1), 0)
+		}
+	case key.Matches(msg, m.keymap.Approve):
+		steps := append([]plan.Step(nil), m.Steps...)
+		for _, st := range steps {
+			if st.Status == plan.Pending {
+				return m, func() tea.Msg { return PlanApprovedMsg{Steps: steps} }
+			}
+		}
+		m.err = "the plan has no steps left to run"
+	case key.Matches(msg, m.keymap.Cancel):
+		return m, func() tea.Msg { return PlanCanceledMsg{} }
+	}
+	return m, nil
+}
+
+// changeable reports whether step i has not run yet, and explains why it
+// cannot be changed otherwise.
+func (m *ChecklistModel) changeable(i int) bool {
+	if i < 0 || i >= len(m.Steps) {
+		return false
+	}
+	if m.Steps[i].Status != plan.Pending {
+		m.err = "only steps that have not run can be changed"
+		return false
+	}
+	return true
+}
+
+// move swaps the selected step with its neighbour in direction dir. Steps
+// that have run stay where they are.
+func (m *ChecklistModel) move(dir int) {
+	j := m.selected + dir
+	if !m.changeable(m.selected) || j < 0 || j >= len(m.Steps) || m.Steps[j].Status != plan.Pending {
+		return
+	}
+	m.Steps[m.selected], m.Steps[j] = m.Steps[j], m.Steps[m.selected]
+	m.selected = j
+}
+
+// StepLine renders step i of a plan on one line: its mark, number, title
+// and, once it has ended, its result.
+func StepLine(i int, st plan.Step) string {
+	mark := st.Status.Mark()
+	if style, ok := markStyles[st.Status]; ok {
+		mark = style.Render(mark)
+	}
+	line := fmt.Sprintf("%s %d. %s", mark, i+1, st.Title)
+	if st.Result != "" {
+		line += dialogHelp.Render(" — " + st.Result)
+	}
+	return line
+}
+
+// stepBlock renders step i with its risk level and its command below it.
+func (m ChecklistModel) stepBlock(i int) string {
+	wrap := lipgloss.NewStyle().Width(m.innerWidth() - 2)
+	cursor := "  "
+	line := StepLine(i, m.Steps[i])
+	if i == m.selected {
+		cursor = checklistSelected.Render("› ")
+		line = checklistSelected.Render(line)
+	}
+	if m.analyze != nil {
+		level := m.analyze(m.Steps[i].Command).Level
+		line += " " + riskStyles[level].Render("["+strings.ToUpper(level.String())+"]")
+	}
+	command := lipgloss.NewStyle().PaddingLeft(6).Width(m.innerWidth() - 2).Render(checklistCommand.Render("$ " + m.Steps[i].Command))
+	return lipgloss.JoinHorizontal(lipgloss.Top, cursor, wrap.Render(line)+"\n"+command)
+}
+
+// list renders the steps, leaving out steps far from the selection when
+// they do not fit in height lines.
+func (m ChecklistModel) list(height int) string {
+	blocks := make([]string, len(m.Steps))
+	for i := range m.Steps {
+		blocks[i] = m.stepBlock(i)
+	}
+	from, to := 0, len(blocks)
+	lines := func() int {
+		n := 0
+		for _, b := range blocks[from:to] {
+			n += lipgloss.Height(b)
+		}
+		return n
+	}
+	// Drop steps from whichever end is farther from the selection.
+	for lines() > height && to-from > 1 {
+		if m.selected-from > to-1-m.selected {
+			from++
+		} else {
+			to--
+		}
+	}
+	var parts []string
+	if from > 0 {
+		parts = append(parts, dialogHelp.Render(fmt.Sprintf("  ↑ %d more", from)))
+	}
+	parts = append(parts, blocks[from:to]...)
+	if to < len(blocks) {
+		parts = append(parts, dialogHelp.Render(fmt.Sprintf("  ↓ %d more", len(blocks)-to)))
+	}
+	return strings.Join(parts, "\n")
+}
+
+func (m ChecklistModel) help() string {
+	var parts []string
+	for _, b := range []key.Binding{m.keymap.Up, m.keymap.MoveUp, m.keymap.Edit, m.keymap.Delete, m.keymap.Approve, m.keymap.Cancel} {
+		parts = append(parts, b.Help().Key+" "+b.Help().Desc)
+	}
+	return lipgloss.NewStyle().Width(m.innerWidth()).Render(dialogHelp.Render(strings.Join(parts, " • ")))
+}
+
+func (m ChecklistModel) View() string {
+	wrap := lipgloss.NewStyle().Width(m.innerWidth())
+	header := dialogLabel.Render("Plan:") + " " + m.Goal
+	var footer []string
+	if m.err != "" {
+		footer = append(footer, wrap.Render(dialogError.Render(m.err)))
+	}
+	if m.editing {
+		footer = append(footer, m.editor.View())
+	} else {
+		footer = append(footer, m.help())
+	}
+	foot := strings.Join(footer, "\n")
+	head := wrap.Render(header)
+	room := m.height - dialogBorder.GetVerticalFrameSize() - lipgloss.Height(head) - lipgloss.Height(foot) - 2
+	return dialogBorder.Width(m.width - 2).Render(head + "\n\n" + m.list(room) + "\n\n" + foot)
+}
@@ -0,0 +1,142 @@
+package tui
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/exp/golden"
+	"github.com/charmbracelet/x/exp/teatest"
+	"github.com/jrcrittenden/ai-shell/internal/plan"
+	"github.com/jrcrittenden/ai-shell/internal/risk"
+)
+
+// checklistHarness hosts a checklist and quits on the first decision it
+// emits.
+type checklistHarness struct {
+	checklist ChecklistModel
+	decision  tea.Msg
+}
+
+func (h checklistHarness) Init() tea.Cmd {
+	return nil
+}
+
+func (h checklistHarness) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg.(type) {
+	case PlanApprovedMsg, PlanCanceledMsg:
+		h.decision = msg
+		return h, tea.Quit
+	}
+	var cmd tea.Cmd
+	h.checklist, cmd = h.checklist.Update(msg)
+	return h, cmd
+}
+
+func (h checklistHarness) View() string {
+	return h.checklist.View()
+}
+
+func testSteps() []plan.Step {
+	return []plan.Step{
+		{Title: "Check the Go version", Command: "go version", Status: plan.Done, Result: "exit 0"},
+		{Title: "Download modules", Command: "go mod download"},
+		{Title: "Build", Command: "go build ./..."},
+		{Title: "Run the tests", Command: "go test ./..."},
+		{Title: "Clean the cache", Command: "rm -rf ~/.cache/go-build"},
+	}
+}
+
+func testRisk(command string) risk.Report {
+	return risk.Analyze(command, risk.Options{Dir: "/work", Home: "/home/user"})
+}
+
+// runChecklist sends keys to c, then quits if quit is set or else waits
+// for a decision.
+func runChecklist(t *testing.T, c *ChecklistModel, width, height int, quit bool, keys ...tea.Msg) checklistHarness {
+	t.Helper()
+	tm := teatest.NewTestModel(t, checklistHarness{checklist: *c}, teatest.WithInitialTermSize(width, height))
+	for _, k := range keys {
+		tm.Send(k)
+	}
+	if quit {
+		if err := tm.Quit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tm.FinalModel(t, teatest.WithFinalTimeout(2*time.Second)).(checklistHarness)
+}
+
+func TestChecklistView(t *testing.T) {
+	h := runChecklist(t, NewChecklist("build the project", testSteps(), testRisk), 80, 24, true, runes("j"))
+	golden.RequireEqual(t, []byte(h.View()))
+
+	t.Run("clipped", func(t *testing.T) {
+		h := runChecklist(t, NewChecklist("build the project", testSteps(), testRisk), 60, 14, true, runes("j"), runes("j"))
+		golden.RequireEqual(t, []byte(h.View()))
+	})
+}
+
+func TestChecklistDecisions(t *testing.T) {
+	steps := testSteps()
+	tests := []struct {
+		name string
+		keys []tea.Msg
+		want tea.Msg
+	}{
+		{
+			name: "approve as proposed",
+			keys: keys(tea.KeyEnter),
+			want: PlanApprovedMsg{Steps: steps},
+		},
+		{
+			name: "reorder",
+			keys: []tea.Msg{runes("J"), runes("y")},
+			want: PlanApprovedMsg{Steps: []plan.Step{steps[0], steps[2], steps[1], steps[3], steps[4]}},
+		},
+		{
+			name: "steps that ran stay in place",
+			keys: []tea.Msg{runes("K"), runes("k"), runes("d"), runes("y")},
+			want: PlanApprovedMsg{Steps: steps},
+		},
+		{
+			name: "delete",
+			keys: []tea.Msg{runes("j"), runes("d"), runes("y")},
+			want: PlanApprovedMsg{Steps: []plan.Step{steps[0], steps[1], steps[3], steps[4]}},
+		},
+		{
+			name: "nothing left to run",
+			keys: []tea.Msg{runes("d"), runes("d"), runes("d"), runes("d"), runes("y"), runes("n")},
+			want: PlanCanceledMsg{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := runChecklist(t, NewChecklist("build the project", testSteps(), testRisk), 80, 24, false, tt.keys...)
+			if !reflect.DeepEqual(h.decision, tt.want) {
+				t.Errorf("decision = %#v\nwant %#v", h.decision, tt.want)
+			}
+		})
+	}
+}
+
+func TestChecklistEdit(t *testing.T) {
+	c := *NewChecklist("build the project", testSteps(), testRisk)
+	c, _ = c.Update(runes("e"))
+	c, _ = c.Update(runes(" -x"))
+	c, cmd := c.Update(tea.KeyMsg{Type: tea.KeyCtrlS})
+	c, _ = c.Update(cmd())
+	if got := c.Steps[1].Command; got != "go mod download -x" {
+		t.Errorf("edited command = %q", got)
+	}
+	if c.editing {
+		t.Error("editor still open after saving")
+	}
+
+	c, _ = c.Update(runes("k"))
+	c, _ = c.Update(runes("e"))
+	if c.editing || c.err == "" {
+		t.Errorf("a step that ran was opened for editing (err %q)", c.err)
+	}
+}
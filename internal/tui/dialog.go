@@ -2,26 +2,135 @@ package tui
 
 import (
 	"fmt"
+	"strings"
+
 	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/jrcrittenden/ai-shell/internal/egress"
+	executil "github.com/jrcrittenden/ai-shell/internal/exec"
+	"github.com/jrcrittenden/ai-shell/internal/placeholder"
+	"github.com/jrcrittenden/ai-shell/internal/policy"
+	"github.com/jrcrittenden/ai-shell/internal/risk"
+)
+
+// Decisions emitted by DialogModel. The parent closes the dialog on
+// ApproveMsg, DenyMsg and AlwaysAllowMsg.
+type (
+	// ApproveMsg runs Command with the chosen sandbox and limits.
+	ApproveMsg struct {
+		Command  string
+		Original string
+		Profile  executil.Profile
+		Limits   executil.Limits
+	}
+	// DenyMsg refuses Command; Reason is passed back to the model.
+	DenyMsg struct {
+		Command string
+		Reason  string
+	}
+	// EditMsg asks the parent to accept an edited command. It answers
+	// with SetCommand or EditError.
+	EditMsg struct {
+		Command  string
+		Original string
+	}
+	// ExplainMsg asks the parent for an explanation of Command, which it
+	// delivers by setting Explanation.
+	ExplainMsg struct {
+		Command string
+	}
+	// AlwaysAllowMsg approves Command and asks for it to be allowed without
+	// confirmation from now on.
+	AlwaysAllowMsg struct {
+		Command  string
+		Original string
+		Profile  executil.Profile
+		Limits   executil.Limits
+	}
 )
 
+// SuggestionsMsg offers completions for the placeholder Name.
+type SuggestionsMsg struct {
+	Name   string
+	Values []string
+}
+
+// dialogState is what the dialog is currently asking the user for.
+type dialogState int
+
+const (
+	stateChoose dialogState = iota
+	stateDeny
+	stateConfirm
+	stateLimits
+	stateEdit
+	stateFill
+)
+
+// choice is one of the dialog's buttons.
+type choice int
+
+const (
+	choiceApprove choice = iota
+	choiceDeny
+	choiceEdit
+	choiceExplain
+	choiceAlways
+)
+
+// DialogModel asks the user to approve a proposed command.
 type DialogModel struct {
-	viewport    viewport.Model
-	Command     string
-	Reason      string
-	width       int
-	height      int
-	keymap      DialogKeyMap
-	style       lipgloss.Style
+	Command string
+	Reason  string
+	Profile executil.Profile
+	Limits  executil.Limits
+	Risk    risk.Report
+	// Confirm, if set, must be typed by the user to approve the command.
+	Confirm string
+	// Original is the command as proposed by the model once the user has
+	// edited Command.
+	Original string
+	// Warnings are problems found by the pre-flight checks.
+	Warnings []string
+	// Egress lists where the command sends data and what it sends.
+	Egress egress.Report
+	// Injection lists instruction-like content found in the command output
+	// the model saw before proposing the command.
+	Injection []string
+	// Explanation is shown below the reason once the parent answers an
+	// ExplainMsg.
+	Explanation string
+
+	state    dialogState
+	selected choice
+	input    textinput.Model
+	// params are the command's <placeholder> names with one input each.
+	params   []string
+	fields   []textinput.Model
+	field    int
+	editor   Editor
+	err      string
+	viewport viewport.Model
+	width    int
+	height   int
+	keymap   DialogKeyMap
 }
 
 type DialogKeyMap struct {
-	Approve key.Binding
-	Reject  key.Binding
-	Edit    key.Binding
+	Approve     key.Binding
+	Deny        key.Binding
+	Edit        key.Binding
+	Explain     key.Binding
+	AlwaysAllow key.Binding
+	Sandbox     key.Binding
+	Limits      key.Binding
+	Left        key.Binding
+	Right       key.Binding
+	Select      key.Binding
+	Back        key.Binding
 }
 
 func DefaultDialogKeyMap() DialogKeyMap {
@@ -30,30 +139,185 @@ func DefaultDialogKeyMap() DialogKeyMap {
 			key.WithKeys("y", "Y"),
 			key.WithHelp("y", "approve"),
 		),
-		Reject: key.NewBinding(
+		Deny: key.NewBinding(
 			key.WithKeys("n", "N"),
-			key.WithHelp("n", "reject"),
+			key.WithHelp("n", "deny"),
 		),
 		Edit: key.NewBinding(
 			key.WithKeys("e", "E"),
 			key.WithHelp("e", "edit"),
 		),
+		Explain: key.NewBinding(
+			key.WithKeys("x", "X"),
+			key.WithHelp("x", "explain"),
+			key.WithDisabled(),
+		),
+		AlwaysAllow: key.NewBinding(
+			key.WithKeys("a", "A"),
+			key.WithHelp("a", "always allow"),
+		),
+		Sandbox: key.NewBinding(
+			key.WithKeys("s", "S"),
+			key.WithHelp("s", "sandbox"),
+		),
+		Limits: key.NewBinding(
+			key.WithKeys("l", "L"),
+			key.WithHelp("l", "limits"),
+		),
+		Left: key.NewBinding(
+			key.WithKeys("left", "shift+tab"),
+			key.WithHelp("←", "previous"),
+		),
+		Right: key.NewBinding(
+			key.WithKeys("right", "tab"),
+			key.WithHelp("→", "next"),
+		),
+		Select: key.NewBinding(
+			key.WithKeys("enter"),
+			key.WithHelp("enter", "select"),
+		),
+		Back: key.NewBinding(
+			key.WithKeys("esc"),
+			key.WithHelp("esc", "back"),
+		),
 	}
 }
 
+// EnableExplain shows the Explain button; it is hidden by default because
+// the parent must be able to answer ExplainMsg.
+func (k *DialogKeyMap) EnableExplain(enabled bool) {
+	k.Explain.SetEnabled(enabled)
+}
+
+var (
+	dialogBorder = lipgloss.NewStyle().
+			BorderStyle(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color("#874BFD")).
+			Padding(0, 1)
+	dialogLabel  = lipgloss.NewStyle().Bold(true)
+	dialogReason = lipgloss.NewStyle().Foreground(lipgloss.Color("#87ceeb"))
+	dialogError  = lipgloss.NewStyle().Foreground(lipgloss.Color("#ff5555"))
+	dialogHelp   = lipgloss.NewStyle().Foreground(lipgloss.Color("#626262"))
+	buttonStyle  = lipgloss.NewStyle().Padding(0, 1)
+	buttonActive = buttonStyle.
+			Foreground(lipgloss.Color("#ffffff")).
+			Background(lipgloss.Color("#874BFD"))
+)
+
+// NewDialog returns a dialog for command. Callers set the remaining fields
+// before showing it and should pass it the terminal size with SetSize.
 func NewDialog(command, reason string) *DialogModel {
 	vp := viewport.New(0, 0)
-	vp.Style = lipgloss.NewStyle().
-		BorderStyle(lipgloss.RoundedBorder()).
-		BorderForeground(lipgloss.Color("#874BFD"))
-
-	return &DialogModel{
-		viewport: vp,
+	vp.KeyMap = viewport.KeyMap{
+		Up:       key.NewBinding(key.WithKeys("up")),
+		Down:     key.NewBinding(key.WithKeys("down")),
+		PageUp:   key.NewBinding(key.WithKeys("pgup")),
+		PageDown: key.NewBinding(key.WithKeys("pgdown")),
+	}
+	m := &DialogModel{
 		Command:  command,
 		Reason:   reason,
+		viewport: vp,
 		keymap:   DefaultDialogKeyMap(),
-		style:    lipgloss.NewStyle().Padding(1, 2),
 	}
+	m.fill()
+	m.SetSize(80, 24)
+	return m
+}
+
+// Placeholders returns the names of the parameters the user still has to
+// fill in.
+func (m *DialogModel) Placeholders() []string {
+	return m.params
+}
+
+// fill asks for the command's placeholders, if it has any.
+func (m *DialogModel) fill() {
+	m.params = placeholder.Names(m.Command)
+	m.fields = nil
+	m.field = 0
+	if len(m.params) == 0 {
+		return
+	}
+	for _, name := range m.params {
+		in := textinput.New()
+		in.Prompt = "> "
+		in.Placeholder = name
+		in.ShowSuggestions = true
+		in.Width = m.innerWidth() - lipgloss.Width(name) - 6
+		m.fields = append(m.fields, in)
+	}
+	m.fields[0].Focus()
+	m.state = stateFill
+}
+
+// KeyMap returns the dialog's bindings so the parent can adjust them.
+func (m *DialogModel) KeyMap() *DialogKeyMap {
+	return &m.keymap
+}
+
+// SetSize fits the dialog into a terminal of the given size.
+func (m *DialogModel) SetSize(width, height int) {
+	m.width = max(min(width-4, 100), 20)
+	m.height = max(height-2, 10)
+	if m.state == stateEdit {
+		m.editor.SetWidth(m.innerWidth())
+	}
+	m.input.Width = m.innerWidth() - 3
+	for i, name := range m.params {
+		m.fields[i].Width = m.innerWidth() - lipgloss.Width(name) - 6
+	}
+	m.layout()
+}
+
+// innerWidth is the width available inside the border and padding.
+func (m *DialogModel) innerWidth() int {
+	return m.width - dialogBorder.GetHorizontalFrameSize()
+}
+
+// layout sizes the scrolling body to what is left after the footer.
+func (m *DialogModel) layout() {
+	body := m.body()
+	footer := lipgloss.Height(m.footer())
+	m.viewport.Width = m.innerWidth()
+	m.viewport.Height = max(min(lipgloss.Height(body), m.height-dialogBorder.GetVerticalFrameSize()-footer-1), 1)
+	m.viewport.SetContent(body)
+}
+
+// NextProfile switches the dialog to the built-in sandbox profile after the
+// current one.
+func (m *DialogModel) NextProfile() {
+	for i, p := range executil.Profiles {
+		if p.Name == m.Profile.Name {
+			m.Profile = executil.Profiles[(i+1)%len(executil.Profiles)]
+			return
+		}
+	}
+	m.Profile = executil.Profiles[0]
+}
+
+// SetCommand accepts an edit: the dialog shows command with its new risk
+// report and confirmation word and returns to the buttons.
+func (m *DialogModel) SetCommand(command string, report risk.Report, confirm string) {
+	if m.Original == "" {
+		m.Original = m.Command
+	}
+	if command == m.Original {
+		m.Original = ""
+	}
+	m.Command = command
+	m.Risk = report
+	m.Confirm = confirm
+	m.state = stateChoose
+	m.err = ""
+	m.fill()
+	m.layout()
+}
+
+// EditError rejects an edit and keeps the editor open with err shown.
+func (m *DialogModel) EditError(err string) {
+	m.editor.SetError(err)
+	m.layout()
 }
 
 func (m DialogModel) Init() tea.Cmd {
@@ -62,85 +326,415 @@ func (m DialogModel) Init() tea.Cmd {
 
 func (m DialogModel) Update(msg tea.Msg) (DialogModel, tea.Cmd) {
 	var cmd tea.Cmd
-
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
-		// Add debug info to content
-		debug := fmt.Sprintf("DEBUG: Dialog received window size: %dx%d\n", msg.Width, msg.Height)
-		m.viewport.SetContent(debug)
-		
-		m.width = msg.Width
-		m.height = msg.Height
-		m.viewport.Width = msg.Width - 4  // Account for padding
-		m.viewport.Height = msg.Height - 4 // Account for padding
-		m.updateContent()
+		m.SetSize(msg.Width, msg.Height)
+		return m, nil
+
+	case EditedMsg:
+		if m.state != stateEdit {
+			return m, nil
+		}
+		if msg.Err != nil {
+			m.EditError(msg.Err.Error())
+			return m, nil
+		}
+		if msg.Command == "" || msg.Command == m.Command {
+			m.state = stateChoose
+			m.layout()
+			return m, nil
+		}
+		edit := EditMsg{Command: msg.Command, Original: m.original()}
+		return m, func() tea.Msg { return edit }
+
+	case EditCanceledMsg:
+		m.state = stateChoose
+		m.layout()
+		return m, nil
+
+	case SuggestionsMsg:
+		for i, name := range m.params {
+			if name == msg.Name {
+				m.fields[i].SetSuggestions(msg.Values)
+			}
+		}
+		return m, nil
 
 	case tea.KeyMsg:
-		switch {
-		case key.Matches(msg, m.keymap.Approve):
-			return m, tea.Quit
-		case key.Matches(msg, m.keymap.Reject):
-			return m, tea.Quit
-		case key.Matches(msg, m.keymap.Edit):
-			return m, tea.Quit
+		switch m.state {
+		case stateChoose:
+			m, cmd = m.choose(msg)
+		case stateEdit:
+			m.editor, cmd = m.editor.Update(msg)
+		case stateFill:
+			m, cmd = m.fillKey(msg)
+		default:
+			m, cmd = m.prompt(msg)
 		}
+		m.layout()
+		return m, cmd
+
+	case tea.MouseMsg:
+		m.viewport, cmd = m.viewport.Update(msg)
+		return m, cmd
 	}
 
-	m.viewport, cmd = m.viewport.Update(msg)
+	// Cursor blinks and other internal messages of the inputs.
+	switch m.state {
+	case stateEdit:
+		m.editor, cmd = m.editor.Update(msg)
+	case stateDeny, stateConfirm, stateLimits:
+		m.input, cmd = m.input.Update(msg)
+	case stateFill:
+		m.fields[m.field], cmd = m.fields[m.field].Update(msg)
+	}
 	return m, cmd
 }
 
-func (m DialogModel) View() string {
-	// Create a centered dialog box
-	dialog := lipgloss.NewStyle().
-		BorderStyle(lipgloss.RoundedBorder()).
-		BorderForeground(lipgloss.Color("#874BFD")).
-		Padding(1, 2).
-		Width(m.width - 4).  // Leave some margin
-		Height(m.height - 4). // Leave some margin
-		Render(m.viewport.View())
-
-	// Center the dialog in the terminal
-	return lipgloss.Place(
-		m.width,
-		m.height,
-		lipgloss.Center,
-		lipgloss.Center,
-		dialog,
-	)
+// fillKey handles keys while placeholders are being filled in. Enter moves
+// to the next field and, after the last one, proposes the filled command
+// as an edit.
+func (m DialogModel) fillKey(msg tea.KeyMsg) (DialogModel, tea.Cmd) {
+	switch {
+	case key.Matches(msg, m.keymap.Back):
+		m.fields[m.field].Blur()
+		m.state = stateChoose
+		m.err = ""
+		return m, nil
+	case !key.Matches(msg, m.keymap.Select):
+		var cmd tea.Cmd
+		m.fields[m.field], cmd = m.fields[m.field].Update(msg)
+		return m, cmd
+	}
+
+	if m.fields[m.field].Value() == "" {
+		m.err = fmt.Sprintf("enter a value for <%s>", m.params[m.field])
+		return m, nil
+	}
+	m.err = ""
+	m.fields[m.field].Blur()
+	if m.field+1 < len(m.fields) {
+		m.field++
+		return m, m.fields[m.field].Focus()
+	}
+
+	values := map[string]string{}
+	for i, name := range m.params {
+		values[name] = m.fields[i].Value()
+	}
+	command, err := placeholder.Fill(m.Command, values)
+	if err != nil {
+		m.err = err.Error()
+		m.field = 0
+		return m, m.fields[0].Focus()
+	}
+	edit := EditMsg{Command: command, Original: m.original()}
+	return m, func() tea.Msg { return edit }
 }
 
-func (m *DialogModel) updateContent() {
-	// Add debug info
-	debug := fmt.Sprintf("DEBUG: Updating dialog content with size: %dx%d\n", m.width, m.height)
-	
-	// Calculate available height for content
-	contentHeight := m.height - 6 // Account for padding and borders
+// choose handles keys while the buttons are shown.
+func (m DialogModel) choose(msg tea.KeyMsg) (DialogModel, tea.Cmd) {
+	m.err = ""
+	switch {
+	case key.Matches(msg, m.keymap.Left):
+		m.move(-1)
+	case key.Matches(msg, m.keymap.Right):
+		m.move(1)
+	case key.Matches(msg, m.keymap.Select):
+		return m.activate(m.selected)
+	case key.Matches(msg, m.keymap.Approve):
+		return m.activate(choiceApprove)
+	case key.Matches(msg, m.keymap.Deny):
+		return m.activate(choiceDeny)
+	case key.Matches(msg, m.keymap.Edit):
+		return m.activate(choiceEdit)
+	case key.Matches(msg, m.keymap.Explain):
+		return m.activate(choiceExplain)
+	case key.Matches(msg, m.keymap.AlwaysAllow):
+		return m.activate(choiceAlways)
+	case key.Matches(msg, m.keymap.Sandbox):
+		m.NextProfile()
+	case key.Matches(msg, m.keymap.Limits):
+		return m.ask(stateLimits, m.Limits.String(), "timeout=30s cpu=10s mem=512M files=256 procs=64 output=10M")
+	default:
+		var cmd tea.Cmd
+		m.viewport, cmd = m.viewport.Update(msg)
+		return m, cmd
+	}
+	return m, nil
+}
 
-	// Create the content
-	content := lipgloss.JoinVertical(
-		lipgloss.Left,
-		debug,
-		lipgloss.NewStyle().Bold(true).Render("Command to execute:"),
-		lipgloss.NewStyle().Foreground(lipgloss.Color("#ff5555")).Render(m.Command),
-		"",
-		lipgloss.NewStyle().Bold(true).Render("Reason:"),
-		lipgloss.NewStyle().Foreground(lipgloss.Color("#87ceeb")).Render(m.Reason),
+// prompt handles keys while a line of input is being asked for.
+func (m DialogModel) prompt(msg tea.KeyMsg) (DialogModel, tea.Cmd) {
+	switch {
+	case key.Matches(msg, m.keymap.Back):
+		m.state = stateChoose
+		m.err = ""
+		return m, nil
+	case !key.Matches(msg, m.keymap.Select):
+		var cmd tea.Cmd
+		m.input, cmd = m.input.Update(msg)
+		return m, cmd
+	}
+
+	value := m.input.Value()
+	switch m.state {
+	case stateDeny:
+		deny := DenyMsg{Command: m.Command, Reason: value}
+		return m, func() tea.Msg { return deny }
+	case stateConfirm:
+		m.state = stateChoose
+		if value != m.Confirm {
+			m.err = fmt.Sprintf("%q does not match %q; the command was not run", value, m.Confirm)
+			return m, nil
+		}
+		approve := m.approval()
+		return m, func() tea.Msg { return approve }
+	case stateLimits:
+		limits, err := executil.ParseLimits(value, executil.Limits{})
+		if err != nil {
+			m.err = err.Error()
+			return m, nil
+		}
+		m.Limits = limits
+		m.state = stateChoose
+		m.err = ""
+	}
+	return m, nil
+}
+
+// activate performs the action of a button.
+func (m DialogModel) activate(c choice) (DialogModel, tea.Cmd) {
+	if !m.enabled(c) {
+		return m, nil
+	}
+	m.selected = c
+	switch c {
+	case choiceApprove:
+		if len(m.params) > 0 {
+			m.state = stateFill
+			return m, m.fields[m.field].Focus()
+		}
+		if m.Confirm != "" {
+			return m.ask(stateConfirm, "", fmt.Sprintf("type %q to run the command", m.Confirm))
+		}
+		approve := m.approval()
+		return m, func() tea.Msg { return approve }
+	case choiceDeny:
+		return m.ask(stateDeny, "", "reason for denial (optional)")
+	case choiceEdit:
+		m.state = stateEdit
+		m.editor = NewEditor(m.Command, m.innerWidth())
+		return m, nil
+	case choiceExplain:
+		explain := ExplainMsg{Command: m.Command}
+		return m, func() tea.Msg { return explain }
+	case choiceAlways:
+		always := AlwaysAllowMsg(m.approval())
+		return m, func() tea.Msg { return always }
+	}
+	return m, nil
+}
+
+// ask switches to state and prompts for a line of input.
+func (m DialogModel) ask(state dialogState, value, placeholder string) (DialogModel, tea.Cmd) {
+	m.state = state
+	m.input = textinput.New()
+	m.input.Prompt = "> "
+	m.input.Placeholder = placeholder
+	m.input.Width = m.innerWidth() - 3
+	m.input.SetValue(value)
+	return m, m.input.Focus()
+}
+
+func (m DialogModel) approval() ApproveMsg {
+	return ApproveMsg{Command: m.Command, Original: m.Original, Profile: m.Profile, Limits: m.Limits}
+}
+
+func (m DialogModel) original() string {
+	if m.Original != "" {
+		return m.Original
+	}
+	return m.Command
+}
+
+// enabled reports whether button c is offered. Only commands an allow rule
+// could apply to can be always-allowed; not those that need typed
+// confirmation or that the policy would still ask about.
+func (m DialogModel) enabled(c choice) bool {
+	switch c {
+	case choiceExplain:
+		return m.keymap.Explain.Enabled()
+	case choiceAlways:
+		return m.Confirm == "" && len(m.params) == 0 && policy.Allowable(policy.Input{Command: m.Command, Risk: m.Risk})
+	}
+	return true
+}
+
+// move selects the next enabled button in direction dir.
+func (m *DialogModel) move(dir int) {
+	for c := m.selected + choice(dir); c >= choiceApprove && c <= choiceAlways; c += choice(dir) {
+		if m.enabled(c) {
+			m.selected = c
+			return
+		}
+	}
+}
+
+// body renders the scrollable part of the dialog.
+func (m DialogModel) body() string {
+	width := m.innerWidth()
+	wrap := lipgloss.NewStyle().Width(width)
+
+	sandbox := m.Profile.Name
+	if sandbox == "" {
+		sandbox = "none"
+	}
+	if m.Profile.Description != "" {
+		sandbox += " — " + m.Profile.Description
+	}
+	limits := m.Limits.String()
+	if limits == "" {
+		limits = "none"
+	}
+
+	parts := []string{
+		dialogLabel.Render("Command:"),
+		wrap.Render(HighlightCommand(m.Command, m.Risk.Findings)),
+	}
+	if m.Original != "" {
+		parts = append(parts, wrap.Render("Edited from: "+m.Original))
+	}
+	parts = append(parts, "",
+		dialogLabel.Render("Reason:"),
+		wrap.Render(dialogReason.Render(m.Reason)),
 		"",
-		lipgloss.NewStyle().Bold(true).Render("Options:"),
-		lipgloss.JoinHorizontal(
-			lipgloss.Left,
-			m.keymap.Approve.Help().Key,
-			" - approve, ",
-			m.keymap.Reject.Help().Key,
-			" - reject, ",
-			m.keymap.Edit.Help().Key,
-			" - edit",
-		),
+		wrap.Render(RiskSummary(m.Risk)),
 	)
+	if m.Confirm != "" {
+		parts = append(parts, wrap.Render(fmt.Sprintf("Policy requires typing %q to approve", m.Confirm)))
+	}
+	if m.Egress.Network() {
+		parts = append(parts, "", dialogLabel.Render("Data leaves machine:"))
+		for _, d := range m.Egress.Destinations {
+			line := "  to    " + d.String()
+			if !d.Allowed {
+				line += dialogError.Render(" — not on the allow-list")
+			}
+			parts = append(parts, wrap.Render(line))
+		}
+		for _, p := range m.Egress.Payloads {
+			line := "  sends " + p.String()
+			if p.Sensitive {
+				line = dialogError.Render(line)
+			}
+			parts = append(parts, wrap.Render(line))
+		}
+		if len(m.Egress.Payloads) == 0 {
+			parts = append(parts, wrap.Render(dialogHelp.Render("  no local files, variables or output are sent")))
+		}
+	}
+	for _, w := range m.Warnings {
+		parts = append(parts, wrap.Render(dialogError.Render("Pre-flight: "+w)))
+	}
+	if len(m.Injection) > 0 {
+		parts = append(parts, "", wrap.Render(dialogError.Render("⚠ Suggested after command output that looks like a prompt injection:")))
+		for _, f := range m.Injection {
+			parts = append(parts, wrap.Render(dialogError.Render("  "+f)))
+		}
+	}
+	if m.Explanation != "" {
+		parts = append(parts, "", dialogLabel.Render("Explanation:"), wrap.Render(m.Explanation))
+	}
+	parts = append(parts, "",
+		wrap.Render("Sandbox: "+sandbox),
+		wrap.Render("Limits: "+limits),
+	)
+	return strings.Join(parts, "\n")
+}
 
-	// Set viewport content and dimensions
-	m.viewport.SetContent(content)
-	m.viewport.Width = m.width - 4  // Account for padding
-	m.viewport.Height = contentHeight
-} 
\ No newline at end of file
+// footer renders the buttons or the current prompt below the body.
+func (m DialogModel) footer() string {
+	var lines []string
+	if m.err != "" {
+		lines = append(lines, lipgloss.NewStyle().Width(m.innerWidth()).Render(dialogError.Render(m.err)))
+	}
+	switch m.state {
+	case stateChoose:
+		lines = append(lines, m.buttons(), m.help(m.keymap.Sandbox, m.keymap.Limits, m.keymap.Select))
+	case stateEdit:
+		lines = append(lines, m.editor.View())
+	case stateFill:
+		lines = append(lines, dialogLabel.Render("Fill in the parameters:"))
+		width := 0
+		for _, name := range m.params {
+			width = max(width, lipgloss.Width(name)+2)
+		}
+		for i, name := range m.params {
+			label := lipgloss.NewStyle().Width(width).Render("<" + name + ">")
+			lines = append(lines, label+" "+m.fields[i].View())
+		}
+		lines = append(lines, dialogHelp.Render("enter next • tab complete • ↓/↑ cycle suggestions • esc back"))
+	default:
+		label := map[dialogState]string{
+			stateDeny:    "Reason for denial:",
+			stateConfirm: "Confirm:",
+			stateLimits:  "Limits:",
+		}[m.state]
+		lines = append(lines, dialogLabel.Render(label), m.input.View(), m.help(m.keymap.Select, m.keymap.Back))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m DialogModel) buttons() string {
+	labels := []struct {
+		choice choice
+		label  string
+		key    key.Binding
+	}{
+		{choiceApprove, "✓ Approve", m.keymap.Approve},
+		{choiceDeny, "✗ Deny", m.keymap.Deny},
+		{choiceEdit, "✎ Edit", m.keymap.Edit},
+		{choiceExplain, "? Explain", m.keymap.Explain},
+		{choiceAlways, "★ Always allow", m.keymap.AlwaysAllow},
+	}
+	// Buttons wrap as a whole when the dialog is narrow.
+	var lines []string
+	line := ""
+	for _, b := range labels {
+		if !m.enabled(b.choice) {
+			continue
+		}
+		style := buttonStyle
+		if b.choice == m.selected {
+			style = buttonActive
+		}
+		button := style.Render(fmt.Sprintf("%s (%s)", b.label, b.key.Help().Key))
+		switch {
+		case line == "":
+			line = button
+		case lipgloss.Width(line)+1+lipgloss.Width(button) > m.innerWidth():
+			lines = append(lines, line)
+			line = button
+		default:
+			line += " " + button
+		}
+	}
+	return strings.Join(append(lines, line), "\n")
+}
+
+func (m DialogModel) help(bindings ...key.Binding) string {
+	var parts []string
+	for _, b := range bindings {
+		parts = append(parts, b.Help().Key+" "+b.Help().Desc)
+	}
+	if m.viewport.TotalLineCount() > m.viewport.Height {
+		parts = append(parts, "↑/↓ scroll")
+	}
+	return dialogHelp.Render(strings.Join(parts, " • "))
+}
+
+func (m DialogModel) View() string {
+	m.layout()
+	return dialogBorder.Width(m.width - 2).Render(m.viewport.View() + "\n\n" + m.footer())
+}
@@ -0,0 +1,164 @@
+package tui
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textarea"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// EditedMsg is sent when the user finishes editing a command, either in
+// the inline Editor or in $EDITOR.
+type EditedMsg struct {
+	Command string
+	Err     error
+}
+
+// EditCanceledMsg is sent when the user leaves the Editor without saving.
+type EditCanceledMsg struct{}
+
+// EditorKeyMap holds the Editor's bindings.
+type EditorKeyMap struct {
+	Save     key.Binding
+	Cancel   key.Binding
+	External key.Binding
+}
+
+func DefaultEditorKeyMap() EditorKeyMap {
+	return EditorKeyMap{
+		Save: key.NewBinding(
+			key.WithKeys("ctrl+s"),
+			key.WithHelp("ctrl+s", "save"),
+		),
+		Cancel: key.NewBinding(
+			key.WithKeys("esc"),
+			key.WithHelp("esc", "cancel"),
+		),
+		External: key.NewBinding(
+			key.WithKeys("ctrl+e"),
+			key.WithHelp("ctrl+e", "$EDITOR"),
+		),
+	}
+}
+
+// Editor is a multi-line editor for changing a proposed command before it
+// is run.
+type Editor struct {
+	textarea textarea.Model
+	keymap   EditorKeyMap
+	err      string
+}
+
+// NewEditor returns a focused Editor holding command.
+func NewEditor(command string, width int) Editor {
+	ta := textarea.New()
+	ta.ShowLineNumbers = false
+	ta.Prompt = "│ "
+	ta.CharLimit = 0
+	ta.SetWidth(width)
+	ta.SetHeight(min(max(strings.Count(command, "\n")+2, 3), 10))
+	ta.SetValue(command)
+	ta.Focus()
+	return Editor{textarea: ta, keymap: DefaultEditorKeyMap()}
+}
+
+// SetError shows err below the editor, e.g. when the edited command was
+// rejected.
+func (e *Editor) SetError(err string) {
+	e.err = err
+}
+
+// SetWidth resizes the editor.
+func (e *Editor) SetWidth(width int) {
+	e.textarea.SetWidth(width)
+}
+
+// Value returns the edited command.
+func (e Editor) Value() string {
+	return strings.TrimSpace(e.textarea.Value())
+}
+
+func (e Editor) Update(msg tea.Msg) (Editor, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch {
+		case key.Matches(msg, e.keymap.Save):
+			command := e.Value()
+			return e, func() tea.Msg { return EditedMsg{Command: command} }
+		case key.Matches(msg, e.keymap.Cancel):
+			return e, func() tea.Msg { return EditCanceledMsg{} }
+		case key.Matches(msg, e.keymap.External):
+			return e, OpenEditor(e.Value())
+		}
+	}
+	var cmd tea.Cmd
+	e.textarea, cmd = e.textarea.Update(msg)
+	return e, cmd
+}
+
+func (e Editor) View() string {
+	help := lipgloss.NewStyle().Foreground(lipgloss.Color("#626262")).Render(
+		e.keymap.Save.Help().Key + " " + e.keymap.Save.Help().Desc + " • " +
+			e.keymap.External.Help().Key + " " + e.keymap.External.Help().Desc + " • " +
+			e.keymap.Cancel.Help().Key + " " + e.keymap.Cancel.Help().Desc)
+	view := lipgloss.JoinVertical(lipgloss.Left,
+		lipgloss.NewStyle().Bold(true).Render("Edit command:"),
+		e.textarea.View(),
+		help,
+	)
+	if e.err != "" {
+		view += "\n" + lipgloss.NewStyle().Foreground(lipgloss.Color("#ff5555")).Render(e.err)
+	}
+	return view
+}
+
+// OpenEditor suspends the program to edit command in $VISUAL or $EDITOR
+// (vi if neither is set) and reports the result as an EditedMsg.
+func OpenEditor(command string) tea.Cmd {
+	dir, path, err := commandFile(command)
+	if err != nil {
+		return func() tea.Msg { return EditedMsg{Err: err} }
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	// $EDITOR may carry arguments, e.g. "code --wait".
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", path)
+	return tea.ExecProcess(cmd, func(err error) tea.Msg {
+		defer os.RemoveAll(dir)
+		if err != nil {
+			return EditedMsg{Err: err}
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return EditedMsg{Err: err}
+		}
+		return EditedMsg{Command: strings.TrimSpace(string(data))}
+	})
+}
+
+// commandFile writes command to a file for the editor. The command may
+// hold secrets the user filled in, so the file is readable by the user
+// only and sits in a directory of its own that nobody else can list or
+// swap the file in. The caller removes dir.
+func commandFile(command string) (dir, path string, err error) {
+	dir, err = os.MkdirTemp("", "ai-shell-edit-*")
+	if err != nil {
+		return "", "", err
+	}
+	path = filepath.Join(dir, "command.sh")
+	if err := os.WriteFile(path, []byte(command+"\n"), 0o600); err != nil {
+		os.RemoveAll(dir)
+		return "", "", err
+	}
+	return dir, path, nil
+}
@@ -0,0 +1,120 @@
+package tui
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/exp/golden"
+	"github.com/charmbracelet/x/exp/teatest"
+)
+
+// editorHarness hosts an Editor and quits on the first message it sends
+// when done.
+type editorHarness struct {
+	editor Editor
+	done   tea.Msg
+}
+
+func (h editorHarness) Init() tea.Cmd {
+	return nil
+}
+
+func (h editorHarness) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg.(type) {
+	case EditedMsg, EditCanceledMsg:
+		h.done = msg
+		return h, tea.Quit
+	}
+	var cmd tea.Cmd
+	h.editor, cmd = h.editor.Update(msg)
+	return h, cmd
+}
+
+func (h editorHarness) View() string {
+	return h.editor.View()
+}
+
+func runEditor(t *testing.T, e Editor, keys ...tea.Msg) editorHarness {
+	t.Helper()
+	tm := teatest.NewTestModel(t, editorHarness{editor: e}, teatest.WithInitialTermSize(60, 12))
+	for _, k := range keys {
+		tm.Send(k)
+	}
+	return tm.FinalModel(t, teatest.WithFinalTimeout(2*time.Second)).(editorHarness)
+}
+
+func TestEditorSave(t *testing.T) {
+	h := runEditor(t, NewEditor("ls -la", 40), runes(" /tmp"), tea.KeyMsg{Type: tea.KeyCtrlS})
+	golden.RequireEqual(t, []byte(h.View()))
+	if want := (EditedMsg{Command: "ls -la /tmp"}); !reflect.DeepEqual(h.done, want) {
+		t.Errorf("done = %#v, want %#v", h.done, want)
+	}
+}
+
+func TestEditorCancel(t *testing.T) {
+	h := runEditor(t, NewEditor("ls -la", 40), runes(" /tmp"), tea.KeyMsg{Type: tea.KeyEsc})
+	golden.RequireEqual(t, []byte(h.View()))
+	if _, ok := h.done.(EditCanceledMsg); !ok {
+		t.Errorf("done = %#v", h.done)
+	}
+
+	// The dialog goes back to the buttons with the command unchanged.
+	d, _ := testDialog("ls -la").Update(runes("e"))
+	d, _ = d.Update(runes(" /tmp"))
+	d, _ = d.Update(h.done)
+	if d.state != stateChoose || d.Command != "ls -la" || d.Original != "" {
+		t.Errorf("after cancel: state %v, command %q from %q", d.state, d.Command, d.Original)
+	}
+}
+
+func TestEditorError(t *testing.T) {
+	d := testDialog("ls -la")
+	h := run(t, d, 80, 24, runes("e"), runes(" | sh"), tea.KeyMsg{Type: tea.KeyCtrlS})
+	edit, ok := h.decision.(EditMsg)
+	if !ok {
+		t.Fatalf("decision = %#v", h.decision)
+	}
+	// The parent rejects the edit; the editor stays open with the reason.
+	h.dialog.EditError(`Denied by policy "no remote exec": Download the script and show it first.`)
+	golden.RequireEqual(t, []byte(h.View()))
+	if edit.Command != "ls -la | sh" || h.dialog.editor.Value() != "ls -la | sh" {
+		t.Errorf("edit = %#v, editor holds %q", edit, h.dialog.editor.Value())
+	}
+}
+
+func TestOpenEditor(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "edit.sh")
+	seen := filepath.Join(dir, "seen")
+	write := `#!/bin/sh
+ls -ld "$1" "$(dirname "$1")" > ` + seen + `
+sed -i 's/ls/ls -la/' "$1"
+`
+	if err := os.WriteFile(script, []byte(write), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VISUAL", script)
+
+	h := runEditor(t, NewEditor("ls build", 40), tea.KeyMsg{Type: tea.KeyCtrlE})
+	if want := (EditedMsg{Command: "ls -la build"}); !reflect.DeepEqual(h.done, want) {
+		t.Fatalf("done = %#v, want %#v", h.done, want)
+	}
+	data, err := os.ReadFile(seen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ls -ld sorts its arguments, so the directory comes first.
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "drwx------ ") || !strings.HasPrefix(lines[1], "-rw------- ") {
+		t.Fatalf("editor saw %q, want a file only the user can read in a directory only they can list", lines)
+	}
+	fields := strings.Fields(lines[0])
+	if _, err := os.Stat(fields[len(fields)-1]); !os.IsNotExist(err) {
+		t.Errorf("temporary directory left behind: %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package tui
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/jrcrittenden/ai-shell/internal/risk"
+)
+
+// riskStyles colour text by risk level.
+var riskStyles = map[risk.Level]lipgloss.Style{
+	risk.Low:      lipgloss.NewStyle().Foreground(lipgloss.Color("#50fa7b")),
+	risk.Medium:   lipgloss.NewStyle().Foreground(lipgloss.Color("#f1fa8c")),
+	risk.High:     lipgloss.NewStyle().Foreground(lipgloss.Color("#ffb86c")).Bold(true),
+	risk.Critical: lipgloss.NewStyle().Foreground(lipgloss.Color("#ff5555")).Bold(true).Underline(true),
+}
+
+// HighlightCommand renders command with the spans of each finding coloured
+// by its level. Where spans overlap the higher level wins.
+func HighlightCommand(command string, findings []risk.Finding) string {
+	levels := make([]risk.Level, len(command))
+	marked := make([]bool, len(command))
+	for _, f := range findings {
+		for i := f.Span.Start; i < f.Span.End && i < len(command); i++ {
+			if !marked[i] || f.Level > levels[i] {
+				levels[i] = f.Level
+				marked[i] = true
+			}
+		}
+	}
+
+	var sb strings.Builder
+	for start := 0; start < len(command); {
+		end := start + 1
+		for end < len(command) && marked[end] == marked[start] && levels[end] == levels[start] {
+			end++
+		}
+		if marked[start] {
+			sb.WriteString(riskStyles[levels[start]].Render(command[start:end]))
+		} else {
+			sb.WriteString(command[start:end])
+		}
+		start = end
+	}
+	return sb.String()
+}
+
+// RiskSummary renders the level of r and one line per finding.
+func RiskSummary(r risk.Report) string {
+	lines := []string{"Risk: " + riskStyles[r.Level].Render(strings.ToUpper(r.Level.String()))}
+	for _, f := range r.Findings {
+		lines = append(lines, "  • "+riskStyles[f.Level].Render(f.Reason))
+	}
+	return strings.Join(lines, "\n")
+}
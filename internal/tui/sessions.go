@@ -0,0 +1,241 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/jrcrittenden/ai-shell/internal/sessions"
+)
+
+// Choices emitted by SessionsModel. The parent closes the browser on
+// SessionOpenMsg and SessionsClosedMsg.
+type (
+	// SessionOpenMsg switches to the session with ID.
+	SessionOpenMsg struct {
+		ID string
+	}
+	// SessionDeleteMsg deletes the session with ID, which the browser has
+	// already taken off its list.
+	SessionDeleteMsg struct {
+		ID string
+	}
+	// SessionsClosedMsg closes the browser without switching.
+	SessionsClosedMsg struct{}
+)
+
+type SessionsKeyMap struct {
+	Up     key.Binding
+	Down   key.Binding
+	Open   key.Binding
+	Delete key.Binding
+	Close  key.Binding
+}
+
+func DefaultSessionsKeyMap() SessionsKeyMap {
+	return SessionsKeyMap{
+		Up: key.NewBinding(
+			key.WithKeys("up", "ctrl+k"),
+			key.WithHelp("↑/↓", "select"),
+		),
+		Down: key.NewBinding(
+			key.WithKeys("down", "ctrl+j"),
+			key.WithHelp("↓", "next"),
+		),
+		Open: key.NewBinding(
+			key.WithKeys("enter"),
+			key.WithHelp("enter", "open"),
+		),
+		Delete: key.NewBinding(
+			key.WithKeys("ctrl+d"),
+			key.WithHelp("ctrl+d", "delete"),
+		),
+		Close: key.NewBinding(
+			key.WithKeys("esc"),
+			key.WithHelp("esc", "close"),
+		),
+	}
+}
+
+// SessionsModel lists saved sessions, most recent first, for the user to
+// search by typing and to open or delete one.
+type SessionsModel struct {
+	// Current is the id of the session in use, which is marked and cannot
+	// be deleted.
+	Current string
+
+	all      []*sessions.Session
+	shown    []*sessions.Session
+	filter   string
+	selected int
+	err      string
+	width    int
+	height   int
+	keymap   SessionsKeyMap
+}
+
+// NewSessions returns a browser of list.
+func NewSessions(list []*sessions.Session, current string) *SessionsModel {
+	m := &SessionsModel{
+		Current: current,
+		all:     list,
+		keymap:  DefaultSessionsKeyMap(),
+	}
+	m.refilter()
+	m.SetSize(80, 24)
+	return m
+}
+
+// SetSize fits the browser into a terminal of the given size.
+func (m *SessionsModel) SetSize(width, height int) {
+	m.width = max(min(width-4, 110), 30)
+	m.height = max(height-2, 10)
+}
+
+func (m *SessionsModel) innerWidth() int {
+	return m.width - dialogBorder.GetHorizontalFrameSize()
+}
+
+// refilter shows the sessions matching the filter.
+func (m *SessionsModel) refilter() {
+	m.shown = nil
+	for _, s := range m.all {
+		if m.filter == "" || s.Matches(m.filter) {
+			m.shown = append(m.shown, s)
+		}
+	}
+	m.selected = max(min(m.selected, len(m.shown)-1), 0)
+}
+
+func (m SessionsModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m SessionsModel) Update(msg tea.Msg) (SessionsModel, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.SetSize(msg.Width, msg.Height)
+	case tea.KeyMsg:
+		return m.key(msg)
+	}
+	return m, nil
+}
+
+func (m SessionsModel) key(msg tea.KeyMsg) (SessionsModel, tea.Cmd) {
+	m.err = ""
+	switch {
+	case key.Matches(msg, m.keymap.Up):
+		m.selected = max(m.selected-1, 0)
+	case key.Matches(msg, m.keymap.Down):
+		m.selected = max(min(m.selected+1, len(m.shown)-1), 0)
+	case key.Matches(msg, m.keymap.Open):
+		if len(m.shown) == 0 {
+			m.err = "no session to open"
+			break
+		}
+		id := m.shown[m.selected].ID
+		return m, func() tea.Msg { return SessionOpenMsg{ID: id} }
+	case key.Matches(msg, m.keymap.Delete):
+		if len(m.shown) == 0 {
+			break
+		}
+		id := m.shown[m.selected].ID
+		if id == m.Current {
+			m.err = "the session in use cannot be deleted"
+			break
+		}
+		for i, s := range m.all {
+			if s.ID == id {
+				m.all = append(m.all[:i:i], m.all[i+1:]...)
+				break
+			}
+		}
+		m.refilter()
+		return m, func() tea.Msg { return SessionDeleteMsg{ID: id} }
+	case key.Matches(msg, m.keymap.Close):
+		return m, func() tea.Msg { return SessionsClosedMsg{} }
+	case msg.Type == tea.KeyBackspace:
+		if r := []rune(m.filter); len(r) > 0 {
+			m.filter = string(r[:len(r)-1])
+			m.refilter()
+		}
+	case msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace:
+		if msg.Type == tea.KeySpace {
+			m.filter += " "
+		} else {
+			m.filter += string(msg.Runes)
+		}
+		m.selected = 0
+		m.refilter()
+	}
+	return m, nil
+}
+
+// row renders session s on one line.
+func (m SessionsModel) row(s *sessions.Session, selected bool) string {
+	mark := " "
+	if s.ID == m.Current {
+		mark = "*"
+	}
+	line := mark + " " + s.Summary()
+	if w := m.innerWidth() - 2; lipgloss.Width(line) > w {
+		line = string([]rune(line)[:max(w-1, 0)]) + "…"
+	}
+	if selected {
+		return checklistSelected.Render("› " + line)
+	}
+	return "  " + line
+}
+
+// list renders the rows around the selection that fit in height lines.
+func (m SessionsModel) list(height int) string {
+	if len(m.shown) == 0 {
+		if m.filter != "" {
+			return dialogHelp.Render("  no session matches")
+		}
+		return dialogHelp.Render("  no saved sessions")
+	}
+	// Leave room for the "more" lines.
+	height = max(height-2, 1)
+	from, to := 0, len(m.shown)
+	for to-from > height {
+		if m.selected-from > to-1-m.selected {
+			from++
+		} else {
+			to--
+		}
+	}
+	var parts []string
+	if from > 0 {
+		parts = append(parts, dialogHelp.Render(fmt.Sprintf("  ↑ %d more", from)))
+	}
+	for i := from; i < to; i++ {
+		parts = append(parts, m.row(m.shown[i], i == m.selected))
+	}
+	if to < len(m.shown) {
+		parts = append(parts, dialogHelp.Render(fmt.Sprintf("  ↓ %d more", len(m.shown)-to)))
+	}
+	return strings.Join(parts, "\n")
+}
+
+func (m SessionsModel) help() string {
+	parts := []string{"type to search"}
+	for _, b := range []key.Binding{m.keymap.Up, m.keymap.Open, m.keymap.Delete, m.keymap.Close} {
+		parts = append(parts, b.Help().Key+" "+b.Help().Desc)
+	}
+	return lipgloss.NewStyle().Width(m.innerWidth()).Render(dialogHelp.Render(strings.Join(parts, " • ")))
+}
+
+func (m SessionsModel) View() string {
+	wrap := lipgloss.NewStyle().Width(m.innerWidth())
+	head := wrap.Render(dialogLabel.Render("Sessions:") + " " + fmt.Sprintf("%d of %d", len(m.shown), len(m.all)) +
+		"\n" + dialogLabel.Render("Search:") + " " + m.filter + "▏")
+	foot := m.help()
+	if m.err != "" {
+		foot = wrap.Render(dialogError.Render(m.err)) + "\n" + foot
+	}
+	room := m.height - dialogBorder.GetVerticalFrameSize() - lipgloss.Height(head) - lipgloss.Height(foot) - 2
+	return dialogBorder.Width(m.width - 2).Render(head + "\n\n" + m.list(room) + "\n\n" + foot)
+}
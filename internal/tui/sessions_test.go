@@ -0,0 +1,73 @@
+package tui
+
+import (
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/exp/golden"
+	"github.com/jrcrittenden/ai-shell/internal/sessions"
+	"github.com/jrcrittenden/ai-shell/llm"
+)
+
+func testSessions() []*sessions.Session {
+	at := time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC)
+	var list []*sessions.Session
+	for i, title := range []string{"restart nginx after the config change", "find files over 1G", "set up the Go toolchain"} {
+		list = append(list, &sessions.Session{
+			ID:       "20261018-09300" + string(rune('0'+i)) + "-abcdef",
+			Title:    title,
+			Updated:  at.Add(-time.Duration(i) * time.Hour),
+			Backend:  "openai",
+			Messages: make([]llm.Message, 2*(i+1)),
+		})
+	}
+	return list
+}
+
+func TestSessionsView(t *testing.T) {
+	m := NewSessions(testSessions(), "20261018-093000-abcdef")
+	m.SetSize(100, 16)
+	browser, _ := m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	golden.RequireEqual(t, []byte(browser.View()))
+}
+
+func TestSessionsKeys(t *testing.T) {
+	m := *NewSessions(testSessions(), "20261018-093000-abcdef")
+
+	// Typing filters the list.
+	for _, k := range []tea.KeyMsg{runes("G"), runes("o"), {Type: tea.KeySpace}, runes("t")} {
+		m, _ = m.Update(k)
+	}
+	if len(m.shown) != 1 || m.shown[0].Title != "set up the Go toolchain" {
+		t.Fatalf("filter %q shows %v", m.filter, m.shown)
+	}
+	m, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if msg := cmd(); msg != (SessionOpenMsg{ID: "20261018-093002-abcdef"}) {
+		t.Errorf("enter = %#v", msg)
+	}
+
+	// Clearing the filter shows everything again.
+	for range 4 {
+		m, _ = m.Update(tea.KeyMsg{Type: tea.KeyBackspace})
+	}
+	if len(m.shown) != 3 {
+		t.Fatalf("after clearing the filter %d shown", len(m.shown))
+	}
+
+	// The session in use cannot be deleted; others can.
+	m.selected = 0
+	m, cmd = m.Update(tea.KeyMsg{Type: tea.KeyCtrlD})
+	if cmd != nil || m.err == "" {
+		t.Errorf("deleted the current session")
+	}
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	m, cmd = m.Update(tea.KeyMsg{Type: tea.KeyCtrlD})
+	if msg := cmd(); msg != (SessionDeleteMsg{ID: "20261018-093001-abcdef"}) || len(m.all) != 2 {
+		t.Errorf("ctrl+d = %#v, %d left", msg, len(m.all))
+	}
+
+	if _, cmd = m.Update(tea.KeyMsg{Type: tea.KeyEsc}); cmd() != (SessionsClosedMsg{}) {
+		t.Error("esc did not close the browser")
+	}
+}
@@ -1,11 +1,27 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
 
 	"github.com/charmbracelet/bubbletea"
+	"github.com/jrcrittenden/ai-shell/agent"
+	"github.com/jrcrittenden/ai-shell/internal/audit"
+	"github.com/jrcrittenden/ai-shell/internal/autopilot"
+	"github.com/jrcrittenden/ai-shell/internal/checkpoint"
+	executil "github.com/jrcrittenden/ai-shell/internal/exec"
+	"github.com/jrcrittenden/ai-shell/internal/export"
+	"github.com/jrcrittenden/ai-shell/internal/injection"
+	"github.com/jrcrittenden/ai-shell/internal/output"
+	"github.com/jrcrittenden/ai-shell/internal/pipe"
+	"github.com/jrcrittenden/ai-shell/internal/policy"
+	"github.com/jrcrittenden/ai-shell/internal/preflight"
+	"github.com/jrcrittenden/ai-shell/internal/redact"
+	"github.com/jrcrittenden/ai-shell/internal/sessions"
 	"github.com/jrcrittenden/ai-shell/llm"
 )
 
@@ -14,27 +30,309 @@ var (
 	apiKey  = flag.String("api-key", "", "OpenAI API key")
 	url     = flag.String("url", "", "URL for local operator")
 	model   = flag.String("model", "gpt-4", "Model to use")
+
+	outputLines      = flag.Int("output-lines", output.DefaultBudget().MaxLines, "Max lines of command output sent to the model")
+	outputBytes      = flag.Int("output-bytes", output.DefaultBudget().MaxBytes, "Max bytes of command output sent to the model")
+	summaryBackend   = flag.String("summary-backend", "", "Backend used to summarize very large outputs (empty disables)")
+	summarizeAbove   = flag.Int("summarize-above", 64<<10, "Output size in bytes above which the summary backend is used")
+	sandbox          = flag.String("sandbox", "none", "Default sandbox profile for approved commands (none, project, offline, readonly)")
+	policyFile       = flag.String("policy", "", "Policy file with auto-approve and deny rules (default ~/.config/ai-shell/policy.json if present)")
+	auditFile        = flag.String("audit", audit.DefaultPath(), "Audit log of proposed and executed commands (empty disables)")
+	preflightRetries = flag.Int("preflight-retries", 3, "Times a command failing pre-flight checks is sent back to the model before it is shown anyway")
+	redactSecrets    = flag.Bool("redact", true, "Replace secrets with placeholders in everything sent to the model")
+	checkpoints      = flag.Bool("checkpoints", false, "Snapshot the working directory before each approved command so it can be undone with ctrl+z")
+	autonomous       = flag.Bool("auto", false, "Start in autonomous mode: commands the policy allows run without asking until the task is done")
+	planFirst        = flag.Bool("plan", false, "Start in plan mode: each prompt asks for a plan of steps to review and approve before they run")
+	autoLimits       = flag.String("auto-limits", autopilot.DefaultLimits().String(), "Limits of an autonomous run, e.g. \"steps=20 time=15m tokens=200k\"")
+	limits           = flag.String("limits", "timeout=10m output=100M", "Default resource limits, e.g. \"timeout=30s cpu=10s mem=512M files=256 procs=64 output=10M\"")
+
+	sessionDir = flag.String("session-dir", sessions.DefaultDir(), "Directory conversations are autosaved in (empty disables)")
+	resume     = flag.String("resume", "", "Resume a saved session by id or unique prefix, or \"last\" for the most recent")
+
+	prompt     = flag.String("p", "", "Send this prompt without starting the TUI, print the answer and exit")
+	jsonEvents = flag.Bool("json", false, "With -p, write the run as a stream of JSON events, one per line")
+	stdinBytes = flag.Int("stdin-bytes", pipe.DefaultMaxBytes, "Max bytes of piped input read as context for the first prompt; the rest is dropped")
+	commands   = flag.String("commands", commandsPrint, "With -p, what to do with proposed commands: print (after the answer), stdout (only the commands go to stdout) or execute (after a y/N confirmation on the terminal)")
 )
 
 func main() {
+	// Re-executions of this binary as the sandbox helper never return.
+	executil.SandboxInit()
+
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		os.Exit(runVerify(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "init" {
+		os.Exit(runInit(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "sessions" {
+		os.Exit(runSessions(os.Args[2:]))
+	}
+
+	var redactPatterns []string
+	flag.Func("redact-pattern", "Extra regular expression to redact, repeatable; a capture group limits redaction to the group", func(s string) error {
+		redactPatterns = append(redactPatterns, s)
+		return nil
+	})
 	flag.Parse()
 
+	profile, ok := executil.LookupProfile(*sandbox)
+	if !ok {
+		fmt.Printf("Error: unknown sandbox profile %q\n", *sandbox)
+		os.Exit(2)
+	}
+	defaultLimits, err := executil.ParseLimits(*limits, executil.Limits{})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	runLimits, err := autopilot.ParseLimits(*autoLimits, autopilot.Limits{})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+
 	// Create the clients for runtime switching
 	clients := makeClients()
+	var redactor *redact.Redactor
+	if *redactSecrets {
+		if redactor, err = redact.New(redactPatterns); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(2)
+		}
+		for name, c := range clients {
+			clients[name] = redact.Client(c, redactor)
+		}
+	}
+
+	// Input piped in, as in "kubectl get pods | ai-shell 'which pods are
+	// failing?'", is context for the first prompt, which may also be given
+	// as arguments.
+	question := *prompt
+	if question == "" {
+		question = strings.Join(flag.Args(), " ")
+	}
+	var in pipe.Input
+	if pipe.Piped(os.Stdin) {
+		if in, err = pipe.Read(os.Stdin, *stdinBytes); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: reading stdin: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	headlessRun := *prompt != "" || (question != "" || in.Text != "") && pipe.Piped(os.Stdout)
+	if headlessRun && question == "" {
+		question = "Explain this input."
+	}
+
+	executor := agent.Local{Grace: interruptGrace}
+	if redactor != nil {
+		executor.Rewrite = redactor.Restore
+	}
+	opts := agent.Options{
+		Executor: executor,
+		Outputs:  &output.Store{},
+		Budget: output.Budget{
+			MaxLines:       *outputLines,
+			MaxBytes:       *outputBytes,
+			SummarizeAbove: *summarizeAbove,
+		},
+		Summarizer: clients[*summaryBackend],
+	}
+	pol, err := loadPolicy(*policyFile)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	var log *audit.Log
+	if *auditFile != "" {
+		if log, err = audit.Open(*auditFile); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	var block string
+	if in.Text != "" {
+		block = in.Block(opts.Outputs, opts.Budget)
+	}
+
+	if headlessRun {
+		switch *commands {
+		case commandsPrint, commandsStdout, commandsExecute:
+		default:
+			fmt.Fprintf(os.Stderr, "Error: unknown -commands %q (print, stdout or execute)\n", *commands)
+			os.Exit(exitUsage)
+		}
+		client, ok := clients[*backend]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Error: unknown backend %q\n", *backend)
+			os.Exit(exitUsage)
+		}
+		// ctrl+c interrupts the running command, then ends the run.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		h := &headless{
+			session:  agent.New(client, opts),
+			commands: *commands,
+			json:     *jsonEvents,
+			out:      os.Stdout,
+			errOut:   os.Stderr,
+			ask:      ttyAsk,
+			policy:   pol,
+			sandbox:  profile,
+			limits:   defaultLimits,
+			audit:    log,
+			redactor: redactor,
+			backend:  *backend,
+			model:    *model,
+		}
+		if findings := injection.Scan(in.Text); len(findings) > 0 {
+			h.suspicious("stdin", findings)
+		}
+		code := h.run(ctx, pipe.Attach(block, question))
+		stop()
+		os.Exit(code)
+	}
 
 	// Create the model with the requested backend active
-	m := NewModel(clients, *backend)
+	m := NewModel(clients, *backend, opts)
+	m.redactor = redactor
+	m.sandbox = profile
+	m.limits = defaultLimits
+	m.auto = *autonomous
+	m.autoLimits = runLimits
+	m.planMode = *planFirst && !*autonomous
+	m.policy, m.allowFile = pol, policy.AllowedPath()
+	m.audit = log
+	if in.Text != "" {
+		m.attachInput(in, block)
+	}
+	m.input.SetValue(question)
+	if *checkpoints {
+		dir, _ := os.Getwd()
+		if m.checkpoints, err = checkpoint.Open(dir, checkpoint.DefaultDir()); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	m.modelName = *model
+	m.maxPreflightRetries = *preflightRetries
+	m.aliases = preflight.Aliases(context.Background())
+	if *sessionDir != "" {
+		if m.store, err = sessions.Open(*sessionDir); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(2)
+		}
+		dir, _ := os.Getwd()
+		m.saved = sessions.New(*backend, *model, dir)
+		if *resume != "" {
+			var s *sessions.Session
+			if *resume == "last" {
+				s, err = m.store.Latest()
+			} else {
+				s, err = m.store.Load(*resume)
+			}
+			if err != nil {
+				fmt.Printf("Error: cannot resume: %v\n", err)
+				os.Exit(2)
+			}
+			m.resume(s)
+		}
+	} else if *resume != "" {
+		fmt.Println("Error: --resume needs --session-dir")
+		os.Exit(2)
+	}
 
 	// Create the program
-	p := tea.NewProgram(m, tea.WithAltScreen())
+	programOpts := []tea.ProgramOption{tea.WithAltScreen()}
+	if pipe.Piped(os.Stdin) {
+		// Keys come from the terminal when stdin was piped in.
+		programOpts = append(programOpts, tea.WithInputTTY())
+	}
+	p := tea.NewProgram(m, programOpts...)
 
 	// Run the program
-	if _, err := p.Run(); err != nil {
+	final, err := p.Run()
+	if final, ok := final.(Model); ok {
+		final.autosave()
+		final.closeShell()
+	}
+	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
 }
 
+// runVerify implements "ai-shell verify [-audit path]", which checks the
+// audit log's hash chain and exits non-zero if it was tampered with.
+func runVerify(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	path := fs.String("audit", audit.DefaultPath(), "Audit log to verify")
+	fs.Parse(args)
+
+	n, err := audit.Verify(*path)
+	if err != nil {
+		fmt.Printf("%s: verification failed after %d valid entries: %v\n", *path, n, err)
+		return 1
+	}
+	fmt.Printf("%s: %d entries, chain intact\n", *path, n)
+	return 0
+}
+
+// runSessions implements "ai-shell sessions [list | search QUERY | delete
+// ID... | export ID]", which manages the saved sessions.
+func runSessions(args []string) int {
+	fs := flag.NewFlagSet("sessions", flag.ExitOnError)
+	dir := fs.String("dir", sessions.DefaultDir(), "Directory the sessions are saved in")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: ai-shell sessions [-dir DIR] [list | search QUERY | delete ID... | export [-format FORMAT] [-o FILE] ID]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	store, err := sessions.Open(*dir)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	cmd, rest := "list", fs.Args()
+	if len(rest) > 0 {
+		cmd, rest = rest[0], rest[1:]
+	}
+	var list []*sessions.Session
+	switch {
+	case cmd == "list" && len(rest) == 0:
+		list, err = store.List()
+	case cmd == "search" && len(rest) > 0:
+		list, err = store.Search(strings.Join(rest, " "))
+	case cmd == "delete" && len(rest) > 0:
+		for _, id := range rest {
+			full, err := store.Delete(id)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return 1
+			}
+			fmt.Printf("deleted %s\n", full)
+		}
+		return 0
+	case cmd == "export":
+		return exportSession(store, rest)
+	default:
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	for _, s := range list {
+		fmt.Println(s.Summary())
+	}
+	if len(list) == 0 && cmd == "search" {
+		return 1
+	}
+	return 0
+}
+
 func makeClients() map[string]llm.Client {
 	clients := map[string]llm.Client{
 		"openai":  llm.NewOpenAI(*apiKey, *url, *model),
@@ -46,9 +344,85 @@ func makeClients() map[string]llm.Client {
 	return clients
 }
 
+// loadPolicy reads the policy file given by --policy, falling back to the
+// default location and then to confirming every command, and adds the
+// commands saved with "always allow".
+func loadPolicy(path string) (*policy.Policy, error) {
+	if path == "" {
+		if path = policy.DefaultPath(); path != "" {
+			if _, err := os.Stat(path); err != nil {
+				path = ""
+			}
+		}
+	}
+	p := policy.Default()
+	if path != "" {
+		var err error
+		if p, err = policy.Load(path); err != nil {
+			return nil, err
+		}
+	}
+	if allowed := policy.AllowedPath(); allowed != "" {
+		if err := p.LoadAllowed(allowed); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
 func defaultURL() string {
 	if *url == "" {
 		return "http://localhost:8080/chat"
 	}
 	return *url
 }
+
+// exportSession implements "ai-shell sessions export [-format FORMAT] [-o
+// FILE] ID", which writes a saved session as Markdown, JSON or, for its
+// Bash mode terminal, an asciicast.
+func exportSession(store *sessions.Store, args []string) int {
+	fs := flag.NewFlagSet("sessions export", flag.ExitOnError)
+	format := fs.String("format", "markdown", "Format: "+strings.Join(export.Formats, ", "))
+	out := fs.String("o", "", "File to write instead of stdout")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: ai-shell sessions export [-format FORMAT] [-o FILE] ID|last")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	var s *sessions.Session
+	var err error
+	if id := fs.Arg(0); id == "last" {
+		s, err = store.Latest()
+	} else {
+		s, err = store.Load(id)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	w := os.Stdout
+	if *out != "" {
+		if w, err = os.Create(*out); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+	}
+	err = export.Write(w, s, *format)
+	if *out != "" {
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(*out)
+		}
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
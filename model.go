@@ -3,33 +3,45 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	//"time"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/jrcrittenden/ai-shell/agent"
+	"github.com/jrcrittenden/ai-shell/internal/audit"
+	"github.com/jrcrittenden/ai-shell/internal/autopilot"
+	"github.com/jrcrittenden/ai-shell/internal/checkpoint"
+	"github.com/jrcrittenden/ai-shell/internal/egress"
 	executil "github.com/jrcrittenden/ai-shell/internal/exec"
+	"github.com/jrcrittenden/ai-shell/internal/explain"
+	"github.com/jrcrittenden/ai-shell/internal/injection"
+	"github.com/jrcrittenden/ai-shell/internal/output"
+	"github.com/jrcrittenden/ai-shell/internal/pipe"
+	"github.com/jrcrittenden/ai-shell/internal/placeholder"
+	"github.com/jrcrittenden/ai-shell/internal/plan"
+	"github.com/jrcrittenden/ai-shell/internal/policy"
+	"github.com/jrcrittenden/ai-shell/internal/preflight"
+	"github.com/jrcrittenden/ai-shell/internal/redact"
+	"github.com/jrcrittenden/ai-shell/internal/risk"
+	"github.com/jrcrittenden/ai-shell/internal/sessions"
 	"github.com/jrcrittenden/ai-shell/internal/tui"
 	"github.com/jrcrittenden/ai-shell/llm"
 	"github.com/rmhubbert/bubbletea-overlay"
 )
 
-// streamCmd represents a command that streams chunks from a channel
-type streamCmd struct {
-	chunks chan llm.Chunk
-}
-
-// streamChunks creates a command that reads from the chunks channel
-func streamChunks(chunks chan llm.Chunk) tea.Cmd {
+// waitEvent returns a command that delivers the session's next event.
+func waitEvent(s *agent.Session) tea.Cmd {
 	return func() tea.Msg {
-		chunk, ok := <-chunks
-		if !ok {
-			return nil
-		}
-		return chunk
+		return <-s.Events()
 	}
 }
 
@@ -56,33 +68,105 @@ type (
 		PlainText string
 		ToolCall  *llm.ToolCall
 	}
-	ExecOutputMsg string
-	ErrMsg        struct{ Err error }
+	// explainMsg carries the explanation of a command shown in the dialog.
+	explainMsg struct {
+		Command string
+		Text    string
+	}
+	// changesMsg carries what an executed command changed on disk.
+	changesMsg struct {
+		Checkpoint checkpoint.Checkpoint
+		Diff       checkpoint.Diff
+		Err        error
+	}
+	// checkpointMsg carries the checkpoint taken before an approved
+	// command, which starts once it arrives.
+	checkpointMsg struct {
+		Command    string
+		Options    executil.Options
+		Checkpoint checkpoint.Checkpoint
+		Err        error
+	}
+	// undoneMsg reports that the files were restored to a checkpoint.
+	undoneMsg struct {
+		Checkpoint checkpoint.Checkpoint
+		Diff       checkpoint.Diff
+		Err        error
+	}
+	// planMsg carries the steps the model proposed for a plan, or why it
+	// did not answer with any.
+	planMsg struct {
+		Steps []plan.Step
+		Text  string
+		Err   error
+	}
+	// shellMsg carries output of the Bash mode terminal, or the error that
+	// ended it. Rest is the start of a character cut off by the read.
+	shellMsg struct {
+		Shell *executil.Shell
+		Data  string
+		At    time.Time
+		Rest  []byte
+		Err   error
+	}
+	// autoTickMsg refreshes the step tracker and checks the run's time
+	// limit.
+	autoTickMsg time.Time
+	ErrMsg      struct{ Err error }
+)
+
+// interruptGrace is how long an interrupted command may take to exit after
+// SIGINT before it is killed.
+const interruptGrace = 3 * time.Second
+
+var (
+	okBadgeStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("#50fa7b"))
+	failBadgeStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#ff5555"))
 )
 
+// resultBadge renders the compact exit status shown after a command.
+func resultBadge(r executil.Result) string {
+	if r.Success() {
+		return okBadgeStyle.Render(r.Badge())
+	}
+	return failBadgeStyle.Render(r.Badge())
+}
+
 /* --------------------------------------------------------------------- */
 /*  Keymap                                                               */
 /* --------------------------------------------------------------------- */
 
 type keymap struct {
-	Toggle  key.Binding
-	Run     key.Binding
-	Quit    key.Binding
-	OpenAI  key.Binding
-	LocalOp key.Binding
-	Codex   key.Binding
-	Claude  key.Binding
+	Toggle   key.Binding
+	Run      key.Binding
+	Quit     key.Binding
+	OpenAI   key.Binding
+	LocalOp  key.Binding
+	Codex    key.Binding
+	Claude   key.Binding
+	Undo     key.Binding
+	Secrets  key.Binding
+	Auto     key.Binding
+	Pause    key.Binding
+	Plan     key.Binding
+	Sessions key.Binding
 }
 
 func defaultKeymap() keymap {
 	return keymap{
-		Toggle:  key.NewBinding(key.WithKeys("ctrl+t"), key.WithHelp("ctrl+t", "switch AI↔bash")),
-		Run:     key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "send/exec")),
-		Quit:    key.NewBinding(key.WithKeys("ctrl+c", "q"), key.WithHelp("q", "quit")),
-		OpenAI:  key.NewBinding(key.WithKeys("f1"), key.WithHelp("F1", "openai")),
-		LocalOp: key.NewBinding(key.WithKeys("f2"), key.WithHelp("F2", "localop")),
-		Codex:   key.NewBinding(key.WithKeys("f3"), key.WithHelp("F3", "codex")),
-		Claude:  key.NewBinding(key.WithKeys("f4"), key.WithHelp("F4", "claude")),
+		Toggle:   key.NewBinding(key.WithKeys("ctrl+t"), key.WithHelp("ctrl+t", "switch AI↔bash")),
+		Run:      key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "send/exec")),
+		Quit:     key.NewBinding(key.WithKeys("ctrl+c", "q"), key.WithHelp("q", "quit")),
+		OpenAI:   key.NewBinding(key.WithKeys("f1"), key.WithHelp("F1", "openai")),
+		LocalOp:  key.NewBinding(key.WithKeys("f2"), key.WithHelp("F2", "localop")),
+		Codex:    key.NewBinding(key.WithKeys("f3"), key.WithHelp("F3", "codex")),
+		Claude:   key.NewBinding(key.WithKeys("f4"), key.WithHelp("F4", "claude")),
+		Undo:     key.NewBinding(key.WithKeys("ctrl+z"), key.WithHelp("ctrl+z", "undo")),
+		Secrets:  key.NewBinding(key.WithKeys("f5"), key.WithHelp("F5", "redactions")),
+		Auto:     key.NewBinding(key.WithKeys("f6"), key.WithHelp("F6", "autonomous")),
+		Pause:    key.NewBinding(key.WithKeys("ctrl+p"), key.WithHelp("ctrl+p", "pause")),
+		Plan:     key.NewBinding(key.WithKeys("f7"), key.WithHelp("F7", "plan")),
+		Sessions: key.NewBinding(key.WithKeys("f8"), key.WithHelp("F8", "sessions")),
 	}
 }
 
@@ -92,26 +176,77 @@ func defaultKeymap() keymap {
 
 // Model represents the application state
 type Model struct {
-	clients            map[string]llm.Client
-	backend            string
-	client             llm.Client
-	input              textinput.Model
-	output             viewport.Model
-	history            []llm.Message
-	showDialog         bool
-	dialog             *tui.DialogModel
-	width              int
-	height             int
-	mode               Mode
-	keys               keymap
-	aiContent          string
-	bashOutput         string
-	chunkChan          chan llm.Chunk
-	overlay            *overlay.Model
-	baseModel          BaseModel
-	dialogModel        DialogModel
-	awaitingDenyReason bool
-	denyCommand        string
+	clients    map[string]llm.Client
+	backend    string
+	client     llm.Client
+	session    *agent.Session
+	input      textinput.Model
+	output     viewport.Model
+	showDialog bool
+	dialog     *tui.DialogModel
+	width      int
+	height     int
+	mode       Mode
+	keys       keymap
+	aiContent  string
+	bashOutput string
+	// proposal is the proposal the session waits for a decision on.
+	proposal  *agent.Proposal
+	sandbox   executil.Profile
+	limits    executil.Limits
+	policy    *policy.Policy
+	allowFile string
+	// preflightRetries counts proposals sent back for failing pre-flight
+	// checks since the user last spoke; after maxPreflightRetries the
+	// problems are shown in the dialog instead.
+	preflightRetries    int
+	maxPreflightRetries int
+	aliases             map[string]bool
+	audit               *audit.Log
+	modelName           string
+	// checkpoints snapshots the working directory before each command;
+	// undo holds the checkpoints of executed commands, newest last, and
+	// pending the one taken for the running command. snapshotting is set
+	// while the checkpoint of an approved command is being taken.
+	checkpoints  *checkpoint.Store
+	undo         []checkpoint.Checkpoint
+	pending      *checkpoint.Checkpoint
+	snapshotting bool
+	// suspect lists instruction-like content found in output sent to the
+	// model. The output stays in the history, so for the rest of the
+	// session suggestions need a stricter approval than the policy asks
+	// for.
+	suspect []string
+	// redactor replaces secrets in what the clients send; commands refer to
+	// them by placeholder until they run.
+	redactor *redact.Redactor
+	// auto starts an autonomous run with each prompt; run is the current
+	// or last run.
+	auto       bool
+	autoLimits autopilot.Limits
+	run        *autopilot.Run
+	// planMode asks for a plan with each prompt; plan is the current or
+	// last plan and checklist shows it for review.
+	planMode  bool
+	plan      *plan.Plan
+	checklist *tui.ChecklistModel
+	showPlan  bool
+	// piped is the context block of input piped on stdin, attached to the
+	// first prompt, and pipedFindings what looked like prompt injection in
+	// it.
+	piped         string
+	pipedFindings []injection.Finding
+	// saved is the session being recorded, autosaved to store; browser
+	// lists the stored sessions to switch to. agentOpts creates the agent
+	// session of a resumed one.
+	store        *sessions.Store
+	saved        *sessions.Session
+	browser      *tui.SessionsModel
+	showSessions bool
+	agentOpts    agent.Options
+	// shell is the terminal of Bash mode, started when the mode is first
+	// entered. Its output is recorded in saved for export.
+	shell *executil.Shell
 }
 
 // appendToOutput adds text to the current output and updates the viewport
@@ -134,22 +269,936 @@ func (m *Model) appendToOutput(text string) {
 	m.output.GotoBottom()
 }
 
-// startStream begins streaming from the LLM using the current history.
-func (m *Model) startStream() tea.Cmd {
-	m.chunkChan = make(chan llm.Chunk)
-	chunks := m.client.Stream(context.Background(), m.history)
-	go func() {
-		defer close(m.chunkChan)
-		for chunk := range chunks {
-			m.chunkChan <- chunk
+// attachInput keeps in, as block, for the first prompt.
+func (m *Model) attachInput(in pipe.Input, block string) {
+	m.piped = block
+	note := fmt.Sprintf("[%d lines piped on stdin will be attached to your first prompt]", in.Lines())
+	if in.Truncated {
+		note = fmt.Sprintf("[%d lines piped on stdin, truncated after %d bytes, will be attached to your first prompt]", in.Lines(), len(in.Text))
+	}
+	m.appendToOutput(note)
+	m.pipedFindings = injection.Scan(in.Text)
+}
+
+// say adds a prompt or an answer to the saved session, redacted.
+func (m *Model) say(event, text string) {
+	if m.saved == nil {
+		return
+	}
+	if m.redactor != nil {
+		text = m.redactor.Redact(text)
+	}
+	m.saved.Say(event, text)
+}
+
+// tell adds a message from the user to the history without sending it.
+func (m *Model) tell(content string) {
+	m.session.Append(llm.Message{Role: "user", Content: content})
+}
+
+// decide answers the proposal the session is waiting on.
+func (m *Model) decide(d agent.Decision) {
+	m.proposal = nil
+	m.session.Decide(d)
+}
+
+// record appends e to the audit log, if one is configured.
+func (m *Model) record(e audit.Entry) {
+	e.Backend = m.backend
+	e.Model = m.modelName
+	if m.saved != nil {
+		m.saved.Record(e)
+	}
+	if m.audit == nil {
+		return
+	}
+	if err := m.audit.Append(e); err != nil {
+		m.appendToOutput(fmt.Sprintf("[audit log error: %v]", err))
+	}
+}
+
+// approve records the user's approval of a command and runs it.
+func (m *Model) approve(msg tui.ApproveMsg, decision string) tea.Cmd {
+	if i := m.planStep(); i >= 0 {
+		m.plan.Steps[i].Command = msg.Command
+	}
+	m.record(audit.Entry{
+		Event:    audit.EventDecision,
+		Command:  msg.Command,
+		Original: msg.Original,
+		Decision: decision,
+		Details: map[string]string{
+			"sandbox": msg.Profile.Name,
+			"limits":  msg.Limits.String(),
+		},
+	})
+	return m.execute(msg.Command, msg.Profile, msg.Limits)
+}
+
+// alwaysAllow adds a rule allowing exactly command to the policy and saves
+// the command, so that it also runs without asking in later sessions. A
+// command allow rules do not apply to is only approved this once.
+func (m *Model) alwaysAllow(command string) {
+	if !policy.Allowable(policy.Input{Command: command, Risk: analyzeRisk(command)}) {
+		m.appendToOutput("[not always allowing this command: the policy asks about it whatever its rules say]")
+		return
+	}
+	m.policy.AllowCommand(command)
+	if m.allowFile == "" {
+		return
+	}
+	if err := policy.SaveAllowed(m.allowFile, command); err != nil {
+		m.appendToOutput(fmt.Sprintf("[could not save the allowed command: %v]", err))
+		return
+	}
+	m.appendToOutput(fmt.Sprintf("[always allowing this command; saved to %s]", m.allowFile))
+}
+
+// editCommand checks a command the user edited or filled in in the dialog
+// like a proposal. A command the policy denies is kept in the editor with
+// the reason shown; otherwise the dialog switches to it.
+func (m *Model) editCommand(msg tui.EditMsg) tea.Cmd {
+	masked := placeholder.Mask(msg.Command)
+	report := analyzeRisk(masked)
+	dir, _ := os.Getwd()
+	d := m.policy.Evaluate(policy.Input{Command: masked, Dir: dir, Risk: report})
+	if d.Action == policy.Deny {
+		reason := d.Message
+		if reason == "" {
+			reason = "the command is not allowed by policy"
+		}
+		m.dialog.EditError(fmt.Sprintf("Denied by policy %q: %s", d.Rule, reason))
+		return nil
+	}
+
+	m.record(audit.Entry{Event: audit.EventEdit, Command: msg.Command, Original: msg.Original})
+	e := m.analyzeEgress(masked)
+	confirm := ""
+	if m.raise(d.Action, e) == policy.Type {
+		confirm = confirmWord(msg.Command)
+	}
+	m.dialog.Egress = e
+	m.dialog.SetCommand(msg.Command, report, confirm)
+	if params := m.dialog.Placeholders(); len(params) > 0 {
+		m.dialog.Warnings = nil
+		return completePlaceholders(params, dir)
+	}
+	m.dialog.Warnings = m.preflight(msg.Command, dir)
+	return nil
+}
+
+// suspicious warns the user about prompt injection found in output sent to
+// the model and remembers it to tighten approval.
+func (m *Model) suspicious(source string, findings []injection.Finding) {
+	lines := make([]string, len(findings))
+	for i, f := range findings {
+		lines[i] = source + " " + f.String()
+	}
+	m.suspect = append(m.suspect, lines...)
+	m.appendToOutput(fmt.Sprintf("[possible prompt injection in %s; suggestions in this session need stricter approval]\n  %s",
+		source, strings.Join(lines, "\n  ")))
+}
+
+// raise returns the approval action to use for a command instead of the
+// policy's. While output that looks like a prompt injection is in the
+// conversation, allowed commands are shown in the dialog and confirmed ones
+// must be typed. Commands contacting hosts that are not on the allow-list
+// are never run without the dialog, and must be typed if they send local
+// data there.
+func (m *Model) raise(a policy.Action, e egress.Report) policy.Action {
+	if len(m.suspect) > 0 {
+		switch a {
+		case policy.Allow:
+			a = policy.Confirm
+		case policy.Confirm:
+			a = policy.Type
 		}
-	}()
-	return streamChunks(m.chunkChan)
+	}
+	if a == policy.Allow && len(e.Unlisted()) > 0 {
+		a = policy.Confirm
+	}
+	if a == policy.Confirm && e.Uploads() {
+		a = policy.Type
+	}
+	return a
+}
+
+// analyzeEgress finds where command sends data, checked against the
+// policy's allow-list.
+func (m *Model) analyzeEgress(command string) egress.Report {
+	return egress.Analyze(command, egress.Options{Allow: m.policy.AllowHosts})
+}
+
+// unredact puts the secrets the model saw as placeholders back into
+// command.
+func (m *Model) unredact(command string) string {
+	if m.redactor == nil {
+		return command
+	}
+	return m.redactor.Restore(command)
+}
+
+// showRedactions lists the secrets that were kept from the model.
+func (m *Model) showRedactions() {
+	if m.redactor == nil {
+		m.appendToOutput("[redaction is off; start ai-shell without --redact=false to enable it]")
+		return
+	}
+	list := m.redactor.Redactions()
+	if len(list) == 0 {
+		m.appendToOutput("[nothing redacted this session]")
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%d secrets redacted this session]", len(list))
+	for _, r := range list {
+		fmt.Fprintf(&b, "\n  %s  %s  %s", r.Placeholder, r.Kind, r.Hint)
+	}
+	m.appendToOutput(b.String())
+}
+
+// autoTick schedules the next refresh of the step tracker.
+func autoTick() tea.Cmd {
+	return tea.Tick(time.Second, func(t time.Time) tea.Msg { return autoTickMsg(t) })
+}
+
+// startRun begins an autonomous run towards goal and returns the message
+// that asks the model to work on it.
+func (m *Model) startRun(goal string) (string, tea.Cmd) {
+	m.run = autopilot.New(goal, m.autoLimits, time.Now())
+	m.appendToOutput(fmt.Sprintf("[autonomous run started: %s; %s pauses, %s stops]",
+		m.autoLimits, m.keys.Pause.Help().Key, m.keys.Auto.Help().Key))
+	return autopilot.Prompt(goal), autoTick()
+}
+
+// stopRun ends the autonomous run, if one is active, and says why.
+func (m *Model) stopRun(reason string) {
+	if !m.run.Active() {
+		return
+	}
+	m.run.Stop(reason)
+	m.appendToOutput(fmt.Sprintf("[autonomous run stopped: %s]", reason))
+}
+
+// checkRun stops the autonomous run once it reaches its time or token
+// limit.
+func (m *Model) checkRun() {
+	if m.run.Active() && !m.run.Check(time.Now()) {
+		m.appendToOutput(fmt.Sprintf("[autonomous run stopped: %s]", m.run.Stopped))
+	}
+}
+
+// autoExecute reports whether an autonomous run may execute a command the
+// policy allows, stopping the run when it has used up its steps. Risky
+// commands and commands proposed while the run is paused go to the dialog.
+func (m *Model) autoExecute(command string, level risk.Level) bool {
+	if !m.run.Active() {
+		return true
+	}
+	switch {
+	case !m.run.CanStep():
+		m.stopRun(fmt.Sprintf("step limit of %d reached", m.run.Limits.Steps))
+		return false
+	case m.run.Paused:
+		m.appendToOutput("[autonomous run paused; asking]")
+		return false
+	case level >= risk.High:
+		m.appendToOutput(fmt.Sprintf("[autonomous run: %s risk, asking]", level))
+		return false
+	}
+	return true
+}
+
+// requestPlan asks the model for the steps of a plan; the history must end
+// with the request.
+func (m *Model) requestPlan() tea.Cmd {
+	m.appendToOutput(fmt.Sprintf("[asking %s for a plan...]", m.backend))
+	client, history := m.client, m.session.History()
+	return func() tea.Msg {
+		steps, text, err := plan.Request(context.Background(), client, history)
+		return planMsg{Steps: steps, Text: text, Err: err}
+	}
+}
+
+// planStep returns the index of the plan step that is running, or -1 if
+// no plan is being carried out.
+func (m *Model) planStep() int {
+	if !m.plan.Active() {
+		return -1
+	}
+	return m.plan.Current()
+}
+
+// runStep runs the next step of the approved plan, or completes the plan
+// when none is left. Approving the plan approves its steps, but each one
+// is still checked against the policy when its turn comes: denied steps
+// and steps failing pre-flight checks fail, and steps the policy wants
+// typed or that have placeholders open the dialog.
+func (m *Model) runStep() tea.Cmd {
+	i := m.plan.Next()
+	if i < 0 {
+		m.plan.Stop("complete")
+		m.appendToOutput(fmt.Sprintf("[plan complete: %s steps done]", m.plan.Progress()))
+		return nil
+	}
+	st := &m.plan.Steps[i]
+	st.Status = plan.Running
+	masked := placeholder.Mask(st.Command)
+	report := analyzeRisk(masked)
+	dir, _ := os.Getwd()
+	d := m.policy.Evaluate(policy.Input{Command: masked, Dir: dir, Risk: report})
+	e := m.analyzeEgress(masked)
+	details := map[string]string{"risk": report.Level.String(), "policy": string(d.Action), "rule": d.Rule,
+		"plan step": fmt.Sprintf("%d/%d", i+1, len(m.plan.Steps))}
+	if e.Network() {
+		details["egress"] = egressSummary(e)
+	}
+	m.record(audit.Entry{Event: audit.EventProposal, Command: st.Command, Reason: st.Title, Details: details})
+	m.appendToOutput(fmt.Sprintf("[plan step %d/%d] %s", i+1, len(m.plan.Steps), st.Title))
+
+	if d.Action == policy.Deny {
+		reason := d.Message
+		if reason == "" {
+			reason = "the command is not allowed by policy"
+		}
+		m.record(audit.Entry{Event: audit.EventDecision, Command: st.Command, Decision: audit.PolicyDenied, DenyReason: reason})
+		return m.stepFailed(fmt.Sprintf("denied by policy %q: %s", d.Rule, reason))
+	}
+	params := placeholder.Names(st.Command)
+	if len(params) == 0 {
+		if problems := m.preflight(st.Command, dir); len(problems) > 0 {
+			m.record(audit.Entry{Event: audit.EventDecision, Command: st.Command, Decision: audit.PreflightFailed, DenyReason: strings.Join(problems, "; ")})
+			return m.stepFailed("it failed pre-flight checks on this machine: " + strings.Join(problems, "; "))
+		}
+	}
+	// Approving the plan approved its steps as read, not what they were
+	// found to do, so risky steps are still asked about one by one.
+	if action := m.raise(d.Action, e); action == policy.Type || len(params) > 0 || report.Level >= risk.High {
+		if report.Level >= risk.High {
+			m.appendToOutput(fmt.Sprintf("[plan step: %s risk, asking]", report.Level))
+		}
+		m.openDialog(st.Command, st.Title, report, nil, e, action)
+		return completePlaceholders(params, dir)
+	}
+	m.record(audit.Entry{Event: audit.EventDecision, Command: st.Command, Decision: audit.PlanApproved})
+	return m.execute(st.Command, m.sandbox, m.limits)
+}
+
+// stepDone records the result of the running plan step and moves on to the
+// next one. A failed step asks the model for a new plan; an interrupted one
+// stops the plan.
+func (m *Model) stepDone(r executil.Result) tea.Cmd {
+	i := m.plan.Current()
+	switch {
+	case r.Interrupted:
+		m.plan.Steps[i].Status = plan.Failed
+		m.plan.Steps[i].Result = "interrupted"
+		m.stopPlan("interrupted by the user")
+		return nil
+	case !r.Success():
+		reason := fmt.Sprintf("exit %d", r.ExitCode)
+		if r.Signal != "" {
+			reason = "killed by " + r.Signal
+		}
+		if r.LimitExceeded != "" {
+			reason += fmt.Sprintf(" (%s limit)", r.LimitExceeded)
+		}
+		return m.stepFailed(reason)
+	}
+	m.plan.Steps[i].Status = plan.Done
+	return m.runStep()
 }
 
-// NewModel initializes the TUI state with a map of LLM clients and the
-// backend that should be active when the program starts.
-func NewModel(clients map[string]llm.Client, backend string) Model {
+// stepFailed marks the running plan step as failed for reason and asks the
+// model for a new plan for the rest of the task.
+func (m *Model) stepFailed(reason string) tea.Cmd {
+	i := m.plan.Current()
+	m.plan.Steps[i].Status = plan.Failed
+	m.plan.Steps[i].Result = reason
+	m.appendToOutput(fmt.Sprintf("[plan step %d failed: %s; asking for a new plan]", i+1, reason))
+	m.tell(plan.ReplanPrompt(m.plan, i, reason))
+	return m.requestPlan()
+}
+
+// stopPlan ends the current plan, if one is active, and says why.
+func (m *Model) stopPlan(reason string) {
+	if !m.plan.Active() {
+		return
+	}
+	m.plan.Stop(reason)
+	m.appendToOutput(fmt.Sprintf("[plan stopped: %s]", reason))
+}
+
+// execute runs an approved command: the one the session is waiting on a
+// decision for, or else a step of the plan. With checkpoints it returns
+// the command taking the snapshot, and the command starts once that is
+// done. Its output and result arrive as session events.
+func (m *Model) execute(command string, profile executil.Profile, limits executil.Limits) tea.Cmd {
+	prompt := "$ "
+	if profile.Enabled() {
+		prompt = fmt.Sprintf("[%s] $ ", profile.Name)
+	}
+	m.appendToOutput(prompt + command)
+	if m.run.Active() {
+		m.run.Begin(command)
+	}
+	m.pending = nil
+	opts := executil.Options{Sandbox: profile, Limits: limits}
+	if m.checkpoints == nil {
+		m.start(command, opts)
+		return nil
+	}
+	// Snapshotting a large tree takes a while; the command starts when
+	// checkpointMsg arrives.
+	m.snapshotting = true
+	store := m.checkpoints
+	return func() tea.Msg {
+		cp, err := store.Create(context.Background(), command)
+		return checkpointMsg{Command: command, Options: opts, Checkpoint: cp, Err: err}
+	}
+}
+
+// start runs an approved command, as the answer to the model's proposal
+// if there is one.
+func (m *Model) start(command string, opts executil.Options) {
+	if m.proposal != nil {
+		m.decide(agent.Decision{Run: true, Command: command, Options: opts})
+		return
+	}
+	if err := m.session.Execute(context.Background(), command, opts); err != nil {
+		m.appendToOutput(fmt.Sprintf("[%v]", err))
+		m.stopPlan(err.Error())
+	}
+}
+
+// handleEvent shows what happened in the session and keeps the audit log,
+// the autonomous run and the plan in step with it.
+func (m *Model) handleEvent(e agent.Event) tea.Cmd {
+	switch e := e.(type) {
+	case agent.RequestEvent:
+		if m.run.Active() {
+			for _, msg := range e.Messages {
+				m.run.AddTokens(msg.Content)
+			}
+			m.checkRun()
+		}
+
+	case agent.TextEvent:
+		m.appendToOutput(e.Text)
+		if m.run.Active() {
+			m.run.AddTokens(e.Text)
+			m.checkRun()
+		}
+
+	case agent.ReplyEvent:
+		if summary, ok := autopilot.Completed(e.Text); ok && m.run.Active() {
+			m.stopRun("task complete: " + summary)
+		}
+		if strings.TrimSpace(e.Text) != "" {
+			m.say(sessions.EventAnswer, e.Text)
+		}
+		m.autosave()
+
+	case agent.DecisionNeededEvent:
+		return m.propose(e.Proposal)
+
+	case agent.OutputEvent:
+		m.appendToOutput(e.Output.Line)
+
+	case agent.SuspiciousEvent:
+		m.suspicious(e.Source, e.Findings)
+
+	case agent.RangeEvent:
+		m.appendToOutput(fmt.Sprintf("[%s]", e.Request))
+
+	case agent.ResultEvent:
+		if e.Err != nil {
+			m.pending = nil
+			m.appendToOutput(e.Err.Error())
+			if m.planStep() >= 0 {
+				return m.stepFailed(fmt.Sprintf("it failed to start: %v", e.Err))
+			}
+			return nil
+		}
+		var cmds []tea.Cmd
+		logged := e.Result
+		if m.redactor != nil {
+			logged.Command = m.redactor.Redact(logged.Command)
+			logged.Stdout = m.redactor.Redact(logged.Stdout)
+			logged.Stderr = m.redactor.Redact(logged.Stderr)
+		}
+		m.record(audit.Entry{Event: audit.EventExecution, Command: logged.Command, Details: json.RawMessage(logged.JSON())})
+		m.appendToOutput(resultBadge(e.Result))
+		for _, w := range e.Result.Warnings {
+			m.appendToOutput(fmt.Sprintf("[warning: %s]", w))
+		}
+		if m.run.Active() {
+			m.run.End(e.Result.ExitCode)
+			if !e.Result.Success() {
+				m.stopRun(fmt.Sprintf("`%s` failed (%s)", e.Result.Command, e.Result.Badge()))
+			}
+		}
+		if m.pending != nil {
+			m.undo = append(m.undo, *m.pending)
+			cmds = append(cmds, fileChanges(m.checkpoints, *m.pending))
+			m.pending = nil
+		}
+		if m.planStep() >= 0 {
+			cmds = append(cmds, m.stepDone(e.Result))
+		}
+		m.autosave()
+		return tea.Batch(cmds...)
+
+	case agent.DoneEvent:
+		if e.Err != nil {
+			m.appendToOutput(fmt.Sprintf("[%v]", e.Err))
+			m.stopRun(e.Err.Error())
+		}
+		// A turn also ends when the model stops proposing commands.
+		m.stopRun("the model answered without proposing a command")
+		m.autosave()
+	}
+	return nil
+}
+
+// autosave writes the current session to the store, once something was
+// said in it. Secrets are redacted before they reach the disk.
+func (m *Model) autosave() {
+	if m.store == nil || m.saved == nil {
+		return
+	}
+	redact := func(s string) string { return s }
+	if m.redactor != nil {
+		redact = m.redactor.Redact
+	}
+	m.saved.Messages = m.session.History()
+	if m.saved.Empty() {
+		return
+	}
+	for i := range m.saved.Messages {
+		m.saved.Messages[i].Content = redact(m.saved.Messages[i].Content)
+	}
+	if m.saved.Title != "" {
+		m.saved.Title = redact(m.saved.Title)
+	}
+	m.saved.Backend, m.saved.Model = m.backend, m.modelName
+	m.saved.Transcript, m.saved.BashOutput = redact(m.aiContent), redact(m.bashOutput)
+	m.saved.Suspect = nil
+	for _, s := range m.suspect {
+		m.saved.Suspect = append(m.saved.Suspect, redact(s))
+	}
+	if err := m.store.Save(m.saved); err != nil {
+		m.appendToOutput(fmt.Sprintf("[could not save the session: %v]", err))
+	}
+}
+
+// openSessions shows the session browser.
+func (m *Model) openSessions() {
+	if m.store == nil {
+		m.appendToOutput("[sessions are not saved; start ai-shell with --session-dir]")
+		return
+	}
+	if m.session.Busy() {
+		m.appendToOutput("[cannot switch sessions while the model or a command is working]")
+		return
+	}
+	m.autosave()
+	list, err := m.store.List()
+	if err != nil {
+		m.appendToOutput(fmt.Sprintf("[could not list the sessions: %v]", err))
+		return
+	}
+	m.browser = tui.NewSessions(list, m.saved.ID)
+	m.browser.SetSize(m.width, m.height)
+	m.showSessions = true
+}
+
+// resume continues the saved session s: its history goes to a new agent
+// session, its transcripts to the panes and its backend becomes active.
+// It returns the command waiting for the new session's events.
+func (m *Model) resume(s *sessions.Session) tea.Cmd {
+	m.stopRun("switched to another session")
+	m.stopPlan("switched to another session")
+	if c, ok := m.clients[s.Backend]; ok {
+		m.backend, m.client = s.Backend, c
+	}
+	m.saved = s
+	m.session = agent.New(m.client, m.agentOpts)
+	m.session.Append(s.Messages...)
+	m.proposal, m.suspect, m.preflightRetries = nil, append([]string(nil), s.Suspect...), 0
+	m.undo, m.pending, m.snapshotting = nil, nil, false
+	m.aiContent, m.bashOutput = s.Transcript, s.BashOutput
+	m.output.SetContent(m.aiContent)
+	if m.mode == ModeBash {
+		m.output.SetContent(m.bashOutput)
+	}
+	if m.shell != nil {
+		m.startRecording()
+	}
+	m.appendToOutput(fmt.Sprintf("[resumed session %s from %s with %s]", s.ID, s.Updated.Format("2006-01-02 15:04"), m.backend))
+	if dir, _ := os.Getwd(); s.Dir != "" && s.Dir != dir {
+		m.appendToOutput(fmt.Sprintf("[the session was in %s; commands now run in %s]", s.Dir, dir))
+	}
+	return waitEvent(m.session)
+}
+
+// toggleMode switches between AI and Bash mode, starting the terminal the
+// first time Bash mode is entered.
+func (m *Model) toggleMode() tea.Cmd {
+	if m.mode == ModeBash {
+		m.mode = ModeAI
+		m.input.Reset()
+		m.output.SetContent(m.aiContent)
+		m.output.GotoBottom()
+		m.autosave()
+		return nil
+	}
+	m.mode = ModeBash
+	m.input.Reset()
+	m.output.SetContent(m.bashOutput)
+	m.output.GotoBottom()
+	if m.shell != nil {
+		return nil
+	}
+	sh, err := executil.NewShell(context.Background(), os.Getenv("SHELL"))
+	if err != nil {
+		m.appendToOutput(fmt.Sprintf("[could not start a shell: %v]", err))
+		return nil
+	}
+	m.shell = sh
+	m.shell.Resize(m.shellSize())
+	m.startRecording()
+	return readShell(sh, nil)
+}
+
+// shellSize returns the size of the terminal: that of the output pane, or
+// 80x24 before the window size is known.
+func (m *Model) shellSize() (width, height int) {
+	if m.output.Width <= 0 || m.output.Height <= 0 {
+		return 80, 24
+	}
+	return m.output.Width, m.output.Height
+}
+
+// startRecording records the terminal's output into the saved session,
+// after what an earlier run of the session recorded.
+func (m *Model) startRecording() {
+	if m.saved == nil {
+		return
+	}
+	if m.saved.Recording == nil {
+		width, height := m.shellSize()
+		m.saved.Recording = &sessions.Recording{Start: time.Now(), Width: width, Height: height}
+		return
+	}
+	m.saved.Recording.Continue(time.Now())
+}
+
+// closeShell ends the Bash mode terminal, if it runs.
+func (m *Model) closeShell() {
+	if m.shell != nil {
+		m.shell.Close()
+		m.shell = nil
+	}
+}
+
+// readShell returns a command that delivers the shell's next output. rest
+// is the start of a character the last read cut off.
+func readShell(sh *executil.Shell, rest []byte) tea.Cmd {
+	return func() tea.Msg {
+		buf := make([]byte, 4096)
+		n, err := sh.Read(buf)
+		data := append(rest, buf[:n]...)
+		if err != nil {
+			return shellMsg{Shell: sh, Data: string(data), At: time.Now(), Err: err}
+		}
+		// Keep an incomplete character for the next read so that the
+		// recording stays valid UTF-8.
+		cut := len(data)
+		for i := len(data) - 1; i >= max(len(data)-utf8.UTFMax, 0); i-- {
+			if utf8.RuneStart(data[i]) {
+				if !utf8.FullRune(data[i:]) {
+					cut = i
+				}
+				break
+			}
+		}
+		return shellMsg{Shell: sh, Data: string(data[:cut]), At: time.Now(), Rest: data[cut:]}
+	}
+}
+
+// terminalEscapes matches the control sequences a shell writes to its
+// terminal: CSI, OSC and two-character escapes.
+var terminalEscapes = regexp.MustCompile("\x1b\\[[0-?]*[ -/]*[@-~]|\x1b\\][^\a\x1b]*(\a|\x1b\\\\)|\x1b[()][0-9A-Za-z]|\x1b[@-Z\\\\-_=>]")
+
+// appendTerminal adds what the shell printed in data to the text of the
+// Bash pane, without control sequences and applying backspaces.
+func appendTerminal(text, data string) string {
+	data = terminalEscapes.ReplaceAllString(data, "")
+	b := []rune(text)
+	for _, r := range data {
+		switch r {
+		case '\b':
+			if n := len(b); n > 0 && b[n-1] != '\n' {
+				b = b[:n-1]
+			}
+		case '\r', '\a':
+		default:
+			b = append(b, r)
+		}
+	}
+	return string(b)
+}
+
+// shellOutput records and shows output of the terminal received at.
+func (m *Model) shellOutput(data string, at time.Time) {
+	if m.saved != nil && m.saved.Recording != nil {
+		recorded := data
+		if m.redactor != nil {
+			recorded = m.redactor.Redact(data)
+		}
+		m.saved.Recording.Add(at, recorded)
+	}
+	m.bashOutput = appendTerminal(m.bashOutput, data)
+	if m.mode == ModeBash {
+		m.output.SetContent(m.bashOutput)
+		m.output.GotoBottom()
+	}
+}
+
+// diffBudget bounds the diff shown after a command or an undo.
+var diffBudget = output.Budget{MaxLines: 40, MaxBytes: 4 << 10}
+
+// showChanges renders what a command or an undo changed: the changed files
+// with their status letter, then the diff clipped to diffBudget.
+func showChanges(d checkpoint.Diff) string {
+	var b strings.Builder
+	for _, c := range d.Changes {
+		fmt.Fprintf(&b, "  %s %s\n", c.Status, c.Path)
+	}
+	if d.Patch != "" {
+		b.WriteString(diffBudget.Clip(strings.TrimRight(d.Patch, "\n"), func(from, to int) string {
+			return fmt.Sprintf("... %d lines of diff not shown ...", to-from+1)
+		}))
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// fileChanges returns a command that works out what changed since cp.
+func fileChanges(store *checkpoint.Store, cp checkpoint.Checkpoint) tea.Cmd {
+	return func() tea.Msg {
+		d, err := store.Changes(context.Background(), cp)
+		return changesMsg{Checkpoint: cp, Diff: d, Err: err}
+	}
+}
+
+// undoLast restores the files to the checkpoint taken before the most
+// recently executed command.
+func (m *Model) undoLast() tea.Cmd {
+	if m.checkpoints == nil {
+		m.appendToOutput("[undo needs checkpoints; start ai-shell with --checkpoints]")
+		return nil
+	}
+	if m.session.Running() || m.snapshotting {
+		m.appendToOutput("[cannot undo while a command is running]")
+		return nil
+	}
+	if len(m.undo) == 0 {
+		m.appendToOutput("[nothing to undo]")
+		return nil
+	}
+	cp := m.undo[len(m.undo)-1]
+	m.undo = m.undo[:len(m.undo)-1]
+	store := m.checkpoints
+	return func() tea.Msg {
+		d, err := store.Restore(context.Background(), cp)
+		return undoneMsg{Checkpoint: cp, Diff: d, Err: err}
+	}
+}
+
+// propose decides on a command suggested by the model, which the session
+// waits for. Commands the policy allows run immediately, denied ones and
+// ones failing pre-flight checks are reported back to the model and
+// everything else opens the approval dialog.
+func (m *Model) propose(call agent.Proposal) tea.Cmd {
+	m.proposal = &call
+	// Placeholders are masked so that the command can be analyzed.
+	masked := placeholder.Mask(call.Command)
+	report := analyzeRisk(masked)
+	dir, _ := os.Getwd()
+	d := m.policy.Evaluate(policy.Input{Command: masked, Dir: dir, Risk: report})
+	e := m.analyzeEgress(masked)
+	details := map[string]string{"risk": report.Level.String(), "policy": string(d.Action), "rule": d.Rule}
+	if len(m.suspect) > 0 {
+		details["injection"] = strings.Join(m.suspect, "; ")
+	}
+	if e.Network() {
+		details["egress"] = egressSummary(e)
+	}
+	m.record(audit.Entry{
+		Event:   audit.EventProposal,
+		Command: call.Command,
+		Reason:  call.Reason,
+		Details: details,
+	})
+	action := m.raise(d.Action, e)
+
+	switch d.Action {
+	case policy.Deny:
+		reason := d.Message
+		if reason == "" {
+			reason = "the command is not allowed by policy"
+		}
+		m.record(audit.Entry{Event: audit.EventDecision, Command: call.Command, Decision: audit.PolicyDenied, DenyReason: reason})
+		m.appendToOutput(fmt.Sprintf("[DENIED by policy %q] %s\nReason: %s", d.Rule, call.Command, reason))
+		m.decide(agent.Decision{Feedback: fmt.Sprintf("Command `%s` was denied by policy: %s", call.Command, reason)})
+		return nil
+	}
+
+	// Commands with <placeholders> are checked once they are filled in.
+	params := placeholder.Names(call.Command)
+	var problems []string
+	if len(params) == 0 {
+		problems = m.preflight(call.Command, dir)
+	}
+	if len(problems) > 0 && m.preflightRetries < m.maxPreflightRetries {
+		m.preflightRetries++
+		m.record(audit.Entry{Event: audit.EventDecision, Command: call.Command, Decision: audit.PreflightFailed, DenyReason: strings.Join(problems, "; ")})
+		m.appendToOutput(fmt.Sprintf("[pre-flight check failed, asking for a correction (%d/%d)] %s\n  %s",
+			m.preflightRetries, m.maxPreflightRetries, call.Command, strings.Join(problems, "\n  ")))
+		m.decide(agent.Decision{Feedback: fmt.Sprintf(
+			"Command `%s` was not run because it failed pre-flight checks on this machine:\n- %s\nPropose a corrected command.",
+			call.Command, strings.Join(problems, "\n- "))})
+		return nil
+	}
+	m.preflightRetries = 0
+
+	switch {
+	case action == policy.Allow && len(params) == 0 && m.autoExecute(call.Command, report.Level):
+		m.record(audit.Entry{Event: audit.EventDecision, Command: call.Command, Decision: audit.AutoApproved})
+		m.appendToOutput(fmt.Sprintf("[auto-approved by policy %q]", d.Rule))
+		return m.execute(call.Command, m.sandbox, m.limits)
+	}
+
+	m.openDialog(call.Command, call.Reason, report, problems, e, action)
+	return completePlaceholders(params, dir)
+}
+
+// openDialog asks the user to approve command.
+func (m *Model) openDialog(command, reason string, report risk.Report, problems []string, e egress.Report, action policy.Action) {
+	m.dialog = tui.NewDialog(command, reason)
+	m.dialog.Profile = m.sandbox
+	m.dialog.Limits = m.limits
+	m.dialog.Risk = report
+	m.dialog.Warnings = problems
+	m.dialog.Injection = m.suspect
+	m.dialog.Egress = e
+	m.dialog.SetSize(m.width, m.height)
+	m.dialog.KeyMap().EnableExplain(true)
+	if action == policy.Type {
+		m.dialog.Confirm = confirmWord(command)
+	}
+	m.showDialog = true
+}
+
+// egressSummary describes destinations and payloads on one line for the
+// audit log.
+func egressSummary(e egress.Report) string {
+	var parts []string
+	for _, d := range e.Destinations {
+		s := "to " + d.String()
+		if !d.Allowed {
+			s += " unlisted"
+		}
+		parts = append(parts, s)
+	}
+	for _, p := range e.Payloads {
+		parts = append(parts, "sends "+p.String())
+	}
+	return strings.Join(parts, "; ")
+}
+
+// completePlaceholders looks up completions for each placeholder and hands
+// them to the dialog.
+func completePlaceholders(names []string, dir string) tea.Cmd {
+	var cmds []tea.Cmd
+	for _, name := range names {
+		cmds = append(cmds, func() tea.Msg {
+			return tui.SuggestionsMsg{Name: name, Values: placeholder.Complete(context.Background(), name, dir)}
+		})
+	}
+	return tea.Batch(cmds...)
+}
+
+// preflight checks that command can run in dir and describes each problem.
+func (m *Model) preflight(command, dir string) []string {
+	home, _ := os.UserHomeDir()
+	var problems []string
+	if m.redactor != nil {
+		// Secrets are not saved with a session, so the placeholders in a
+		// resumed history stand for nothing in this run.
+		for _, name := range m.redactor.Unknown(command) {
+			problems = append(problems, fmt.Sprintf("%s is not a secret known in this run; placeholders from a resumed session cannot be restored", name))
+		}
+	}
+	for _, p := range preflight.Check(context.Background(), m.unredact(command), preflight.Options{Dir: dir, Home: home, Aliases: m.aliases}) {
+		problems = append(problems, p.String())
+	}
+	return problems
+}
+
+// explainCommand asks client to explain command outside the conversation,
+// so neither the request nor the answer is added to the history.
+func explainCommand(client llm.Client, command string) tea.Cmd {
+	return func() tea.Msg {
+		e, err := explain.Explain(context.Background(), client, command)
+		if err != nil {
+			return explainMsg{Command: command, Text: "Could not explain the command: " + err.Error()}
+		}
+		return explainMsg{Command: command, Text: e.String()}
+	}
+}
+
+// confirmWord is what the user must type to approve command under a
+// "type" rule: the name of the program with the riskiest finding, or of
+// the first program if nothing was found.
+func confirmWord(command string) string {
+	cmds, err := risk.Commands(command)
+	if err != nil || len(cmds) == 0 {
+		return command
+	}
+	// The riskiest finding belongs to the last command starting at or
+	// before it; redirections lie outside their command's span.
+	var worst *risk.Finding
+	report := analyzeRisk(command)
+	for i, f := range report.Findings {
+		if worst == nil || f.Level > worst.Level {
+			worst = &report.Findings[i]
+		}
+	}
+	name := cmds[0].Name
+	if worst != nil {
+		for _, c := range cmds {
+			if c.Span.Start <= worst.Span.Start {
+				name = c.Name
+			}
+		}
+	}
+	return name
+}
+
+// analyzeRisk classifies command relative to the working directory.
+func analyzeRisk(command string) risk.Report {
+	dir, _ := os.Getwd()
+	home, _ := os.UserHomeDir()
+	return risk.Analyze(command, risk.Options{Dir: dir, Home: home})
+}
+
+// NewModel initializes the TUI state with a map of LLM clients, the
+// backend that should be active when the program starts and the options of
+// the agent session. Decisions on proposals are made by the TUI, so
+// opts.Approver is ignored.
+func NewModel(clients map[string]llm.Client, backend string, opts agent.Options) Model {
 	// Create input
 	in := textinput.New()
 	in.Placeholder = "Type a message..."
@@ -165,34 +1214,34 @@ func NewModel(clients map[string]llm.Client, backend string) Model {
 		BorderForeground(lipgloss.Color("#87ceeb")).
 		Padding(0, 1)
 
+	opts.Approver = nil
+
 	// Create base model
 	m := Model{
-		clients:            clients,
-		backend:            backend,
-		client:             clients[backend],
-		input:              in,
-		output:             vp,
-		history:            []llm.Message{},
-		showDialog:         false,
-		dialog:             nil,
-		width:              80,
-		height:             20,
-		mode:               ModeAI,
-		keys:               defaultKeymap(),
-		chunkChan:          make(chan llm.Chunk),
-		awaitingDenyReason: false,
-		denyCommand:        "",
-	}
-
-	// Initialize overlay with empty dialog
-	m.overlay = overlay.New(nil, &m, overlay.Center, overlay.Center, 0, 0)
+		clients:             clients,
+		backend:             backend,
+		client:              clients[backend],
+		session:             agent.New(clients[backend], opts),
+		agentOpts:           opts,
+		input:               in,
+		output:              vp,
+		showDialog:          false,
+		dialog:              nil,
+		width:               80,
+		height:              20,
+		mode:                ModeAI,
+		keys:                defaultKeymap(),
+		policy:              policy.Default(),
+		maxPreflightRetries: 3,
+		autoLimits:          autopilot.DefaultLimits(),
+	}
 
 	return m
 }
 
 // Init initializes the model
 func (m Model) Init() tea.Cmd {
-	return textinput.Blink
+	return tea.Batch(textinput.Blink, waitEvent(m.session))
 }
 
 // Update handles messages and updates the model accordingly
@@ -200,141 +1249,359 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmds []tea.Cmd
 
 	switch msg := msg.(type) {
+	case tui.ApproveMsg:
+		m.showDialog = false
+		return m, m.approve(msg, audit.Approved)
+
+	case tui.AlwaysAllowMsg:
+		m.showDialog = false
+		m.alwaysAllow(msg.Command)
+		return m, m.approve(tui.ApproveMsg(msg), audit.AlwaysAllowed)
+
+	case tui.DenyMsg:
+		m.showDialog = false
+		m.record(audit.Entry{Event: audit.EventDecision, Command: msg.Command, Decision: audit.Denied, DenyReason: msg.Reason})
+		m.appendToOutput(fmt.Sprintf("[DENIED] %s\nReason: %s", msg.Command, msg.Reason))
+		if m.planStep() >= 0 {
+			return m, m.stepFailed("denied by the user: " + msg.Reason)
+		}
+		m.decide(agent.Decision{Reason: msg.Reason})
+		return m, nil
+
+	case tui.ExplainMsg:
+		m.dialog.Explanation = "Asking " + m.backend + " to explain the command..."
+		return m, explainCommand(m.client, msg.Command)
+
+	case explainMsg:
+		if m.showDialog && m.dialog.Command == msg.Command {
+			m.dialog.Explanation = msg.Text
+		}
+		return m, nil
+
+	case tui.EditMsg:
+		return m, m.editCommand(msg)
+
+	case planMsg:
+		if msg.Text != "" {
+			m.session.Append(llm.Message{Role: "assistant", Content: msg.Text})
+		}
+		if !m.plan.Active() {
+			return m, nil
+		}
+		if msg.Err != nil {
+			if msg.Text != "" {
+				m.appendToOutput(msg.Text)
+			}
+			m.stopPlan(fmt.Sprintf("no plan: %v", msg.Err))
+			return m, nil
+		}
+		m.autosave()
+		m.plan.Replace(msg.Steps)
+		m.checklist = tui.NewChecklist(m.plan.Goal, m.plan.Steps, analyzeRisk)
+		m.checklist.SetSize(m.width, m.height)
+		m.showPlan = true
+		return m, nil
+
+	case tui.PlanApprovedMsg:
+		m.showPlan = false
+		m.plan.Steps = msg.Steps
+		m.tell(plan.Approved(m.plan))
+		return m, m.runStep()
+
+	case tui.PlanCanceledMsg:
+		m.showPlan = false
+		m.stopPlan("discarded by the user")
+		m.tell("I discarded the plan; none of its remaining steps will run.")
+		return m, nil
+
+	case tui.SessionOpenMsg:
+		m.showSessions = false
+		if msg.ID == m.saved.ID {
+			return m, nil
+		}
+		s, err := m.store.Load(msg.ID)
+		if err != nil {
+			m.appendToOutput(fmt.Sprintf("[could not open the session: %v]", err))
+			return m, nil
+		}
+		m.autosave()
+		return m, m.resume(s)
+
+	case tui.SessionDeleteMsg:
+		if _, err := m.store.Delete(msg.ID); err != nil {
+			m.appendToOutput(fmt.Sprintf("[could not delete the session: %v]", err))
+		}
+		return m, nil
+
+	case tui.SessionsClosedMsg:
+		m.showSessions = false
+		return m, nil
+
+	case shellMsg:
+		if msg.Shell != m.shell {
+			return m, nil
+		}
+		if msg.Data != "" {
+			m.shellOutput(msg.Data, msg.At)
+		}
+		if msg.Err != nil {
+			m.closeShell()
+			if m.bashOutput != "" && !strings.HasSuffix(m.bashOutput, "\n") {
+				m.bashOutput += "\n"
+			}
+			m.bashOutput += "[the shell exited; ctrl+t twice starts a new one]"
+			if m.mode == ModeBash {
+				m.output.SetContent(m.bashOutput)
+				m.output.GotoBottom()
+			}
+			m.autosave()
+			return m, nil
+		}
+		return m, readShell(m.shell, msg.Rest)
+
 	case tea.KeyMsg:
-		if m.showDialog {
-			switch msg.String() {
-			case "left", "right":
-				dialogModel := m.dialogModel
-				updated, cmd := dialogModel.Update(msg)
-				m.dialogModel = updated.(DialogModel)
-				cmds = append(cmds, cmd)
-				return m, tea.Batch(cmds...)
-			case "enter":
-				dialogModel := m.dialogModel
-				updated, cmd := dialogModel.Update(msg)
-				m.dialogModel = updated.(DialogModel)
-				cmds = append(cmds, cmd)
-
-				if m.dialogModel.selected == 1 {
-					// Approve
-					m.showDialog = false
-					cmdStr := m.dialog.Command
-					m.appendToOutput("$ " + cmdStr)
-					out, err := executil.RunCommand(context.Background(), cmdStr)
-					if out != "" {
-						m.appendToOutput(out)
-					}
-					if err != nil {
-						m.appendToOutput(err.Error())
-					}
-					m.history = append(m.history, llm.Message{Role: "user", Content: fmt.Sprintf("Command `%s` output:\n%s", cmdStr, out)})
-					cmds = append(cmds, m.startStream())
-				} else if m.dialogModel.selected == 2 {
-					// Deny
-					m.showDialog = false
-					m.awaitingDenyReason = true
-					m.denyCommand = m.dialog.Command
-					m.input.Placeholder = "Reason for denial..."
-					m.input.Focus()
-				}
-				return m, tea.Batch(cmds...)
+		if msg.String() == "ctrl+c" && m.mode == ModeBash && m.shell != nil {
+			// Interrupt the shell's command rather than ai-shell.
+			m.shell.Write([]byte{0x03})
+			return m, nil
+		}
+		if msg.String() == "ctrl+c" {
+			if m.session.Interrupt() {
+				m.appendToOutput("^C")
+				return m, nil
 			}
+			return m, tea.Quit
+		}
+		if m.showDialog {
+			dialog, cmd := m.dialog.Update(msg)
+			*m.dialog = dialog
+			return m, cmd
+		}
+		if m.showPlan {
+			checklist, cmd := m.checklist.Update(msg)
+			*m.checklist = checklist
+			return m, cmd
+		}
+		if m.showSessions {
+			browser, cmd := m.browser.Update(msg)
+			*m.browser = browser
+			return m, cmd
 		}
 
-		// Handle other keys only if not in dialog
 		switch msg.String() {
-		case "ctrl+c", "q":
+		case "q":
 			return m, tea.Quit
-		case "enter":
-			if m.awaitingDenyReason {
-				reason := m.input.Value()
-				m.appendToOutput(fmt.Sprintf("[DENIED] %s\nReason: %s", m.denyCommand, reason))
-				m.history = append(m.history, llm.Message{Role: "user", Content: fmt.Sprintf("Denied command `%s`: %s", m.denyCommand, reason)})
-				m.input.Reset()
-				m.input.Placeholder = "Type a message..."
-				m.awaitingDenyReason = false
-				m.denyCommand = ""
-				cmds = append(cmds, m.startStream())
-				return m, tea.Batch(cmds...)
+		case "ctrl+z":
+			return m, m.undoLast()
+		case "f5":
+			m.showRedactions()
+		case "f6":
+			m.auto = !m.auto
+			if m.auto {
+				if m.planMode {
+					m.planMode = false
+					m.stopPlan("autonomous mode was turned on")
+				}
+				m.appendToOutput(fmt.Sprintf("[autonomous mode on: the next prompt starts a run (%s)]", m.autoLimits))
+			} else {
+				m.appendToOutput("[autonomous mode off]")
+				m.stopRun("stopped by the user")
+			}
+		case "f7":
+			m.planMode = !m.planMode
+			if m.planMode {
+				if m.auto {
+					m.auto = false
+					m.stopRun("plan mode was turned on")
+				}
+				m.appendToOutput("[plan mode on: the next prompt asks for a plan to review before anything runs]")
+			} else {
+				m.appendToOutput("[plan mode off]")
+				m.stopPlan("stopped by the user")
 			}
+		case "f8":
+			m.openSessions()
+		case "ctrl+t":
+			return m, m.toggleMode()
+		case "ctrl+p":
+			if m.run.Active() {
+				m.run.Paused = !m.run.Paused
+				if m.run.Paused {
+					m.appendToOutput("[autonomous run paused; every command now needs approval]")
+				} else {
+					m.appendToOutput("[autonomous run resumed]")
+				}
+			}
+		case "enter":
 			if m.mode == ModeAI {
 				// Get the current input value
 				input := m.input.Value()
 				if input == "" {
 					return m, nil
 				}
+				if m.session.Busy() {
+					m.appendToOutput("[still working on the last request; press ctrl+c to interrupt a running command]")
+					return m, nil
+				}
 
-				// Add user message to history
-				m.history = append(m.history, llm.Message{
-					Role:    "user",
-					Content: input,
-				})
+				// A new request gets a fresh set of pre-flight retries.
+				m.preflightRetries = 0
 
 				// Add user input to output
 				m.appendToOutput("> " + input)
+				if m.saved != nil && m.saved.Title == "" {
+					m.saved.Title = input
+				}
+				m.say(sessions.EventPrompt, input)
+
+				m.stopPlan("the user sent a new prompt")
+				content := input
+				if m.auto {
+					var tick tea.Cmd
+					content, tick = m.startRun(input)
+					cmds = append(cmds, tick)
+				} else {
+					m.stopRun("the user sent a new prompt")
+				}
+				if m.planMode {
+					m.plan = plan.New(input)
+					content = plan.Prompt(input)
+				}
+
+				if m.piped != "" && len(m.pipedFindings) > 0 {
+					m.suspicious("stdin", m.pipedFindings)
+				}
+				content = pipe.Attach(m.piped, content)
+				m.piped = ""
 
 				// Clear the input
 				m.input.Reset()
 
-				cmds = append(cmds, m.startStream())
+				if m.planMode {
+					m.tell(content)
+					cmds = append(cmds, m.requestPlan())
+				} else if err := m.session.Send(context.Background(), content); err != nil {
+					m.appendToOutput(fmt.Sprintf("[%v]", err))
+				}
 			} else {
-				// Bash mode - execute command
-				// TODO: Implement command execution
-				m.appendToOutput("$ " + m.input.Value())
+				// Bash mode: the line goes to the terminal, which echoes it.
+				if m.shell == nil {
+					m.appendToOutput("[the shell exited; ctrl+t twice starts a new one]")
+					return m, nil
+				}
+				line := m.input.Value()
+				if _, err := m.shell.Write([]byte(line + "\n")); err != nil {
+					m.appendToOutput(fmt.Sprintf("[could not write to the shell: %v]", err))
+				}
+				if m.saved != nil && m.saved.Title == "" && strings.TrimSpace(line) != "" {
+					m.saved.Title = "$ " + line
+				}
+				m.input.Reset()
+				m.autosave()
+				return m, nil
 			}
 		case "f1":
 			m.backend = "openai"
 			m.client = m.clients[m.backend]
+			m.session.SetClient(m.client)
 			m.appendToOutput("[switched to OpenAI]")
 		case "f2":
 			m.backend = "localop"
 			m.client = m.clients[m.backend]
+			m.session.SetClient(m.client)
 			m.appendToOutput("[switched to LocalOp]")
 		case "f3":
 			m.backend = "codex"
 			m.client = m.clients[m.backend]
+			m.session.SetClient(m.client)
 			m.appendToOutput("[switched to Codex]")
 		case "f4":
 			m.backend = "claude"
 			m.client = m.clients[m.backend]
+			m.session.SetClient(m.client)
 			m.appendToOutput("[switched to Claude]")
 		case "esc":
 			if m.mode == ModeBash {
-				m.mode = ModeAI
-				m.input.SetValue("")
+				return m, m.toggleMode()
 			}
 		}
 
+	case agent.Event:
+		cmd := m.handleEvent(msg)
+		return m, tea.Batch(cmd, waitEvent(m.session))
+
+	case changesMsg:
+		switch {
+		case msg.Err != nil:
+			m.appendToOutput(fmt.Sprintf("[could not compare with the checkpoint: %v]", msg.Err))
+		case msg.Diff.Empty():
+			m.appendToOutput("[no files changed]")
+		default:
+			m.appendToOutput(fmt.Sprintf("[%d files changed; %s undoes]\n%s", len(msg.Diff.Changes), m.keys.Undo.Help().Key, showChanges(msg.Diff)))
+		}
+		return m, nil
+
+	case checkpointMsg:
+		if !m.snapshotting {
+			return m, nil
+		}
+		m.snapshotting = false
+		if msg.Err != nil {
+			m.appendToOutput(fmt.Sprintf("[no checkpoint, this command cannot be undone: %v]", msg.Err))
+		} else {
+			m.pending = &msg.Checkpoint
+		}
+		m.start(msg.Command, msg.Options)
+		return m, nil
+
+	case undoneMsg:
+		if msg.Err != nil {
+			m.undo = append(m.undo, msg.Checkpoint)
+			m.appendToOutput(fmt.Sprintf("[undo failed: %v]", msg.Err))
+			return m, nil
+		}
+		var files []string
+		for _, c := range msg.Diff.Changes {
+			files = append(files, c.Path)
+		}
+		m.record(audit.Entry{Event: audit.EventUndo, Command: msg.Checkpoint.Command, Details: map[string]any{"checkpoint": msg.Checkpoint.ID, "files": files}})
+		m.appendToOutput(fmt.Sprintf("[undid %s]\n%s", msg.Checkpoint.Command, showChanges(msg.Diff)))
+		m.tell(fmt.Sprintf(
+			"I undid the command `%s`: the files in %s were restored to their state before it ran (%d files reverted). Do not assume its changes are present.",
+			msg.Checkpoint.Command, m.checkpoints.Dir(), len(files)))
+		return m, nil
+
+	case autoTickMsg:
+		m.checkRun()
+		if m.run.Active() {
+			return m, autoTick()
+		}
+		return m, nil
+
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
 		m.output.Width = msg.Width
 		m.output.Height = msg.Height - 2 // Leave room for input
 		m.input.Width = msg.Width
-
-	case llm.Chunk:
-		// Handle text content
-		if msg.Text != "" {
-			m.appendToOutput(msg.Text)
-		}
-
-		// Check for tool call
-		if msg.ToolCall != nil {
-			// Create and show dialog
-			m.dialog = tui.NewDialog(msg.ToolCall.Command, msg.ToolCall.Reason)
-			m.showDialog = true
-		}
-
-		// Add the AI response to history
-		if msg.Text != "" {
-			m.history = append(m.history, llm.Message{
-				Role:    "assistant",
-				Content: msg.Text,
-			})
+		if m.shell != nil {
+			m.shell.Resize(m.shellSize())
 		}
+	}
 
-		// Continue streaming if we have more chunks
-		cmds = append(cmds, streamChunks(m.chunkChan))
+	// Resizes, cursor blinks and results from $EDITOR for the dialog
+	if m.showDialog {
+		dialog, cmd := m.dialog.Update(msg)
+		*m.dialog = dialog
+		cmds = append(cmds, cmd)
+	} else if m.showPlan {
+		checklist, cmd := m.checklist.Update(msg)
+		*m.checklist = checklist
+		cmds = append(cmds, cmd)
+	} else if m.showSessions {
+		browser, cmd := m.browser.Update(msg)
+		*m.browser = browser
+		cmds = append(cmds, cmd)
 	}
 
 	// Update input
@@ -345,7 +1612,8 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, tea.Batch(cmds...)
 }
 
-// BaseModel represents the main application view
+// BaseModel renders already laid out content, such as the main view or
+// the approval dialog, for the overlay.
 type BaseModel struct {
 	content string
 	width   int
@@ -367,84 +1635,80 @@ func (m BaseModel) View() string {
 		Render(m.content)
 }
 
-// DialogModel represents the dialog view
-type DialogModel struct {
-	content  string
-	width    int
-	height   int
-	selected int // 0: none, 1: approve, 2: deny
-}
+// trackerSteps is the number of recent steps the tracker lists.
+const trackerSteps = 3
 
-func (m DialogModel) Init() tea.Cmd {
-	return nil
-}
+var trackerStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#87ceeb"))
 
-func (m DialogModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	switch msg := msg.(type) {
-	case tea.KeyMsg:
-		switch msg.String() {
-		case "left":
-			if m.selected > 1 {
-				m.selected--
-			}
-		case "right":
-			if m.selected < 2 {
-				m.selected++
-			}
-		case "enter":
-			// selection handled by parent model
-			return m, nil
+// tracker renders the progress of the autonomous run: its state and
+// budget, then its most recent steps.
+func (m Model) tracker() string {
+	if m.run == nil {
+		return ""
+	}
+	var state string
+	switch {
+	case !m.run.Active():
+		state = "■ stopped: " + m.run.Stopped
+	case m.run.Paused:
+		state = "⏸ paused"
+	default:
+		state = "▶ running"
+	}
+	lines := []string{trackerStyle.Render(fmt.Sprintf("auto %s · %s", state, m.run.Status(time.Now())))}
+	steps := m.run.Steps[max(len(m.run.Steps)-trackerSteps, 0):]
+	for i, st := range steps {
+		n := len(m.run.Steps) - len(steps) + i + 1
+		switch {
+		case st.Running:
+			lines = append(lines, fmt.Sprintf("  %d … %s", n, st.Command))
+		case st.ExitCode == 0:
+			lines = append(lines, okBadgeStyle.Render(fmt.Sprintf("  %d ✓", n))+" "+st.Command)
+		default:
+			lines = append(lines, failBadgeStyle.Render(fmt.Sprintf("  %d ✗ exit %d", n, st.ExitCode))+" "+st.Command)
 		}
 	}
-	return m, nil
+	width := max(m.width, 20)
+	for i, l := range lines {
+		if lipgloss.Width(l) > width {
+			lines[i] = lipgloss.NewStyle().MaxWidth(width-1).Render(l) + "…"
+		}
+	}
+	return strings.Join(lines, "\n")
 }
 
-func (m DialogModel) View() string {
-	// Style for buttons
-	buttonStyle := lipgloss.NewStyle().
-		Padding(0, 1).
-		BorderStyle(lipgloss.RoundedBorder()).
-		BorderForeground(lipgloss.Color("#87ceeb"))
-
-	// Style for selected button
-	selectedStyle := buttonStyle.Copy().
-		BorderForeground(lipgloss.Color("#874BFD")).
-		Foreground(lipgloss.Color("#874BFD"))
-
-	// Create buttons
-	approveBtn := "✓ Approve"
-	denyBtn := "✗ Deny"
+// planSteps is the number of steps the plan panel lists.
+const planSteps = 6
 
-	// Apply selection styling
-	if m.selected == 1 {
-		approveBtn = selectedStyle.Render(approveBtn)
-	} else {
-		approveBtn = buttonStyle.Render(approveBtn)
+// planPanel renders the progress of the plan while it runs and after it
+// ended: its state, then the steps around the current one.
+func (m Model) planPanel() string {
+	if m.plan == nil || m.showPlan || len(m.plan.Steps) == 0 {
+		return ""
 	}
-	if m.selected == 2 {
-		denyBtn = selectedStyle.Render(denyBtn)
-	} else {
-		denyBtn = buttonStyle.Render(denyBtn)
+	state := "▶ running"
+	if !m.plan.Active() {
+		state = "■ " + m.plan.Stopped
 	}
-
-	// Create button row
-	buttonRow := lipgloss.JoinHorizontal(
-		lipgloss.Center,
-		approveBtn,
-		lipgloss.NewStyle().Padding(0, 2).Render(""),
-		denyBtn,
-	)
-
-	// Combine content and buttons
-	content := fmt.Sprintf("%s\n\n%s", m.content, buttonRow)
-
-	return lipgloss.NewStyle().
-		BorderStyle(lipgloss.RoundedBorder()).
-		BorderForeground(lipgloss.Color("#874BFD")).
-		Padding(1, 2).
-		Width(m.width).
-		Height(m.height).
-		Render(content)
+	lines := []string{trackerStyle.Render(fmt.Sprintf("plan %s · %s done", state, m.plan.Progress()))}
+	at := m.plan.Current()
+	if at < 0 {
+		at = m.plan.Next()
+	}
+	if at < 0 {
+		at = len(m.plan.Steps) - 1
+	}
+	from := max(min(at-1, len(m.plan.Steps)-planSteps), 0)
+	for i := from; i < min(from+planSteps, len(m.plan.Steps)); i++ {
+		lines = append(lines, "  "+tui.StepLine(i, m.plan.Steps[i]))
+	}
+	width := max(m.width, 20)
+	for i, l := range lines {
+		if lipgloss.Width(l) > width {
+			lines[i] = lipgloss.NewStyle().MaxWidth(width-1).Render(l) + "…"
+		}
+	}
+	return strings.Join(lines, "\n")
 }
 
 // View renders the UI
@@ -457,50 +1721,67 @@ func (m Model) View() string {
 	// Navigation bar with backend choices
 	nav := fmt.Sprintf("F1 OpenAI | F2 LocalOp | F3 Codex | F4 Claude   [current: %s]", m.backend)
 
+	mode := m.mode.String()
+	if m.auto {
+		mode += " · auto"
+	}
+	if m.planMode {
+		mode += " · plan"
+	}
+
+	// The step tracker and plan panel take their lines from the output.
+	var tracker string
+	for _, panel := range []string{m.tracker(), m.planPanel()} {
+		if panel != "" {
+			m.output.Height = max(m.output.Height-lipgloss.Height(panel), 3)
+			tracker += panel + "\n"
+		}
+	}
+
 	// Base view with input and output
-	base := fmt.Sprintf("%s\n%s\n%s",
-		modeStyle.Render(fmt.Sprintf("[%s]", m.mode)),
+	base := fmt.Sprintf("%s\n%s\n%s%s",
+		modeStyle.Render(fmt.Sprintf("[%s]", mode)),
 		m.output.View(),
+		tracker,
 		m.input.View(),
 	)
 
-	footer := fmt.Sprintf("%s %s | %s %s | %s %s",
+	footer := fmt.Sprintf("%s %s | %s %s | %s %s | %s %s | %s %s",
 		m.keys.Toggle.Help().Key, m.keys.Toggle.Help().Desc,
 		m.keys.Run.Help().Key, m.keys.Run.Help().Desc,
-		m.keys.Quit.Help().Key, m.keys.Quit.Help().Desc)
+		m.keys.Quit.Help().Key, m.keys.Quit.Help().Desc,
+		m.keys.Auto.Help().Key, m.keys.Auto.Help().Desc,
+		m.keys.Plan.Help().Key, m.keys.Plan.Help().Desc)
+	if m.run.Active() {
+		footer += fmt.Sprintf(" | %s %s", m.keys.Pause.Help().Key, m.keys.Pause.Help().Desc)
+	}
+	if m.redactor != nil {
+		footer += fmt.Sprintf(" | %s %s", m.keys.Secrets.Help().Key, m.keys.Secrets.Help().Desc)
+	}
+	if m.checkpoints != nil && len(m.undo) > 0 {
+		footer += fmt.Sprintf(" | %s %s", m.keys.Undo.Help().Key, m.keys.Undo.Help().Desc)
+	}
+	if m.store != nil {
+		footer += fmt.Sprintf(" | %s %s", m.keys.Sessions.Help().Key, m.keys.Sessions.Help().Desc)
+	}
 
 	baseView := fmt.Sprintf("%s\n%s\n%s", nav, base, footer)
 
 	if m.showDialog && m.dialog != nil {
-		// Lazily create and then reuse the overlay so that the
-		// dialog's selection state persists across renders.
-		// Update dialog and base model content
-		dialogContent := fmt.Sprintf("Command: %s\n\nReason: %s",
-			m.dialog.Command,
-			m.dialog.Reason,
-		)
-
-		m.baseModel.content = baseView
-		m.baseModel.width = m.width
-		m.baseModel.height = m.height
-
-		if m.overlay == nil {
-			m.dialogModel = DialogModel{
-				content:  dialogContent,
-				width:    m.width / 2,
-				height:   m.height / 3,
-				selected: 1,
-			}
-			m.overlay = overlay.New(&m.dialogModel, &m.baseModel, overlay.Center, overlay.Center, 0, 0)
-		} else {
-			m.dialogModel.content = dialogContent
-			m.overlay.Foreground = &m.dialogModel
-			m.overlay.Background = &m.baseModel
-		}
-
-		return m.overlay.View()
+		background := BaseModel{content: baseView, width: m.width, height: m.height}
+		dialog := BaseModel{content: m.dialog.View()}
+		return overlay.New(&dialog, &background, overlay.Center, overlay.Center, 0, 0).View()
+	}
+	if m.showPlan && m.checklist != nil {
+		background := BaseModel{content: baseView, width: m.width, height: m.height}
+		checklist := BaseModel{content: m.checklist.View()}
+		return overlay.New(&checklist, &background, overlay.Center, overlay.Center, 0, 0).View()
+	}
+	if m.showSessions && m.browser != nil {
+		background := BaseModel{content: baseView, width: m.width, height: m.height}
+		browser := BaseModel{content: m.browser.View()}
+		return overlay.New(&browser, &background, overlay.Center, overlay.Center, 0, 0).View()
 	}
 
-	m.overlay = nil
 	return baseView
 }
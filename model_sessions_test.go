@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/jrcrittenden/ai-shell/agent"
+	"github.com/jrcrittenden/ai-shell/internal/export"
+	"github.com/jrcrittenden/ai-shell/internal/sessions"
+	"github.com/jrcrittenden/ai-shell/internal/tui"
+	"github.com/jrcrittenden/ai-shell/llm"
+)
+
+// echoClient answers every request by repeating the last message.
+type echoClient struct{}
+
+func (echoClient) Stream(ctx context.Context, hist []llm.Message) <-chan llm.Chunk {
+	out := make(chan llm.Chunk, 2)
+	out <- llm.Chunk{Text: "you said: " + hist[len(hist)-1].Content}
+	out <- llm.Chunk{Done: true}
+	close(out)
+	return out
+}
+
+// send types prompt into m and handles the session's events until the
+// turn ends.
+func send(t *testing.T, m Model, prompt string) Model {
+	t.Helper()
+	m.input.SetValue(prompt)
+	tm, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = tm.(Model)
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-m.session.Events():
+			tm, _ = m.Update(e)
+			m = tm.(Model)
+			if _, ok := e.(agent.DoneEvent); ok {
+				return m
+			}
+		case <-timeout:
+			t.Fatal("turn did not end")
+		}
+	}
+}
+
+func sessionModel(t *testing.T, store *sessions.Store) Model {
+	m := NewModel(map[string]llm.Client{"mock": echoClient{}}, "mock", agent.Options{})
+	m.store = store
+	m.saved = sessions.New("mock", "", t.TempDir())
+	return m
+}
+
+func TestSessionAutosaveAndResume(t *testing.T) {
+	store, err := sessions.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := send(t, sessionModel(t, store), "hello")
+	first = send(t, first, "again")
+
+	saved, err := store.Load(first.saved.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Title != "hello" || len(saved.Messages) != 4 || !strings.Contains(saved.Transcript, "you said: again") {
+		t.Errorf("saved session = %+v", saved)
+	}
+	if md := export.Markdown(saved); !strings.Contains(md, "> again\n\n### Answer\n\nyou said: again\n") {
+		t.Errorf("exported:\n%s", md)
+	}
+
+	// A new session resumes where the first one stopped.
+	second := sessionModel(t, store)
+	second = send(t, second, "other")
+	second.resume(saved)
+	if h := second.session.History(); len(h) != 4 || h[2].Content != "again" {
+		t.Errorf("resumed history = %+v", h)
+	}
+	if !strings.Contains(second.aiContent, "you said: again") || !strings.Contains(second.aiContent, "[resumed session") {
+		t.Errorf("resumed transcript = %q", second.aiContent)
+	}
+
+	// The browser lists both and switches back to "other".
+	tm, _ := second.Update(tea.KeyMsg{Type: tea.KeyF8})
+	second = tm.(Model)
+	if !second.showSessions {
+		t.Fatal("F8 did not open the browser")
+	}
+	list, _ := store.List()
+	var other string
+	for _, s := range list {
+		if s.Title == "other" {
+			other = s.ID
+		}
+	}
+	tm, _ = second.Update(tui.SessionOpenMsg{ID: other})
+	second = tm.(Model)
+	if second.showSessions || second.saved.ID != other || second.session.History()[0].Content != "other" {
+		t.Errorf("after switching: session %s, history %+v", second.saved.ID, second.session.History())
+	}
+}
+
+func TestBashModeRecording(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	t.Setenv("PS1", "$ ")
+	m := sessionModel(t, nil)
+	tm, cmd := m.Update(tea.KeyMsg{Type: tea.KeyCtrlT})
+	m = tm.(Model)
+	if m.mode != ModeBash || m.shell == nil {
+		t.Fatalf("ctrl+t: mode %s, shell %v", m.mode, m.shell)
+	}
+	defer m.closeShell()
+
+	m.input.SetValue("echo hi-$((40+2))")
+	tm, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = tm.(Model)
+	for !strings.Contains(m.bashOutput, "hi-42\n") {
+		msgs := make(chan tea.Msg, 1)
+		go func() { msgs <- cmd() }()
+		select {
+		case msg := <-msgs:
+			tm, cmd = m.Update(msg)
+			m = tm.(Model)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no output; Bash pane:\n%s", m.bashOutput)
+		}
+	}
+	if strings.ContainsAny(m.bashOutput, "\r\x1b") {
+		t.Errorf("control characters in the Bash pane: %q", m.bashOutput)
+	}
+	if m.saved.Title != "$ echo hi-$((40+2))" || m.saved.Empty() {
+		t.Errorf("session title %q, empty %v", m.saved.Title, m.saved.Empty())
+	}
+
+	var cast bytes.Buffer
+	if err := export.Asciicast(&cast, m.saved); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(cast.String(), `hi-42\r\n`) {
+		t.Errorf("asciicast:\n%s", cast.String())
+	}
+
+	tm, _ = m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	if m = tm.(Model); m.mode != ModeAI {
+		t.Error("esc did not leave Bash mode")
+	}
+}